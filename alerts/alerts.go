@@ -0,0 +1,350 @@
+package alerts
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slashcaster/locale"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// Output formats, one per notifier
+const (
+	FormatMarkdownV2 = "markdownv2" // Telegram MarkdownV2
+	FormatHTML       = "html"       // Telegram HTML
+	FormatPlain      = "plain"      // Plain text
+	FormatDiscord    = "discord"    // Discord embeds, in Discord markdown
+)
+
+// Formats Telegram alerts can be sent in
+var TelegramFormats = []string{FormatMarkdownV2, FormatHTML, FormatPlain}
+
+// Kinds of alerts, each with its own template
+const (
+	KindChannel = "channel" // Slashing broadcast to a channel
+	KindDM      = "dm"      // Slashing sent to a subscriber
+	KindDigest  = "digest"  // Digest sent to a subscriber
+)
+
+// Kinds, in the order templates are loaded
+var kinds = []string{KindChannel, KindDM, KindDigest}
+
+// Template defining a title, used by formats that have one
+const titleTemplate = "title"
+
+// Output of a template function that is already escaped for the format
+type Safe string
+
+type markup struct {
+	/* How a format escapes text and marks it up */
+	parseMode string                        // Telegram parse mode of the format
+	escape    func(text string) string      // Escapes text so it is shown as is
+	bold      string                        // Format string making text bold
+	italic    string                        // Format string making text italic
+	link      func(text, url string) string // Links escaped text to url
+}
+
+var markdownV2Escaper = strings.NewReplacer(
+	"\\", "\\\\", "_", "\\_", "*", "\\*", "[", "\\[", "]", "\\]", "(", "\\(", ")", "\\)", "~", "\\~",
+	"`", "\\`", ">", "\\>", "#", "\\#", "+", "\\+", "-", "\\-", "=", "\\=", "|", "\\|",
+	"{", "\\{", "}", "\\}", ".", "\\.", "!", "\\!",
+)
+
+var discordEscaper = strings.NewReplacer(
+	"\\", "\\\\", "*", "\\*", "_", "\\_", "~", "\\~", "`", "\\`", "|", "\\|", ">", "\\>", "[", "\\[", "]", "\\]",
+)
+
+var markups = map[string]markup{
+	FormatMarkdownV2: {
+		parseMode: "MarkdownV2",
+		escape:    EscapeMarkdownV2,
+		bold:      "*%s*",
+		italic:    "_%s_",
+		link: func(text, url string) string {
+			// Within the URL, only ) and \ are reserved
+			return fmt.Sprintf("[%s](%s)", text, strings.NewReplacer("\\", "\\\\", ")", "\\)").Replace(url))
+		},
+	},
+	FormatHTML: {
+		parseMode: "HTML",
+		escape:    html.EscapeString,
+		bold:      "<b>%s</b>",
+		italic:    "<i>%s</i>",
+		link: func(text, url string) string {
+			return fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(url), text)
+		},
+	},
+	FormatPlain: {
+		escape: func(text string) string { return text },
+		bold:   "%s",
+		italic: "%s",
+		link: func(text, url string) string {
+			return fmt.Sprintf("%s (%s)", text, url)
+		},
+	},
+	FormatDiscord: {
+		escape: discordEscaper.Replace,
+		bold:   "**%s**",
+		italic: "_%s_",
+		link: func(text, url string) string {
+			return fmt.Sprintf("[%s](%s)", text, url)
+		},
+	},
+}
+
+//go:embed templates
+var builtinFiles embed.FS
+
+func EscapeMarkdownV2(text string) string {
+	/* Escapes characters reserved in Telegram's MarkdownV2 */
+	return markdownV2Escaper.Replace(text)
+}
+
+func ParseMode(format string) string {
+	/* Telegram parse mode of a format, empty for plain text */
+	return markups[format].parseMode
+}
+
+func ValidTelegramFormat(format string) bool {
+	/* Can Telegram alerts be sent in format? */
+	for _, valid := range TelegramFormats {
+		if format == valid {
+			return true
+		}
+	}
+
+	return false
+}
+
+func integer(value interface{}) int64 {
+	// Convert the integer types of the data model for template functions
+	switch value := value.(type) {
+	case int:
+		return int64(value)
+	case int64:
+		return value
+	case uint64:
+		return int64(value)
+	}
+
+	return 0
+}
+
+func funcs(format string, lang string) template.FuncMap {
+	/*
+		Functions available to templates. Their output is escaped for format, and
+		text comes from the message catalog of lang.
+	*/
+	m := markups[format]
+
+	escape := func(value interface{}) Safe {
+		if safe, ok := value.(Safe); ok {
+			return safe
+		}
+
+		return Safe(m.escape(fmt.Sprint(value)))
+	}
+
+	return template.FuncMap{
+		"escape": escape,
+		"raw":    func(text string) Safe { return Safe(text) },
+		"t": func(key string, args ...interface{}) Safe {
+			text := m.escape(locale.T(lang, key))
+			if len(args) == 0 {
+				return Safe(text)
+			}
+
+			escaped := make([]interface{}, len(args))
+			for i, arg := range args {
+				escaped[i] = escape(arg)
+			}
+
+			return Safe(fmt.Sprintf(text, escaped...))
+		},
+		"plural": func(key string, n interface{}) Safe {
+			return escape(locale.Plural(lang, int(integer(n)), key))
+		},
+		"number": func(n interface{}) Safe {
+			return escape(locale.Number(lang, integer(n)))
+		},
+		"eth": func(gwei interface{}) Safe {
+			return escape(locale.Decimal(lang, float64(integer(gwei))/1e9, 2))
+		},
+		"duration": func(d time.Duration) Safe {
+			return escape(locale.Duration(lang, d))
+		},
+		"bold": func(text interface{}) Safe {
+			return Safe(fmt.Sprintf(m.bold, escape(text)))
+		},
+		"italic": func(text interface{}) Safe {
+			return Safe(fmt.Sprintf(m.italic, escape(text)))
+		},
+		"link": func(text interface{}, url string) Safe {
+			return Safe(m.link(string(escape(text)), url))
+		},
+	}
+}
+
+func newIdentCmd(identifier string, pos parse.Pos) *parse.CommandNode {
+	// A pipeline command calling a function
+	return &parse.CommandNode{
+		NodeType: parse.NodeCommand,
+		Args:     []parse.Node{parse.NewIdentifier(identifier).SetTree(nil).SetPos(pos)},
+	}
+}
+
+func escapeActions(node parse.Node) {
+	/*
+		Pipes the output of every action through escape, like html/template does,
+		so data is always escaped for the format. Functions returning Safe, like t
+		and link, escape their own input. Literal template text is left as is.
+	*/
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return
+		}
+
+		for _, child := range node.Nodes {
+			escapeActions(child)
+		}
+	case *parse.ActionNode:
+		if len(node.Pipe.Decl) == 0 {
+			node.Pipe.Cmds = append(node.Pipe.Cmds, newIdentCmd("escape", node.Pos))
+		}
+	case *parse.IfNode:
+		escapeActions(node.List)
+		escapeActions(node.ElseList)
+	case *parse.RangeNode:
+		escapeActions(node.List)
+		escapeActions(node.ElseList)
+	case *parse.WithNode:
+		escapeActions(node.List)
+		escapeActions(node.ElseList)
+	}
+}
+
+func parseTemplate(name string, format string, source string) (*template.Template, error) {
+	// Parse a template, escaping its actions for format
+	tmpl, err := template.New(name).Funcs(funcs(format, locale.Default)).Option("missingkey=error").Parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, defined := range tmpl.Templates() {
+		if defined.Tree != nil {
+			escapeActions(defined.Tree.Root)
+		}
+	}
+
+	return tmpl, nil
+}
+
+type Templates struct {
+	/* Parsed alert templates, by format and kind */
+	templates map[string]*template.Template // Map "format/kind" to its template
+}
+
+type Alert struct {
+	/* A rendered alert */
+	Title string // Title, for formats that have one: the template's "title" block
+	Text  string // Body of the alert
+}
+
+func Load(dir string) (*Templates, error) {
+	/*
+		Parses the built-in templates, replacing them with the operator's
+		templates in dir, if set. Templates are looked up as
+		<dir>/<format>/<kind>.tmpl, e.g. templates/html/channel.tmpl.
+	*/
+	templates := &Templates{templates: make(map[string]*template.Template)}
+
+	for format := range markups {
+		for _, kind := range kinds {
+			name := format + "/" + kind
+			source, err := fs.ReadFile(builtinFiles, "templates/"+name+".tmpl")
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
+
+			if dir != "" {
+				override, err := os.ReadFile(filepath.Join(dir, format, kind+".tmpl"))
+				if err == nil {
+					source = override
+				} else if !errors.Is(err, fs.ErrNotExist) {
+					return nil, err
+				}
+			}
+
+			if source == nil {
+				continue
+			}
+
+			if templates.templates[name], err = parseTemplate(name, format, string(source)); err != nil {
+				return nil, fmt.Errorf("template %s: %w", name, err)
+			}
+		}
+	}
+
+	return templates, nil
+}
+
+var builtin struct {
+	templates *Templates
+	once      sync.Once
+}
+
+func Builtin() *Templates {
+	/* The built-in templates, e.g. as a fallback for a failing operator template */
+	builtin.once.Do(func() {
+		var err error
+		if builtin.templates, err = Load(""); err != nil {
+			panic(err)
+		}
+	})
+
+	return builtin.templates
+}
+
+func (templates *Templates) Render(format string, kind string, lang string, data interface{}) (Alert, error) {
+	/* Renders the kind of alert in format and lang, with data from the data model */
+	tmpl, ok := templates.templates[format+"/"+kind]
+	if !ok {
+		return Alert{}, fmt.Errorf("no %s template for %s", kind, format)
+	}
+
+	// Bind the template functions to the language
+	tmpl, err := tmpl.Clone()
+	if err != nil {
+		return Alert{}, err
+	}
+
+	tmpl.Funcs(funcs(format, lang))
+
+	var alert Alert
+	var text strings.Builder
+	if err = tmpl.Execute(&text, data); err != nil {
+		return alert, err
+	}
+
+	alert.Text = strings.TrimSpace(text.String())
+
+	if title := tmpl.Lookup(titleTemplate); title != nil {
+		text.Reset()
+		if err = title.Execute(&text, data); err != nil {
+			return alert, err
+		}
+
+		alert.Title = strings.TrimSpace(text.String())
+	}
+
+	return alert, nil
+}
@@ -0,0 +1,150 @@
+package alerts
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testSlashing() Slashing {
+	return Slashing{
+		Slot: 4700000, LastSlot: 4700000, SlotURL: "https://beaconcha.in/block/4700000",
+		Validators: []Validator{
+			{Index: "42", URL: "https://beaconcha.in/validator/42", Attester: true, Penalty: 1e9},
+			{Index: "43", URL: "https://beaconcha.in/validator/43", Attester: true, Proposer: true},
+		},
+		AttesterSlashings: 1,
+		SincePrevious:     time.Hour,
+		Language:          "en",
+	}
+}
+
+func testDigest() Digest {
+	return Digest{
+		Mode: "daily", ValidatorCount: 2, IncidentCount: 1, AttesterSlashings: 1, Penalties: 15e8,
+		Validators: testSlashing().Validators,
+		Incidents:  []Incident{{Slot: 4700000, SlotURL: "https://beaconcha.in/block/4700000", Validators: 2}},
+		Language:   "en",
+	}
+}
+
+func TestBuiltinTemplates(t *testing.T) {
+	tests := []struct {
+		format   string
+		kind     string
+		lang     string
+		data     interface{}
+		expected []string
+	}{
+		{FormatMarkdownV2, KindChannel, "en", testSlashing(), []string{
+			"🔪 2 validators slashed in slot [4,700,000](https://beaconcha.in/block/4700000)\n\nValidators slashed\n",
+			"[42](https://beaconcha.in/validator/42): attestor violation \\(\\-1\\.00 ETH\\)\n",
+			"[43](https://beaconcha.in/validator/43): attestator & proposer violation\n",
+			"_1 hour since last slashing\\._",
+		}},
+		{FormatMarkdownV2, KindDM, "de", testSlashing(), []string{
+			"Slot [4\\.700\\.000](https://beaconcha.in/block/4700000)", "Attestierungsverstoß \\(\\-1,00 ETH\\)", "/settings",
+		}},
+		{FormatHTML, KindChannel, "en", testSlashing(), []string{
+			`<a href="https://beaconcha.in/validator/43">43</a>: attestator &amp; proposer violation`,
+			"<i>1 hour since last slashing.</i>",
+		}},
+		{FormatPlain, KindDM, "en", testSlashing(), []string{
+			"🔪 2 validators slashed in slot 4,700,000\nhttps://beaconcha.in/block/4700000", "42: attestor violation (-1.00 ETH)",
+		}},
+		{FormatDiscord, KindChannel, "en", testSlashing(), []string{
+			"**Validators slashed**", "[42](https://beaconcha.in/validator/42): attestor violation (-1.00 ETH)",
+		}},
+		{FormatMarkdownV2, KindDigest, "en", testDigest(), []string{
+			"📰 *Daily slashing digest*\n\n2 validators slashed in 1 incident\n", "Initial penalties: 1\\.50 ETH",
+			"[4,700,000](https://beaconcha.in/block/4700000): 2 validators",
+			"[42](https://beaconcha.in/validator/42), [43](https://beaconcha.in/validator/43)",
+		}},
+		{FormatHTML, KindDigest, "de", testDigest(), []string{"<b>Tägliche Slashing-Zusammenfassung</b>", "Anfängliche Strafen: 1,50 ETH"}},
+		{FormatPlain, KindDigest, "en", testDigest(), []string{"Validators involved\n42, 43"}},
+	}
+
+	for _, test := range tests {
+		alert, err := Builtin().Render(test.format, test.kind, test.lang, test.data)
+		if err != nil {
+			t.Fatalf("Rendering %s %s failed: %v", test.format, test.kind, err)
+		}
+
+		for _, expected := range test.expected {
+			if !strings.Contains(alert.Text, expected) {
+				t.Errorf("Expected %q in %s %s, got:\n%s", expected, test.format, test.kind, alert.Text)
+			}
+		}
+	}
+
+	// Discord embeds have a title
+	alert, _ := Builtin().Render(FormatDiscord, KindChannel, "en", testSlashing())
+	if alert.Title != "🔪 2 validators slashed" {
+		t.Errorf("Expected a Discord embed title, got %q", alert.Title)
+	}
+
+	if _, err := Builtin().Render(FormatDiscord, KindDigest, "en", testDigest()); err == nil {
+		t.Errorf("Expected an error for a kind without template")
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	// Data is escaped for each format, whatever the template does with it
+	dir := t.TempDir()
+	source := "{{.Index}} {{bold .Index}} {{link .Index .URL}} {{raw \"<b>kept</b>\"}}"
+
+	for _, format := range []string{FormatMarkdownV2, FormatHTML, FormatDiscord} {
+		if err := os.MkdirAll(filepath.Join(dir, format), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(filepath.Join(dir, format, KindDM+".tmpl"), []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	templates, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Loading templates failed: %v", err)
+	}
+
+	validator := Validator{Index: "<4_2*>", URL: "https://example.com/a)b"}
+	expected := map[string]string{
+		FormatMarkdownV2: "<4\\_2\\*\\> *<4\\_2\\*\\>* [<4\\_2\\*\\>](https://example.com/a\\)b) <b>kept</b>",
+		FormatHTML:       `&lt;4_2*&gt; <b>&lt;4_2*&gt;</b> <a href="https://example.com/a)b">&lt;4_2*&gt;</a> <b>kept</b>`,
+		FormatDiscord:    "<4\\_2\\*\\> **<4\\_2\\*\\>** [<4\\_2\\*\\>](https://example.com/a)b) <b>kept</b>",
+	}
+
+	for format, text := range expected {
+		alert, err := templates.Render(format, KindDM, "en", validator)
+		if err != nil {
+			t.Fatalf("Rendering %s failed: %v", format, err)
+		}
+
+		if alert.Text != text {
+			t.Errorf("Expected %s output %q, got %q", format, text, alert.Text)
+		}
+	}
+
+	// Templates that aren't overridden are the built-in ones
+	if _, err = templates.Render(FormatMarkdownV2, KindChannel, "en", testSlashing()); err != nil {
+		t.Errorf("Expected built-in channel template, got %v", err)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, FormatHTML), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, FormatHTML, KindDigest+".tmpl"), []byte("{{if .Mode}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(dir); err == nil || !strings.Contains(err.Error(), "html/digest") {
+		t.Fatalf("Expected a parse error naming the template, got %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package alerts
+
+import "time"
+
+// Channel and DM templates are executed with a Slashing, digest templates with a Digest
+type Slashing struct {
+	/* A slashing event: the slashings included in a slot, or in an incident spanning several slots */
+	Slot              int64         // Slot the slashings were included in
+	LastSlot          int64         // Last slot of an incident spanning several slots, else equal to Slot
+	SlotURL           string        // beaconcha.in page of Slot
+	LastSlotURL       string        // beaconcha.in page of LastSlot
+	Validators        []Validator   // Slashed validators
+	AttesterSlashings int           // Count of attester slashing operations included
+	ProposerSlashings int           // Count of proposer slashing operations included
+	Reorged           bool          // Has the slashing been reorged out of the canonical chain?
+	Time              time.Time     // Time of the slot
+	SincePrevious     time.Duration // Time since the previous slashing
+	Language          string        // Language the alert is rendered in, e.g. "en"
+}
+
+type Validator struct {
+	/* A slashed validator */
+	Index    string // Validator index
+	URL      string // beaconcha.in page of the validator
+	Attester bool   // Slashed for an attestation violation?
+	Proposer bool   // Slashed for a proposer violation?
+	Penalty  uint64 // Initial penalty in gwei, 0 until it is known
+}
+
+type Digest struct {
+	/* Summary of the slashings of a digest period */
+	Mode              string      // Digest mode: hourly, daily or weekly
+	ValidatorCount    int         // Count of slashed validators
+	Validators        []Validator // The first slashed validators, up to a limit
+	MoreValidators    int         // Count of slashed validators left out of Validators
+	IncidentCount     int         // Count of incidents
+	Incidents         []Incident  // The largest incidents, largest first
+	AttesterSlashings int         // Count of attester slashing operations
+	ProposerSlashings int         // Count of proposer slashing operations
+	Penalties         uint64      // Sum of known initial penalties in gwei
+	Language          string      // Language the digest is rendered in, e.g. "en"
+}
+
+type Incident struct {
+	/* Slashings broadcast together, as listed in digests */
+	Slot       int64  // First slot of the incident
+	SlotURL    string // beaconcha.in page of Slot
+	Validators int    // Count of validators slashed in the incident
+}
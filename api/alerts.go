@@ -0,0 +1,200 @@
+package api
+
+import (
+	"slashcaster/alerts"
+	"slashcaster/config"
+	"slashcaster/locale"
+	"slashcaster/state"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	dg "github.com/bwmarrin/discordgo"
+)
+
+// Beaconcha.in slot and validator URLs
+const (
+	slotURL      = "https://beaconcha.in/block/"
+	validatorURL = "https://beaconcha.in/validator/"
+)
+
+var templates struct {
+	loaded *alerts.Templates // Templates loaded from the configured folder
+	format string            // Format of Telegram alerts
+	mutex  sync.Mutex        // Mutex to avoid concurrent writes
+}
+
+func LoadTemplates(conf *config.Config) error {
+	/*
+		Loads the alert templates from the configured folder, on top of the
+		built-in ones. On error, the templates in use are kept.
+	*/
+	conf.Mutex.Lock()
+	dir, format := conf.Templates.Dir, conf.Templates.Telegram
+	conf.Mutex.Unlock()
+
+	loaded, err := alerts.Load(dir)
+	if err != nil {
+		return err
+	}
+
+	if format == "" {
+		format = alerts.FormatMarkdownV2
+	}
+
+	templates.mutex.Lock()
+	templates.loaded, templates.format = loaded, format
+	templates.mutex.Unlock()
+
+	return nil
+}
+
+func telegramFormat() string {
+	// Format Telegram alerts are rendered in
+	templates.mutex.Lock()
+	defer templates.mutex.Unlock()
+
+	if templates.format == "" {
+		return alerts.FormatMarkdownV2
+	}
+
+	return templates.format
+}
+
+func renderAlert(format string, kind string, lang string, data interface{}) alerts.Alert {
+	/* Renders an alert, falling back to the built-in template if the operator's fails */
+	templates.mutex.Lock()
+	loaded := templates.loaded
+	templates.mutex.Unlock()
+
+	if loaded != nil {
+		alert, err := loaded.Render(format, kind, lang, data)
+		if err == nil {
+			return alert
+		}
+
+		log.Error().Err(err).Msgf("⚠️ Error rendering %s/%s template: using the built-in one", format, kind)
+	}
+
+	alert, err := alerts.Builtin().Render(format, kind, lang, data)
+	if err != nil {
+		log.Error().Err(err).Msgf("⚠️ Error rendering built-in %s/%s template", format, kind)
+	}
+
+	return alert
+}
+
+func slashingData(event SlashingEvent) alerts.Slashing {
+	/* Maps a slashing event to the data model of alert templates */
+	data := alerts.Slashing{
+		Slot:              slotInt(event.Slot),
+		LastSlot:          lastSlot(&event),
+		AttesterSlashings: event.AttSlashings,
+		ProposerSlashings: event.PropSlashings,
+		Reorged:           event.Reorged,
+		Time:              time.Now(),
+	}
+
+	data.SlotURL = slotURL + strconv.FormatInt(data.Slot, 10)
+	data.LastSlotURL = slotURL + strconv.FormatInt(data.LastSlot, 10)
+
+	if event.Time != 0 {
+		data.Time = time.Unix(event.Time, 0)
+	}
+
+	data.SincePrevious = data.Time.Sub(time.Unix(event.PreviousSlashing, 0))
+
+	for _, slashing := range event.Slashings {
+		data.Validators = append(data.Validators, alerts.Validator{
+			Index:    slashing.ValidatorIndex,
+			URL:      validatorURL + slashing.ValidatorIndex,
+			Attester: slashing.AttestationViolation,
+			Proposer: slashing.ProposerViolation,
+			Penalty:  slashing.Penalty,
+		})
+	}
+
+	return data
+}
+
+func recordEvent(record state.SlashingRecord, previousSlashing int64) SlashingEvent {
+	// Rebuild the slashing event of a record from the event history
+	event := SlashingEvent{
+		AttSlashings:     record.AttSlashings,
+		PropSlashings:    record.PropSlashings,
+		Slot:             strconv.FormatInt(record.Slot, 10),
+		Time:             record.Time,
+		PreviousSlashing: previousSlashing,
+		Reorged:          record.Reorged,
+	}
+
+	for _, validator := range record.Validators {
+		event.Slashings = append(event.Slashings, Slashing{
+			AttestationViolation: validator.AttestationViolation,
+			ProposerViolation:    validator.ProposerViolation,
+			ValidatorIndex:       validator.Index,
+			Slot:                 event.Slot,
+			Penalty:              validator.Penalty,
+			OffenceEpoch:         validator.OffenceEpoch,
+		})
+	}
+
+	return event
+}
+
+func renderSlashing(event SlashingEvent, format string, kind string, lang string) alerts.Alert {
+	/* Renders a slashing event as the kind of alert, in format and lang */
+	data := slashingData(event)
+	data.Language = lang
+
+	return renderAlert(format, kind, lang, data)
+}
+
+func slashingTexts(conf *config.Config, event SlashingEvent) func(chat int64, lang string) string {
+	/*
+		Renders a slashing event for Telegram broadcasts: the channel gets the
+		channel template, subscribers the DM template. Each kind and language is
+		rendered once.
+	*/
+	conf.Mutex.Lock()
+	channel := conf.Broadcast.TelegramChannel
+	conf.Mutex.Unlock()
+
+	format := telegramFormat()
+	rendered := make(map[string]string)
+
+	return func(chat int64, lang string) string {
+		kind := alerts.KindDM
+		if chat == channel {
+			kind = alerts.KindChannel
+		}
+
+		text, ok := rendered[kind+"/"+lang]
+		if !ok {
+			text = renderSlashing(event, format, kind, lang).Text
+			rendered[kind+"/"+lang] = text
+		}
+
+		return text
+	}
+}
+
+// Color of slashing embeds on Discord
+const embedColor = 0xe53935
+
+func slashingEmbed(event SlashingEvent) *dg.MessageEmbed {
+	/* Renders a slashing event as a Discord embed, in the default language */
+	data := slashingData(event)
+	data.Language = locale.Default
+	alert := renderAlert(alerts.FormatDiscord, alerts.KindChannel, locale.Default, data)
+
+	return &dg.MessageEmbed{
+		Title:       alert.Title,
+		Description: alert.Text,
+		URL:         data.SlotURL,
+		Color:       embedColor,
+		Timestamp:   data.Time.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"slashcaster/config"
+	"strings"
+	"testing"
+)
+
+func TestSlashingTexts(t *testing.T) {
+	conf := config.Config{Broadcast: config.Broadcast{TelegramChannel: -100}}
+	event := SlashingEvent{
+		Slot:      "4700000",
+		Slashings: []Slashing{{ValidatorIndex: "42", AttestationViolation: true}},
+	}
+
+	texts := slashingTexts(&conf, event)
+
+	// Subscribers get the DM template, which points at /settings
+	if channel := texts(-100, "en"); strings.Contains(channel, "/settings") {
+		t.Errorf("Expected the channel template for the channel, got %q", channel)
+	}
+
+	if dm := texts(1, "en"); !strings.Contains(dm, "/settings") {
+		t.Errorf("Expected the DM template for subscribers, got %q", dm)
+	}
+
+	if dm := texts(1, "de"); !strings.Contains(dm, "Attestierungsverstoß") {
+		t.Errorf("Expected the DM in German, got %q", dm)
+	}
+}
+
+func TestSlashingEmbed(t *testing.T) {
+	event := SlashingEvent{
+		Slot:      "4700000",
+		LastSlot:  "4700002",
+		Slashings: []Slashing{{ValidatorIndex: "42", AttestationViolation: true}},
+	}
+
+	embed := slashingEmbed(event)
+	if embed.Title != "🔪 1 validator slashed" || embed.URL != "https://beaconcha.in/block/4700000" {
+		t.Errorf("Unexpected embed title or URL: %q, %q", embed.Title, embed.URL)
+	}
+
+	if !strings.Contains(embed.Description, "slots [4,700,000](https://beaconcha.in/block/4700000) to [4,700,002]") {
+		t.Errorf("Expected the slot range in the embed, got %q", embed.Description)
+	}
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
@@ -31,7 +32,7 @@ func TestSlashingExtraction(t *testing.T) {
 	}
 
 	for slot, count := range slashings {
-		block, err := getSlot(client, cfg, slot)
+		block, err := getSlot(context.Background(), client, cfg, slot)
 		if err != nil {
 			t.Log("Error getting block at slot:", err)
 			t.Fail()
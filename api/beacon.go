@@ -0,0 +1,43 @@
+package api
+
+import (
+	"slashcaster/config"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// Timeout of beacon node requests
+const beaconTimeout = 30 * time.Second
+
+type BeaconClient struct {
+	/* Client for the beacon node API, shared by the slot streamer and bot commands */
+	client *resty.Client  // HTTP client, safe for concurrent use
+	conf   *config.Config // Config the endpoint is read from on each request
+}
+
+func NewBeaconClient(conf *config.Config) *BeaconClient {
+	client := resty.New()
+	client.SetTimeout(beaconTimeout)
+
+	return &BeaconClient{client: client, conf: conf}
+}
+
+func (beacon *BeaconClient) Head() (string, error) {
+	/* Returns the head slot of the beacon node */
+	return getHead(beacon.client, beacon.conf)
+}
+
+func (beacon *BeaconClient) Validator(id string) (ValidatorData, error) {
+	/* Returns the validator with the given index or pubkey at the chain head */
+	validators, err := getValidators(beacon.client, beacon.conf, "head", []string{id})
+	if err != nil {
+		return ValidatorData{}, err
+	}
+
+	if len(validators) == 0 {
+		return ValidatorData{}, errNotFound
+	}
+
+	return validators[0], nil
+}
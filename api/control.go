@@ -0,0 +1,59 @@
+package api
+
+import "sync"
+
+type Streamer struct {
+	/* Controls a running SlotStreamer, e.g. from owner commands */
+	Beacon *BeaconClient // Beacon node client of the streamer
+	paused bool          // Is streaming paused?
+	resync int64         // Slot to continue streaming from, 0 if none
+	mutex  sync.Mutex    // Mutex to avoid concurrent writes
+}
+
+func NewStreamer(beacon *BeaconClient) *Streamer {
+	return &Streamer{Beacon: beacon}
+}
+
+func (s *Streamer) Pause() bool {
+	/* Pauses streaming after the current slot, returns false if already paused */
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	paused := s.paused
+	s.paused = true
+	return !paused
+}
+
+func (s *Streamer) Resume() bool {
+	/* Resumes streaming, returns false if not paused */
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	paused := s.paused
+	s.paused = false
+	return paused
+}
+
+func (s *Streamer) Paused() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.paused
+}
+
+func (s *Streamer) Resync(slot int64) {
+	/* Moves the streamer's cursor: slot is the next slot streamed */
+	s.mutex.Lock()
+	s.resync = slot
+	s.mutex.Unlock()
+}
+
+func (s *Streamer) takeResync() (int64, bool) {
+	// Returns the slot to resync to, if any, and clears it
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	slot := s.resync
+	s.resync = 0
+	return slot, slot != 0
+}
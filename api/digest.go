@@ -0,0 +1,179 @@
+package api
+
+import (
+	"fmt"
+	"slashcaster/alerts"
+	"slashcaster/config"
+	"slashcaster/locale"
+	"slashcaster/queue"
+	"slashcaster/state"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	tb "gopkg.in/telebot.v3"
+)
+
+// Length of the period each digest mode covers
+var digestPeriods = map[string]time.Duration{
+	state.DeliveryHourly: time.Hour,
+	state.DeliveryDaily:  time.Hour * 24,
+	state.DeliveryWeekly: time.Hour * 24 * 7,
+}
+
+// Max count of incidents and validators listed in a digest
+const (
+	digestIncidents  = 3
+	digestValidators = 20
+)
+
+func digestData(records []state.SlashingRecord, mode string) alerts.Digest {
+	/* Summarises the slashings in records in the data model of digest templates */
+	data := alerts.Digest{Mode: mode}
+
+	// Group records into incidents by their broadcast
+	incidents := make(map[int]*alerts.Incident)
+
+	for _, record := range records {
+		data.AttesterSlashings += record.AttSlashings
+		data.ProposerSlashings += record.PropSlashings
+
+		incident, ok := incidents[record.BroadcastId]
+		if !ok {
+			incident = &alerts.Incident{Slot: record.Slot, SlotURL: slotURL + strconv.FormatInt(record.Slot, 10)}
+			incidents[record.BroadcastId] = incident
+		}
+
+		incident.Validators += len(record.Validators)
+
+		for _, validator := range record.Validators {
+			data.ValidatorCount++
+			data.Penalties += validator.Penalty
+
+			if len(data.Validators) < digestValidators {
+				data.Validators = append(data.Validators, alerts.Validator{
+					Index:    validator.Index,
+					URL:      validatorURL + validator.Index,
+					Attester: validator.AttestationViolation,
+					Proposer: validator.ProposerViolation,
+					Penalty:  validator.Penalty,
+				})
+			}
+		}
+	}
+
+	data.MoreValidators = data.ValidatorCount - len(data.Validators)
+	data.IncidentCount = len(incidents)
+
+	// Sort incidents by size, largest first
+	largest := make([]alerts.Incident, 0, len(incidents))
+	for _, incident := range incidents {
+		largest = append(largest, *incident)
+	}
+
+	sort.Slice(largest, func(i, j int) bool {
+		if largest[i].Validators == largest[j].Validators {
+			return largest[i].Slot < largest[j].Slot
+		}
+
+		return largest[i].Validators > largest[j].Validators
+	})
+
+	if len(largest) > digestIncidents {
+		largest = largest[:digestIncidents]
+	}
+
+	data.Incidents = largest
+	return data
+}
+
+func wantedRecords(records []state.SlashingRecord, prefs state.Preferences) []state.SlashingRecord {
+	/* Returns the records of the incidents a chat wants, see state.Preferences.Wants */
+	indices := make(map[int][]string)
+	for _, record := range records {
+		for _, validator := range record.Validators {
+			indices[record.BroadcastId] = append(indices[record.BroadcastId], validator.Index)
+		}
+	}
+
+	var wanted []state.SlashingRecord
+	for _, record := range records {
+		if prefs.Wants(indices[record.BroadcastId]) {
+			wanted = append(wanted, record)
+		}
+	}
+
+	return wanted
+}
+
+func SendDigest(squeue *queue.SendQueue, conf *config.Config, store *state.Store, mode string) {
+	/* Sends the digest for mode to subscribers using it, covering the time since the last one */
+	until := time.Now().Unix()
+
+	since, err := state.DigestPeriod(store, mode, until, digestPeriods[mode])
+	if err != nil {
+		log.Error().Err(err).Msgf("⚠️ Error starting %s digest", mode)
+		return
+	}
+
+	// Quiet period: nothing to send
+	records := state.HistorySince(store, since, until)
+	if len(records) == 0 {
+		return
+	}
+
+	format := telegramFormat()
+
+	// Chats with the same filters get the same digest: render it once
+	digests := make(map[string]locale.Texts)
+	texts := make(map[int64]string)
+
+	var recipients []int64
+	for _, chatId := range state.SubscribersByDelivery(store, mode) {
+		prefs := state.GetPreferences(store, chatId)
+		filters := fmt.Sprint(prefs.MinValidators, prefs.WatchlistOnly, prefs.Watchlist)
+
+		digest, ok := digests[filters]
+		if !ok {
+			if wanted := wantedRecords(records, prefs); len(wanted) != 0 {
+				data := digestData(wanted, mode)
+				digest = locale.Render(func(lang string) string {
+					data.Language = lang
+					return renderAlert(format, alerts.KindDigest, lang, data).Text
+				})
+			}
+
+			digests[filters] = digest
+		}
+
+		// Nothing the chat wants in this period
+		if digest == nil {
+			continue
+		}
+
+		recipients = append(recipients, chatId)
+		texts[chatId] = digest.For(state.ChatLanguage(store, chatId))
+	}
+
+	if len(recipients) == 0 {
+		return
+	}
+
+	sopts := tb.SendOptions{ParseMode: alerts.ParseMode(format), DisableWebPagePreview: true}
+	broadcastId := queue.NewBroadcast(squeue, conf, store, recipients, sopts)
+
+	for _, chatId := range recipients {
+		message := queue.Message{
+			Type:        "telegram",
+			Recipient:   chatId,
+			Message:     texts[chatId],
+			Sopts:       sopts,
+			BroadcastId: broadcastId,
+		}
+
+		queue.AddToQueue(squeue, &message)
+	}
+
+	log.Debug().Msgf("📰 Queued %s digest #%d to %d chats", mode, broadcastId, len(recipients))
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"slashcaster/state"
+	"testing"
+)
+
+func TestWantedRecords(t *testing.T) {
+	// Broadcast 1 is an incident of 2 validators over 2 slots, broadcast 2 a single slashing
+	records := []state.SlashingRecord{
+		{Slot: 100, BroadcastId: 1, Validators: []state.SlashedValidator{{Index: "1"}}},
+		{Slot: 101, BroadcastId: 1, Validators: []state.SlashedValidator{{Index: "2"}}},
+		{Slot: 200, BroadcastId: 2, Validators: []state.SlashedValidator{{Index: "3"}}},
+	}
+
+	tests := []struct {
+		name     string
+		prefs    state.Preferences
+		expected int
+	}{
+		{"no filters", state.Preferences{}, 3},
+		{"incidents of 2 validators", state.Preferences{MinValidators: 2}, 2},
+		{"watched validator", state.Preferences{MinValidators: 2, Watchlist: []string{"3"}}, 3},
+		{"watchlist only", state.Preferences{WatchlistOnly: true, Watchlist: []string{"3"}}, 1},
+	}
+
+	for _, test := range tests {
+		if wanted := wantedRecords(records, test.prefs); len(wanted) != test.expected {
+			t.Errorf("%s: expected %d records, got %d", test.name, test.expected, len(wanted))
+		}
+	}
+}
@@ -1,58 +1,25 @@
 package api
 
 import (
-	"fmt"
+	"slashcaster/alerts"
 	"slashcaster/config"
 	"slashcaster/queue"
+	"slashcaster/state"
 	"strconv"
 	"time"
 
-	"github.com/dustin/go-humanize"
-	"github.com/dustin/go-humanize/english"
-
 	"github.com/rs/zerolog/log"
 	tb "gopkg.in/telebot.v3"
 )
 
-func slashingString(event SlashingEvent, config *config.Config) string {
-	// Slot to int
-	slotInt, _ := strconv.Atoi(event.Slot)
-	slashCount := english.Plural(len(event.Slashings), "validator", "validators")
-	hSlot := humanize.Comma(int64(slotInt))
-
-	// Beaconcha.in validator and slot URLs
-	bc := "https://beaconcha.in/validator/"
-	bcS := "https://beaconcha.in/block/" + event.Slot
-
-	// Header
-	slashingStr := fmt.Sprintf("🔪 %s slashed in slot [%s](%s)\n", slashCount, hSlot, bcS)
-	slashingStr += "\nValidators slashed\n"
-
-	// Loop over all found slashings, add to slashingStr
-	for _, slashing := range event.Slashings {
-		// Link to the validator's page
-		bcUrl := bc + slashing.ValidatorIndex
-
-		// Assign strings according to att./prop. violation bools
-		if slashing.ProposerViolation && slashing.AttestationViolation {
-			// If slashed due to att. + prop. violation, do a custom string
-			slashingStr += fmt.Sprintf("[%s](%s): attestator & proposer violation\n", slashing.ValidatorIndex, bcUrl)
-		} else {
-			// Otherwise, assign string according to violation
-			if slashing.AttestationViolation {
-				slashingStr += fmt.Sprintf("[%s](%s): attestor violation\n", slashing.ValidatorIndex, bcUrl)
-			} else if slashing.ProposerViolation {
-				slashingStr += fmt.Sprintf("[%s](%s): proposer violation\n", slashing.ValidatorIndex, bcUrl)
-			}
-		}
-	}
-
-	// Footer with time since last slashing before this event
-	since := humanize.RelTime(time.Unix(config.Stats.LastSlashing, 0), time.Now(), "since", "since")
-	footer := "\n" + fmt.Sprintf(`_%s last slashing\._`, since)
-	slashingStr += footer
+func EscapeMarkdown(text string) string {
+	/* Escapes characters reserved in Telegram's MarkdownV2 */
+	return alerts.EscapeMarkdownV2(text)
+}
 
-	return slashingStr
+func RecordString(record state.SlashingRecord, previousSlashing int64, lang string) string {
+	/* Formats a slashing from the event history like its channel broadcast, in MarkdownV2 */
+	return renderSlashing(recordEvent(record, previousSlashing), alerts.FormatMarkdownV2, alerts.KindChannel, lang).Text
 }
 
 func extractAttestionViolations(att AttestationViolation) []Slashing {
@@ -68,12 +35,16 @@ func extractAttestionViolations(att AttestationViolation) []Slashing {
 		}
 	}
 
+	// Both attestations are by the same validators: the offence is in the epoch they vote for
+	epoch, _ := strconv.ParseInt(att.Attestation1.Data.Target.Epoch, 10, 64)
+
 	// Iterate over indices of slashed validators
 	var slashedValidators []Slashing
 	for _, index := range indices {
 		slashing := Slashing{
 			AttestationViolation: true,
 			ValidatorIndex:       index,
+			OffenceEpoch:         epoch,
 		}
 
 		slashedValidators = append(slashedValidators, slashing)
@@ -83,6 +54,9 @@ func extractAttestionViolations(att AttestationViolation) []Slashing {
 }
 
 func extractProposerViolations(prop ProposerViolation, slashed []Slashing) []Slashing {
+	// Both headers are for the same slot: the offence is in its epoch
+	epoch := slotInt(prop.SignedHeader1.Message.Slot) / slotsPerEpoch
+
 	// Index 1
 	index := prop.SignedHeader1.Message.ProposerIndex
 
@@ -98,6 +72,7 @@ func extractProposerViolations(prop ProposerViolation, slashed []Slashing) []Sla
 			ProposerViolation: true,
 			ValidatorIndex:    index,
 			Slot:              prop.SignedHeader1.Message.Slot,
+			OffenceEpoch:      epoch,
 		}
 
 		slashed = append(slashed, validator)
@@ -118,6 +93,7 @@ func extractProposerViolations(prop ProposerViolation, slashed []Slashing) []Sla
 			ProposerViolation: true,
 			ValidatorIndex:    index,
 			Slot:              prop.SignedHeader2.Message.Slot,
+			OffenceEpoch:      epoch,
 		}
 
 		slashed = append(slashed, validator)
@@ -162,8 +138,8 @@ func findSlashings(block BlockData, slot string) SlashingEvent {
 	}
 
 	// Set block correctly for each slashed validator
-	for _, slashing := range slashings {
-		slashing.Slot = block.Block.Message.Slot
+	for i := range slashings {
+		slashings[i].Slot = block.Block.Message.Slot
 	}
 
 	event := SlashingEvent{
@@ -176,23 +152,59 @@ func findSlashings(block BlockData, slot string) SlashingEvent {
 	return event
 }
 
-func broadcastSlashing(squeue *queue.SendQueue, config *config.Config, slashingString string) {
+func interestedSubscribers(store *state.Store, event SlashingEvent) []int64 {
+	// Real-time subscribers that want alerts of the event, see state.Preferences.Wants
+	seen := make(map[string]bool, len(event.Slashings))
+	indices := make([]string, 0, len(event.Slashings))
+
+	for _, slashing := range event.Slashings {
+		if !seen[slashing.ValidatorIndex] {
+			indices = append(indices, slashing.ValidatorIndex)
+			seen[slashing.ValidatorIndex] = true
+		}
+	}
+
+	return state.Interested(store, state.SubscribersByDelivery(store, state.DeliveryRealtime), indices)
+}
+
+func broadcastSlashing(squeue *queue.SendQueue, conf *config.Config, store *state.Store, event SlashingEvent) int {
 	/*
-		Broadcasts the slashing event to all configured channels.
+		Broadcasts the slashing event to all configured channels, each in the
+		chat's language.
 
 		1. Telegram announcement channel
-		2. Discord groups configured
+		2. Discord channel, as an embed
 		3. Telegram subscribers (per-chat)
 	*/
 
+	// Snapshot recipients, register the broadcast for delivery receipts
+	conf.Mutex.Lock()
+	channel := conf.Broadcast.TelegramChannel
+	discordChannel := conf.Broadcast.DiscordChannel
+	conf.Mutex.Unlock()
+
+	// Subscribers on digest delivery get the slashing in their next digest.
+	// Chats filtering it out are added once the incident passes their filters.
+	subscribers := interestedSubscribers(store, event)
+
+	recipients := subscribers
+	if channel != 0 {
+		recipients = append([]int64{channel}, subscribers...)
+	}
+
+	texts := slashingTexts(conf, event)
+	sopts := tb.SendOptions{ParseMode: alerts.ParseMode(telegramFormat()), DisableWebPagePreview: true}
+	broadcastId := queue.NewBroadcast(squeue, conf, store, recipients, sopts)
+
 	// Send to Telegram channel
-	if config.Broadcast.TelegramChannel != 0 {
+	if channel != 0 {
 		// Create message object
 		message := queue.Message{
-			Type:      "telegram",
-			Recipient: config.Broadcast.TelegramChannel,
-			Message:   slashingString,
-			Sopts:     tb.SendOptions{ParseMode: "MarkdownV2", DisableWebPagePreview: true},
+			Type:        "telegram",
+			Recipient:   channel,
+			Message:     texts(channel, state.ChatLanguage(store, channel)),
+			Sopts:       sopts,
+			BroadcastId: broadcastId,
 		}
 
 		// Add to queue -> send
@@ -200,23 +212,38 @@ func broadcastSlashing(squeue *queue.SendQueue, config *config.Config, slashingS
 		log.Debug().Msg("📢 Broadcast slashing to configured channel!")
 	}
 
+	// Send to Discord channel: embeds aren't edited, so they're not part of the broadcast
+	if discordChannel != "" {
+		channelId, _ := strconv.ParseInt(discordChannel, 10, 64)
+		queue.AddToQueue(squeue, &queue.Message{
+			Type:      "discord",
+			Recipient: channelId,
+			Embed:     slashingEmbed(event),
+		})
+
+		log.Debug().Msg("📢 Broadcast slashing to configured Discord channel!")
+	}
+
 	// Sleep a while before starting the mass-send so the channel message sends
 	time.Sleep(time.Second)
 
 	// Loop over Telegram subscribers
-	for _, chatId := range config.Broadcast.TelegramSubscribers {
+	for _, chatId := range subscribers {
 		// Create message object
 		message := queue.Message{
-			Type:      "telegram",
-			Recipient: chatId,
-			Message:   slashingString,
-			Sopts:     tb.SendOptions{ParseMode: "MarkdownV2", DisableWebPagePreview: true},
+			Type:        "telegram",
+			Recipient:   chatId,
+			Message:     texts(chatId, state.ChatLanguage(store, chatId)),
+			Sopts:       sopts,
+			BroadcastId: broadcastId,
 		}
 
 		// Add to queue -> send
 		queue.AddToQueue(squeue, &message)
 	}
 
-	// Log amount of sent broadcasts
-	log.Debug().Msgf("📢 Broadcast slashing to %d chats", len(config.Broadcast.TelegramSubscribers))
+	// Log amount of queued broadcasts
+	log.Debug().Msgf("📢 Queued broadcast #%d to %d chats", broadcastId, len(subscribers))
+
+	return broadcastId
 }
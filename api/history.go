@@ -0,0 +1,240 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"slashcaster/locale"
+	"slashcaster/state"
+	"strings"
+	"time"
+)
+
+// Slashings shown by /last by default and at most, and per page
+const (
+	DefaultLast  = 5
+	MaxLast      = 50
+	LastPageSize = 5
+)
+
+// Periods shown per page of /history
+const HistoryPageSize = 10
+
+// Validators linked per slashing in /last
+const lastValidators = 5
+
+// Granularities of /history, picked by the length of the range
+const (
+	GranularityDay   = "day"
+	GranularityWeek  = "week"
+	GranularityMonth = "month"
+)
+
+// Date format of /history arguments
+const HistoryDateFormat = "2006-01-02"
+
+// Longest range /history covers
+const maxHistoryRange = 10 * 366 * 24 * time.Hour
+
+// Returned for /history ranges that can't be shown
+var ErrInvalidRange = errors.New("invalid date range")
+
+type HistoryPeriod struct {
+	/* Slashings in a single day, week or month */
+	Start         time.Time // Start of the period, UTC
+	Validators    int       // Validators slashed in the period
+	AttSlashings  int       // Attester slashings included in the period
+	PropSlashings int       // Proposer slashings included in the period
+}
+
+func Pages(count int, size int) int {
+	/* Count of pages needed for count items, at least one */
+	if count <= size {
+		return 1
+	}
+
+	return (count + size - 1) / size
+}
+
+func pageBounds(page int, size int, count int) (int, int) {
+	// Index range of items on the page
+	start := page * size
+	if start > count {
+		start = count
+	}
+
+	end := start + size
+	if end > count {
+		end = count
+	}
+
+	return start, end
+}
+
+func LastString(records []state.SlashingRecord, page int, lang string) string {
+	/* Formats a page of the most recent slashings, newest first, in MarkdownV2 */
+	if len(records) == 0 {
+		return EscapeMarkdown(locale.T(lang, "last.empty"))
+	}
+
+	pages := Pages(len(records), LastPageSize)
+	start, end := pageBounds(page, LastPageSize, len(records))
+
+	text := "🔪 *" + EscapeMarkdown(locale.T(lang, "last.title", locale.Plural(lang, len(records), "slashings"))) + "*"
+	if pages > 1 {
+		text += " " + EscapeMarkdown(locale.T(lang, "last.page", locale.Number(lang, int64(page+1)), locale.Number(lang, int64(pages))))
+	}
+
+	for _, record := range records[start:end] {
+		// The slot is a link: escape the message, not the link
+		blockTime := time.Unix(record.Time, 0).UTC().Format(locale.T(lang, "format.time"))
+		slot := fmt.Sprintf("[%s](https://beaconcha.in/block/%d)", EscapeMarkdown(locale.Number(lang, record.Slot)), record.Slot)
+
+		text += "\n\n" + fmt.Sprintf(EscapeMarkdown(locale.T(lang, "last.slot")), slot, EscapeMarkdown(blockTime)) +
+			"\n" + EscapeMarkdown(locale.Plural(lang, len(record.Validators), "validators")) + ": "
+
+		var links []string
+		for i, validator := range record.Validators {
+			if i == lastValidators {
+				break
+			}
+
+			links = append(links, fmt.Sprintf("[%s](https://beaconcha.in/validator/%s)", validator.Index, validator.Index))
+		}
+
+		text += strings.Join(links, ", ")
+		if len(record.Validators) > lastValidators {
+			more := locale.Number(lang, int64(len(record.Validators)-lastValidators))
+			text += " " + EscapeMarkdown(locale.T(lang, "digest.more", more))
+		}
+	}
+
+	return text
+}
+
+func ParseHistoryRange(from string, to string) (time.Time, time.Time, error) {
+	/* Parses the dates of /history: both days are included */
+	start, err := time.Parse(HistoryDateFormat, from)
+	if err != nil {
+		return start, start, ErrInvalidRange
+	}
+
+	end, err := time.Parse(HistoryDateFormat, to)
+	if err != nil || end.Before(start) || end.Sub(start) > maxHistoryRange {
+		return start, end, ErrInvalidRange
+	}
+
+	return start, end, nil
+}
+
+func historyGranularity(start time.Time, end time.Time) string {
+	// Days for up to a month, weeks for up to half a year, months beyond that
+	switch days := end.Sub(start).Hours() / 24; {
+	case days <= 31:
+		return GranularityDay
+	case days <= 183:
+		return GranularityWeek
+	}
+
+	return GranularityMonth
+}
+
+func periodStart(t time.Time, granularity string) time.Time {
+	// Start of the period t falls in: weeks start on Monday
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+
+	switch granularity {
+	case GranularityWeek:
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case GranularityMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	return day
+}
+
+func nextPeriod(t time.Time, granularity string) time.Time {
+	switch granularity {
+	case GranularityWeek:
+		return t.AddDate(0, 0, 7)
+	case GranularityMonth:
+		return t.AddDate(0, 1, 0)
+	}
+
+	return t.AddDate(0, 0, 1)
+}
+
+func SlashingHistory(store *state.Store, start time.Time, end time.Time) ([]HistoryPeriod, string) {
+	/*
+		Counts the slashings from the start of start to the end of end, per day,
+		week or month depending on the length of the range. Every period in the
+		range is returned, oldest first, including periods without slashings.
+	*/
+	granularity := historyGranularity(start, end)
+	until := end.AddDate(0, 0, 1)
+
+	var periods []HistoryPeriod
+	index := make(map[time.Time]int)
+
+	for period := periodStart(start, granularity); period.Before(until); period = nextPeriod(period, granularity) {
+		index[period] = len(periods)
+		periods = append(periods, HistoryPeriod{Start: period})
+	}
+
+	for _, record := range state.HistorySince(store, start.Unix()-1, until.Unix()-1) {
+		period := &periods[index[periodStart(time.Unix(record.Time, 0).UTC(), granularity)]]
+		period.Validators += len(record.Validators)
+		period.AttSlashings += record.AttSlashings
+		period.PropSlashings += record.PropSlashings
+	}
+
+	return periods, granularity
+}
+
+func periodString(period HistoryPeriod, granularity string, lang string) string {
+	// Label of a period, e.g. "Mon 2 Jan 2023", "Week of 2 Jan 2023" or "Jan 2023"
+	switch granularity {
+	case GranularityWeek:
+		return locale.T(lang, "history.week", period.Start.Format(locale.T(lang, "format.date")))
+	case GranularityMonth:
+		return period.Start.Format(locale.T(lang, "format.month"))
+	}
+
+	return period.Start.Format(locale.T(lang, "format.day"))
+}
+
+func HistoryString(periods []HistoryPeriod, granularity string, start time.Time, end time.Time, page int, lang string) string {
+	/* Formats a page of slashing history in MarkdownV2 */
+	var validators, attSlashings, propSlashings int
+	for _, period := range periods {
+		validators += period.Validators
+		attSlashings += period.AttSlashings
+		propSlashings += period.PropSlashings
+	}
+
+	number := func(n int) string {
+		return locale.Number(lang, int64(n))
+	}
+
+	date := locale.T(lang, "format.date")
+	pages := Pages(len(periods), HistoryPageSize)
+
+	text := "📅 *" + EscapeMarkdown(locale.T(lang, "history.title."+granularity)) + "*\n" +
+		EscapeMarkdown(locale.T(lang, "history.range", start.Format(date), end.Format(date),
+			locale.Plural(lang, validators, "validators"), number(attSlashings), number(propSlashings))) + "\n"
+
+	if pages > 1 {
+		text += "_" + EscapeMarkdown(locale.T(lang, "history.page", number(page+1), number(pages))) + "_\n"
+	}
+
+	first, last := pageBounds(page, HistoryPageSize, len(periods))
+	for _, period := range periods[first:last] {
+		line := periodString(period, granularity, lang) + ": " + number(period.Validators)
+		if period.Validators != 0 {
+			line += locale.T(lang, "history.split", number(period.AttSlashings), number(period.PropSlashings))
+		}
+
+		text += "\n" + EscapeMarkdown(line)
+	}
+
+	return text
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"slashcaster/state"
+	"strings"
+	"testing"
+	"time"
+)
+
+func historyStore(t *testing.T) *state.Store {
+	store := &state.Store{}
+	records := []state.SlashingRecord{
+		{Slot: 1, Time: time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC).Unix(), AttSlashings: 1,
+			Validators: []state.SlashedValidator{{Index: "1"}, {Index: "2"}}},
+		{Slot: 2, Time: time.Date(2023, 1, 2, 23, 59, 59, 0, time.UTC).Unix(), PropSlashings: 1,
+			Validators: []state.SlashedValidator{{Index: "3"}}},
+		{Slot: 3, Time: time.Date(2023, 1, 9, 0, 0, 0, 0, time.UTC).Unix(), PropSlashings: 1,
+			Validators: []state.SlashedValidator{{Index: "4"}}, Reorged: true},
+		{Slot: 4, Time: time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC).Unix(), AttSlashings: 1,
+			Validators: []state.SlashedValidator{{Index: "5"}}},
+	}
+
+	for _, record := range records {
+		if err := state.RecordSlashing(store, record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return store
+}
+
+func TestSlashingHistory(t *testing.T) {
+	store := historyStore(t)
+
+	// Short ranges are counted per day, both ends included
+	start, end, err := ParseHistoryRange("2023-01-01", "2023-01-09")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	periods, granularity := SlashingHistory(store, start, end)
+	if granularity != GranularityDay || len(periods) != 9 {
+		t.Fatalf("Expected 9 days, got %d periods per %s", len(periods), granularity)
+	}
+
+	if periods[1].Validators != 3 || periods[1].AttSlashings != 1 || periods[1].PropSlashings != 1 {
+		t.Fatalf("Expected 3 validators slashed on 2 Jan, got %+v", periods[1])
+	}
+
+	// Reorged slashings are left out
+	if periods[8].Validators != 0 {
+		t.Fatalf("Expected reorged slashing to be left out, got %+v", periods[8])
+	}
+
+	// Longer ranges are counted per week, then per month
+	start, end, _ = ParseHistoryRange("2023-01-01", "2023-03-31")
+	if periods, granularity = SlashingHistory(store, start, end); granularity != GranularityWeek || periods[0].Start.Day() != 26 {
+		t.Fatalf("Expected weeks starting on Monday 26 Dec, got %s from %s", granularity, periods[0].Start)
+	}
+
+	start, end, _ = ParseHistoryRange("2023-01-01", "2023-12-31")
+	periods, granularity = SlashingHistory(store, start, end)
+	if granularity != GranularityMonth || len(periods) != 12 || periods[2].Validators != 1 {
+		t.Fatalf("Expected 12 months with a slashing in March, got %d periods per %s", len(periods), granularity)
+	}
+
+	text := HistoryString(periods, granularity, start, end, 1, "en")
+	if !strings.Contains(text, "Page 2/2") || !strings.Contains(text, "Nov 2023: 0") {
+		t.Fatalf("Expected second page of months, got:\n%s", text)
+	}
+
+	text = HistoryString(periods, granularity, start, end, 0, "de")
+	if !strings.Contains(text, "Slashings pro Monat") || !strings.Contains(text, "03/2023: 1 \\(1 Attester, 0 Proposer\\)") {
+		t.Fatalf("Expected German months, got:\n%s", text)
+	}
+
+	if _, _, err = ParseHistoryRange("2023-02-01", "2023-01-01"); err != ErrInvalidRange {
+		t.Fatalf("Expected reversed range to be rejected, got %v", err)
+	}
+}
+
+func TestLastString(t *testing.T) {
+	records := state.LastSlashings(historyStore(t), MaxLast)
+	if len(records) != 3 || records[0].Slot != 4 {
+		t.Fatalf("Expected 3 canonical records, newest first, got %+v", records)
+	}
+
+	text := LastString(records, 0, "en")
+	if !strings.Contains(text, "*Last 3 slashings*") || !strings.Contains(text, "[5](https://beaconcha.in/validator/5)") {
+		t.Fatalf("Expected slashings with links, got:\n%s", text)
+	}
+}
+
+func TestRecordString(t *testing.T) {
+	record := state.SlashingRecord{
+		Slot: 4700000, Time: 1700003600, AttSlashings: 1,
+		Validators: []state.SlashedValidator{{Index: "42", AttestationViolation: true, Penalty: 1e9}},
+	}
+
+	// History records render like the broadcast of the slashing
+	text := RecordString(record, 1700000000, "en")
+	for _, expected := range []string{"slot [4,700,000](https://beaconcha.in/block/4700000)",
+		"[42](https://beaconcha.in/validator/42): attestor violation \\(\\-1\\.00 ETH\\)", "1 hour since last slashing"} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("Expected %q in record string, got:\n%s", expected, text)
+		}
+	}
+
+	// Numbers are formatted and escaped for the chat's language
+	text = RecordString(record, 1700000000, "de")
+	for _, expected := range []string{"Slot [4\\.700\\.000](https://beaconcha.in/block/4700000)",
+		"Attestierungsverstoß \\(\\-1,00 ETH\\)", "1 Stunde seit dem letzten Slashing"} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("Expected %q in German record string, got:\n%s", expected, text)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package api
+
+import (
+	"slashcaster/config"
+	"slashcaster/queue"
+	"slashcaster/state"
+	"strconv"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// Slashings within this many slots of an incident's last slashing may be merged into it
+const incidentWindow = 64
+
+// Slots in an epoch
+const slotsPerEpoch = 32
+
+// Incidents are checked for reorgs once this many slots have passed since their last slot
+const reorgDepth = 64
+
+// Slots at which the initial slashing penalty quotient changed
+const (
+	altairForkSlot    = 74240 * 32
+	bellatrixForkSlot = 144896 * 32
+)
+
+type Incident struct {
+	/* A slashing event that has been broadcast, and may still be edited */
+	BroadcastId int               // Broadcast carrying the incident's messages
+	Event       SlashingEvent     // Merged event of all slots in the incident
+	Roots       map[string]string // Map slot to its block root at detection time
+}
+
+func slotInt(slot string) int64 {
+	slotNum, _ := strconv.ParseInt(slot, 10, 64)
+	return slotNum
+}
+
+func lastSlot(event *SlashingEvent) int64 {
+	if event.LastSlot != "" {
+		return slotInt(event.LastSlot)
+	}
+
+	return slotInt(event.Slot)
+}
+
+func penaltyQuotient(slot int64) uint64 {
+	// MIN_SLASHING_PENALTY_QUOTIENT for the fork active at slot
+	if slot < altairForkSlot {
+		return 128
+	} else if slot < bellatrixForkSlot {
+		return 64
+	}
+
+	return 32
+}
+
+func blockRoot(client *resty.Client, conf *config.Config, slot string) string {
+	// Get the block root at slot, or an empty string if it could not be fetched
+	header, err := getHeader(client, conf, slot)
+
+	if err != nil {
+		log.Warn().Err(err).Msgf("Getting block root at slot=%s failed", slot)
+		return ""
+	}
+
+	return header.Root
+}
+
+func computePenalties(client *resty.Client, conf *config.Config, event *SlashingEvent) bool {
+	/* Fills in initial slashing penalties for the event, returns true if any were added */
+	var ids []string
+	for _, slashing := range event.Slashings {
+		if slashing.Penalty == 0 {
+			ids = append(ids, slashing.ValidatorIndex)
+		}
+	}
+
+	if len(ids) == 0 {
+		return false
+	}
+
+	validators, err := getValidators(client, conf, "head", ids)
+	if err != nil {
+		log.Warn().Err(err).Msgf("Getting validators for slashing penalties failed")
+		return false
+	}
+
+	// Map index to effective balance
+	balances := make(map[string]uint64, len(validators))
+	for _, validator := range validators {
+		balance, _ := strconv.ParseUint(validator.Validator.EffectiveBalance, 10, 64)
+		balances[validator.Index] = balance
+	}
+
+	quotient := penaltyQuotient(slotInt(event.Slot))
+
+	added := false
+	for i, slashing := range event.Slashings {
+		if balance, ok := balances[slashing.ValidatorIndex]; ok && slashing.Penalty == 0 {
+			event.Slashings[i].Penalty = balance / quotient
+			added = true
+		}
+	}
+
+	return added
+}
+
+func mergeEvent(incident *Incident, event SlashingEvent) {
+	/* Merges a later slashing event into the incident */
+	known := make(map[string]bool, len(incident.Event.Slashings))
+	for _, slashing := range incident.Event.Slashings {
+		known[slashing.ValidatorIndex] = true
+	}
+
+	for _, slashing := range event.Slashings {
+		if !known[slashing.ValidatorIndex] {
+			incident.Event.Slashings = append(incident.Event.Slashings, slashing)
+			known[slashing.ValidatorIndex] = true
+		}
+	}
+
+	incident.Event.AttSlashings += event.AttSlashings
+	incident.Event.PropSlashings += event.PropSlashings
+	incident.Event.LastSlot = event.Slot
+}
+
+func historyRecord(incident *Incident, event SlashingEvent) state.SlashingRecord {
+	/* Produces a history record of event, with penalties found for the incident */
+	record := state.SlashingRecord{
+		Slot:          slotInt(event.Slot),
+		Time:          event.Time,
+		BroadcastId:   incident.BroadcastId,
+		AttSlashings:  event.AttSlashings,
+		PropSlashings: event.PropSlashings,
+		Root:          incident.Roots[event.Slot],
+	}
+
+	for _, slashing := range incident.Event.Slashings {
+		if slashing.Slot != event.Slot {
+			continue
+		}
+
+		record.Validators = append(record.Validators, state.SlashedValidator{
+			Index:                slashing.ValidatorIndex,
+			AttestationViolation: slashing.AttestationViolation,
+			ProposerViolation:    slashing.ProposerViolation,
+			Penalty:              slashing.Penalty,
+			OffenceEpoch:         slashing.OffenceEpoch,
+		})
+	}
+
+	return record
+}
+
+func restoreIncidents(store *state.Store, currSlot int64) []*Incident {
+	/*
+		Rebuilds the incidents still open at currSlot from the event history, so
+		they can be continued and checked for reorgs after a restart.
+	*/
+	records, previous := state.IncidentHistory(store, currSlot-reorgDepth+1)
+
+	var incidents []*Incident
+	byBroadcast := make(map[int]*Incident)
+
+	for _, record := range records {
+		event := recordEvent(record, previous)
+		previous = record.Time
+
+		if incident, ok := byBroadcast[record.BroadcastId]; ok {
+			mergeEvent(incident, event)
+			incident.Event.Reorged = incident.Event.Reorged || event.Reorged
+			incident.Roots[event.Slot] = record.Root
+			continue
+		}
+
+		incident := &Incident{
+			BroadcastId: record.BroadcastId,
+			Event:       event,
+			Roots:       map[string]string{event.Slot: record.Root},
+		}
+
+		byBroadcast[record.BroadcastId] = incident
+		incidents = append(incidents, incident)
+	}
+
+	return incidents
+}
+
+func continuesIncident(incident *Incident, event SlashingEvent) bool {
+	/*
+		Does the event belong to the incident? Slashings are included in blocks
+		some time after the offence, so slashings of a single incident, e.g. an
+		operator running its keys twice, arrive over several slots. They share
+		the epoch of the offence: the event continues the incident if it is
+		included within incidentWindow slots of it, and any of its validators
+		committed their offence in an epoch a validator of the incident did.
+		Unrelated slashings included close together stay separate incidents, as
+		do slashings backfilled from before the incident's last slot.
+	*/
+	distance := slotInt(event.Slot) - lastSlot(&incident.Event)
+	if incident.Event.Reorged || distance <= 0 || distance > incidentWindow {
+		return false
+	}
+
+	epochs := make(map[int64]bool, len(incident.Event.Slashings))
+	for _, slashing := range incident.Event.Slashings {
+		epochs[slashing.OffenceEpoch] = true
+	}
+
+	for _, slashing := range event.Slashings {
+		if epochs[slashing.OffenceEpoch] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func recordSlashing(store *state.Store, record state.SlashingRecord) {
+	// Save the slashing in history and statistics
+	if err := state.RecordSlashing(store, record); err != nil {
+		log.Error().Err(err).Msgf("⚠️ Error saving slashing at slot=%d", record.Slot)
+	}
+}
+
+func editIncident(squeue *queue.SendQueue, conf *config.Config, incident *Incident) int {
+	// Edit the incident's broadcast to its current event, returns the count of edits queued
+	edits, err := queue.EditBroadcast(squeue, incident.BroadcastId, slashingTexts(conf, incident.Event))
+	if err != nil {
+		log.Error().Err(err).Msg("⚠️ Error editing incident: its messages keep their outdated text")
+	}
+
+	return edits
+}
+
+func handleSlashingEvent(client *resty.Client, squeue *queue.SendQueue, conf *config.Config, store *state.Store, incidents []*Incident, event SlashingEvent) []*Incident {
+	/*
+		Broadcasts a new slashing event. If the event continues an open
+		incident, the incident's messages are edited instead of sending new ones.
+	*/
+	root := blockRoot(client, conf, event.Slot)
+
+	// Continue the latest incident the event belongs to
+	for i := len(incidents) - 1; i >= 0; i-- {
+		incident := incidents[i]
+
+		if continuesIncident(incident, event) {
+			mergeEvent(incident, event)
+			incident.Roots[event.Slot] = root
+			computePenalties(client, conf, &incident.Event)
+
+			edits := editIncident(squeue, conf, incident)
+
+			// Chats whose filters the incident passes now get it too
+			added := queue.AddRecipients(squeue, store, incident.BroadcastId,
+				interestedSubscribers(store, incident.Event), slashingTexts(conf, incident.Event))
+
+			log.Info().Msgf("[slotStreamer] Merged slot=%s into broadcast #%d: %d edit(s), %d new recipient(s) queued",
+				event.Slot, incident.BroadcastId, edits, added)
+
+			recordSlashing(store, historyRecord(incident, event))
+			return incidents
+		}
+	}
+
+	// New incident: broadcast, then edit once penalties are known
+	incident := &Incident{
+		BroadcastId: broadcastSlashing(squeue, conf, store, event),
+		Event:       event,
+		Roots:       map[string]string{event.Slot: root},
+	}
+
+	if computePenalties(client, conf, &incident.Event) {
+		editIncident(squeue, conf, incident)
+	}
+
+	recordSlashing(store, historyRecord(incident, event))
+	return append(incidents, incident)
+}
+
+func settleIncidents(client *resty.Client, squeue *queue.SendQueue, conf *config.Config, store *state.Store, incidents []*Incident, currSlot int64) []*Incident {
+	/*
+		Checks incidents deep enough in the chain for reorgs. If any slot of an
+		incident is no longer canonical, its messages are edited to say so.
+		Settled incidents are dropped.
+	*/
+	var open []*Incident
+	for _, incident := range incidents {
+		if currSlot-lastSlot(&incident.Event) < reorgDepth {
+			open = append(open, incident)
+			continue
+		}
+
+		for slot, root := range incident.Roots {
+			header, err := getHeader(client, conf, slot)
+
+			if err != nil && err != errNotFound {
+				// Could not verify: keep the incident around, try again next slot
+				log.Warn().Err(err).Msgf("Checking slot=%s for reorgs failed", slot)
+				open = append(open, incident)
+				break
+			}
+
+			if err == errNotFound || !header.Canonical || (root != "" && header.Root != root) {
+				incident.Event.Reorged = true
+				editIncident(squeue, conf, incident)
+				if err := state.MarkReorged(store, slotInt(slot)); err != nil {
+					log.Error().Err(err).Msgf("⚠️ Error marking slot=%s as reorged", slot)
+				}
+
+				log.Warn().Msgf("[slotStreamer] Slot=%s of broadcast #%d was reorged out", slot, incident.BroadcastId)
+				break
+			}
+		}
+	}
+
+	return open
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"slashcaster/state"
+	"testing"
+)
+
+func TestContinuesIncident(t *testing.T) {
+	incident := &Incident{Event: SlashingEvent{
+		Slot:      "3200",
+		Slashings: []Slashing{{ValidatorIndex: "1", AttestationViolation: true, OffenceEpoch: 99}},
+	}}
+
+	event := func(slot string, epoch int64) SlashingEvent {
+		return SlashingEvent{Slot: slot, Slashings: []Slashing{{ValidatorIndex: "2", AttestationViolation: true, OffenceEpoch: epoch}}}
+	}
+
+	tests := []struct {
+		name     string
+		event    SlashingEvent
+		expected bool
+	}{
+		{"same offence epoch", event("3210", 99), true},
+		{"unrelated offence in the next slot", event("3201", 57), false},
+		{"same offence epoch, too late", event("3265", 99), false},
+		{"backfilled before the incident", event("3190", 99), false},
+	}
+
+	for _, test := range tests {
+		if continues := continuesIncident(incident, test.event); continues != test.expected {
+			t.Errorf("%s: expected continues=%v, got %v", test.name, test.expected, continues)
+		}
+	}
+
+	// The window counts from the incident's last slot
+	mergeEvent(incident, event("3250", 99))
+	if !continuesIncident(incident, event("3300", 99)) {
+		t.Errorf("Expected the window to extend with merged slots")
+	}
+
+	// Reorged incidents are not continued
+	incident.Event.Reorged = true
+	if continuesIncident(incident, event("3251", 99)) {
+		t.Errorf("Expected a reorged incident not to be continued")
+	}
+}
+
+func TestRestoreIncidents(t *testing.T) {
+	store := &state.Store{}
+	store.State.History = []state.SlashingRecord{
+		{Slot: 100, Time: 1000, BroadcastId: 1, AttSlashings: 1, Validators: []state.SlashedValidator{{Index: "1"}}},
+		{Slot: 3000, Time: 2000, BroadcastId: 2, AttSlashings: 1, Root: "0xa",
+			Validators: []state.SlashedValidator{{Index: "2", AttestationViolation: true, OffenceEpoch: 90}}},
+		{Slot: 3005, Time: 2060, BroadcastId: 3, PropSlashings: 1, Reorged: true,
+			Validators: []state.SlashedValidator{{Index: "3", ProposerViolation: true, OffenceEpoch: 93}}},
+		{Slot: 3010, Time: 2120, BroadcastId: 2, AttSlashings: 1, Root: "0xb",
+			Validators: []state.SlashedValidator{{Index: "4", AttestationViolation: true, OffenceEpoch: 90}}},
+	}
+
+	// The incident of slot 100 has settled
+	incidents := restoreIncidents(store, 3050)
+	if len(incidents) != 2 {
+		t.Fatalf("Expected 2 open incidents, got %d", len(incidents))
+	}
+
+	incident := incidents[0]
+	if incident.BroadcastId != 2 || incident.Event.Slot != "3000" || incident.Event.LastSlot != "3010" ||
+		len(incident.Event.Slashings) != 2 || incident.Event.AttSlashings != 2 || incident.Event.PreviousSlashing != 1000 {
+		t.Errorf("Expected broadcast #2 to span slots 3000 to 3010, got %+v", incident.Event)
+	}
+
+	if incident.Roots["3000"] != "0xa" || incident.Roots["3010"] != "0xb" {
+		t.Errorf("Expected block roots to be restored, got %v", incident.Roots)
+	}
+
+	if incidents[1].BroadcastId != 3 || !incidents[1].Event.Reorged {
+		t.Errorf("Expected broadcast #3 to be restored as reorged, got %+v", incidents[1])
+	}
+
+	// Restored incidents are continued
+	event := SlashingEvent{Slot: "3020", Slashings: []Slashing{{ValidatorIndex: "5", OffenceEpoch: 90}}}
+	if !continuesIncident(incident, event) {
+		t.Errorf("Expected a restored incident to be continued")
+	}
+}
@@ -1,30 +1,26 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"slashcaster/config"
 	"slashcaster/queue"
+	"slashcaster/state"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/rs/zerolog/log"
 )
 
-func bumpStats(conf *config.Config, currSlot int64, blockTime int64) {
-	conf.Mutex.Lock()
-	conf.Stats.BlocksParsed++
-	conf.Stats.CurrentSlot = currSlot
-	conf.Stats.BlockTime = blockTime
-	conf.Mutex.Unlock()
-}
-
 func doGetRequest(client *resty.Client, url string) (BlockData, error) {
 	// Perform GET-requests
 	resp, err := client.R().Get(url)
+	err = config.RedactError(err)
 
 	// Block
 	var block BlockData
@@ -45,12 +41,59 @@ func doGetRequest(client *resty.Client, url string) (BlockData, error) {
 	return block, err
 }
 
-func getHead(client *resty.Client, config *config.Config) (string, error) {
+// Returned when the beacon node has no data for the request, e.g. an empty slot
+var errNotFound = errors.New("not found")
+
+func getJson(client *resty.Client, url string, target interface{}) error {
+	// Perform a GET-request, unmarshal the response into target
+	resp, err := client.R().Get(url)
+	err = config.RedactError(err)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error performing GET request")
+		return err
+	}
+
+	if resp.StatusCode() == 404 {
+		return errNotFound
+	}
+
+	if resp.IsError() {
+		return fmt.Errorf("request failed with status code = %d", resp.StatusCode())
+	}
+
+	return json.Unmarshal(resp.Body(), target)
+}
+
+func getHeader(client *resty.Client, conf *config.Config, slot string) (Header, error) {
+	// Get the block header at slot, for block roots and canonical-status
+	url := fmt.Sprintf("%s/eth/v1/beacon/headers/%s", config.Endpoint(conf), slot)
+
+	var headerData HeaderData
+	err := getJson(client, url, &headerData)
+
+	return headerData.Header, err
+}
+
+func getValidators(client *resty.Client, conf *config.Config, state string, ids []string) ([]ValidatorData, error) {
+	// Get validators by index or pubkey from the given state
+	url := fmt.Sprintf("%s/eth/v1/beacon/states/%s/validators?id=%s",
+		config.Endpoint(conf), state, strings.Join(ids, ","),
+	)
+
+	var validatorsData ValidatorsData
+	err := getJson(client, url, &validatorsData)
+
+	return validatorsData.Validators, err
+}
+
+func getHead(client *resty.Client, conf *config.Config) (string, error) {
 	// Endpoint
-	url := fmt.Sprintf("%s/eth/v1/node/syncing", config.Tokens.Infura)
+	url := fmt.Sprintf("%s/eth/v1/node/syncing", config.Endpoint(conf))
 
 	// Perform GET-requests
 	resp, err := client.R().Get(url)
+	err = config.RedactError(err)
 
 	if resp.IsError() {
 		err = errors.New(fmt.Sprintf("Request failed with status code = %d", resp.StatusCode()))
@@ -78,7 +121,25 @@ func getHead(client *resty.Client, config *config.Config) (string, error) {
 	return headData.HeadData.HeadSlot, nil
 }
 
-func getSlot(client *resty.Client, config *config.Config, slot string) (BlockData, error) {
+func CheckEndpoint(conf *config.Config) (string, error) {
+	/* Verifies the beacon endpoint is reachable, returns the head slot */
+	client := resty.New()
+	client.SetTimeout(15 * time.Second)
+
+	return getHead(client, conf)
+}
+
+func sleepContext(ctx context.Context, duration time.Duration) bool {
+	// Sleep for duration, returns false if ctx was cancelled before that
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(duration):
+		return true
+	}
+}
+
+func getSlot(ctx context.Context, client *resty.Client, conf *config.Config, slot string) (BlockData, error) {
 	// If slot is pre-Altair, use eth/v1 endpoint
 	altairSlot := 74240 * 32
 	currSlot, _ := strconv.Atoi(slot)
@@ -90,23 +151,31 @@ func getSlot(client *resty.Client, config *config.Config, slot string) (BlockDat
 		blockEndpoint = "eth/v1/beacon/blocks"
 	}
 
-	// Get block at slot
-	slotUrl := fmt.Sprintf("%s/%s/%s", config.Tokens.Infura, blockEndpoint, slot)
-	block, err := doGetRequest(client, slotUrl)
+	// Get block at slot, retrying until it succeeds or ctx is cancelled
+	slotUrl := fmt.Sprintf("%s/%s/%s", config.Endpoint(conf), blockEndpoint, slot)
 
-	if err != nil {
-		log.Warn().Msgf("Getting slot=%s failed: sleeping for 60 seconds...", slot)
-		time.Sleep(time.Second * 60)
+	for {
+		block, err := doGetRequest(client, slotUrl)
 
-		return getSlot(client, config, slot)
-	}
+		if err == nil {
+			return block, nil
+		}
 
-	return block, err
+		log.Warn().Msgf("Getting slot=%s failed: sleeping for 60 seconds...", slot)
+		if !sleepContext(ctx, time.Second*60) {
+			return block, ctx.Err()
+		}
+	}
 }
 
-func SlotStreamer(squeue *queue.SendQueue, conf *config.Config) {
-	// HTTP client
-	client := resty.New()
+func SlotStreamer(ctx context.Context, squeue *queue.SendQueue, conf *config.Config, store *state.Store, streamer *Streamer) {
+	/*
+		Streams slots from the beacon chain until ctx is cancelled. A slot being
+		processed is always finished before returning. Streaming can be paused
+		and moved to another slot through streamer.
+	*/
+	// HTTP client, shared with bot commands
+	client := streamer.Beacon.client
 
 	// Get chain head
 	headSlot, err := getHead(client, conf)
@@ -121,13 +190,14 @@ func SlotStreamer(squeue *queue.SendQueue, conf *config.Config) {
 	currSlot, _ := strconv.ParseInt(headSlot, 10, 64)
 
 	// Check how far behind we are
-	if conf.Stats.CurrentSlot != 0 {
-		delta := currSlot - conf.Stats.CurrentSlot
+	cursor := state.GetStats(store).CurrentSlot
+	if cursor != 0 {
+		delta := currSlot - cursor
 
 		if delta > 0 {
-			currSlot = conf.Stats.CurrentSlot + 1
+			currSlot = cursor + 1
 			log.Debug().Msgf("[slotStreamer] %d slot(s) behind: starting sync from slot=%d",
-				delta, conf.Stats.CurrentSlot)
+				delta, cursor)
 		}
 	}
 
@@ -139,8 +209,26 @@ func SlotStreamer(squeue *queue.SendQueue, conf *config.Config) {
 	slotSinceAltair := currSlot - altairSlot
 	nextBlockTime := altairStart + slotSinceAltair*12
 
+	// Recently broadcast incidents, kept for edits
+	incidents := restoreIncidents(store, currSlot)
+	if len(incidents) > 0 {
+		log.Info().Msgf("[slotStreamer] Restored %d open incident(s)", len(incidents))
+	}
+
 	// Start streaming from headSlot
-	for {
+	for ctx.Err() == nil {
+		// Move the cursor if requested, wait while paused
+		if slot, ok := streamer.takeResync(); ok {
+			log.Info().Msgf("[slotStreamer] Resyncing from slot=%d", slot)
+			currSlot = slot
+			nextBlockTime = altairStart + (currSlot-altairSlot)*12
+		}
+
+		if streamer.Paused() {
+			sleepContext(ctx, time.Second)
+			continue
+		}
+
 		if conf.Debug {
 			log.Debug().Msgf("Streaming slot %d", currSlot)
 		}
@@ -152,13 +240,17 @@ func SlotStreamer(squeue *queue.SendQueue, conf *config.Config) {
 		slot := strconv.FormatInt(int64(currSlot), 10)
 
 		// Get block
-		block, err := getSlot(client, conf, slot)
+		block, err := getSlot(ctx, client, conf, slot)
 
 		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+
 			log.Error().Err(err).Msgf("Error getting block %s", slot)
 
 			// If we error out due to e.g. network conditions, sleep and retry
-			time.Sleep(time.Second * time.Duration(60))
+			sleepContext(ctx, time.Second*time.Duration(60))
 			continue
 		}
 
@@ -169,18 +261,25 @@ func SlotStreamer(squeue *queue.SendQueue, conf *config.Config) {
 		// Parse block for slashings
 		foundSlashings := findSlashings(block, slot)
 
-		if len(foundSlashings.Slashings) > 0 {
+		if len(foundSlashings.Slashings) > 0 && state.SlashingRecorded(store, currSlot) {
+			// Streamed again, e.g. when backfilling with a resync: don't broadcast it again
+			log.Info().Msgf("[slotStreamer] Slashing(s) in slot=%s already recorded: skipping", slot)
+		} else if len(foundSlashings.Slashings) > 0 {
 			// Log slashing event
 			log.Info().Msgf("[slotStreamer] Found %d slashing(s) in slot=%s", len(foundSlashings.Slashings), slot)
 
-			// Produce a message from found slashings
-			slashStr := slashingString(foundSlashings, conf)
+			// Timestamps for the message
+			foundSlashings.PreviousSlashing = state.GetStats(store).LastSlashing
+			foundSlashings.Time = currentBlockTime
 
-			// Broadcast the slashing
-			broadcastSlashing(squeue, conf, slashStr)
+			// Broadcast the slashing, or edit an earlier broadcast of the same incident.
+			// Saves the slashing in history and statistics.
+			incidents = handleSlashingEvent(client, squeue, conf, store, incidents, foundSlashings)
+		}
 
-			// Save slashing in statistics
-			config.SlashingObserved(conf, foundSlashings.AttSlashings, foundSlashings.PropSlashings, currentBlockTime)
+		// Check broadcast incidents for reorgs
+		if len(incidents) > 0 {
+			incidents = settleIncidents(client, squeue, conf, store, incidents, currSlot)
 		}
 
 		// Calculate when next slot arrives
@@ -194,15 +293,15 @@ func SlotStreamer(squeue *queue.SendQueue, conf *config.Config) {
 			log.Debug().Msgf("↳ Next slot in %d seconds", nextBlockIn)
 		}
 
-		// Set stats in goroutine
-		go bumpStats(conf, currSlot, currentBlockTime)
+		// Set stats: the slot is done
+		state.SlotProcessed(store, currSlot, currentBlockTime)
 
 		if nextBlockIn >= 0 {
 			// Sleep until next block, add 3 seconds for some propagation time
-			time.Sleep(time.Second * time.Duration(nextBlockIn+3))
+			sleepContext(ctx, time.Second*time.Duration(nextBlockIn+3))
 		} else {
 			// Sleep >200 ms (Infura's rate-limit)
-			time.Sleep(time.Millisecond * time.Duration(300))
+			sleepContext(ctx, time.Millisecond*time.Duration(300))
 		}
 
 		// Loop over to the next slot if no errors during request
@@ -211,4 +310,6 @@ func SlotStreamer(squeue *queue.SendQueue, conf *config.Config) {
 			currSlot++
 		}
 	}
+
+	log.Info().Msgf("[slotStreamer] Stopped at slot=%d", currSlot)
 }
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"net/url"
+	"slashcaster/config"
+	"slashcaster/locale"
+	"slashcaster/queue"
+	"slashcaster/state"
+	"strconv"
+	"time"
+)
+
+// Markup of reports rendered for both bots
+const (
+	MarkupTelegram = "telegram" // Telegram's legacy Markdown
+	MarkupDiscord  = "discord"  // Discord's Markdown
+)
+
+// Periods /stats counts recent slashings over
+var recentPeriods = []struct {
+	count  int
+	unit   string
+	length time.Duration
+}{
+	{24, "unit.hour", time.Hour},
+	{7, "unit.day", 24 * time.Hour},
+	{30, "unit.day", 24 * time.Hour},
+}
+
+type RecentSlashings struct {
+	/* Validators slashed over a recent period, e.g. 24 hours */
+	Count      int    // Length of the period, in units
+	Unit       string // Locale key of the unit, e.g. "unit.hour"
+	Validators int    // Validators slashed in the period
+}
+
+type StatsReport struct {
+	/* Everything shown by /stats, collected at Time */
+	Stats       state.Stats       // Copy of the statistics
+	Recent      []RecentSlashings // Slashings over recent periods
+	HeadSlot    int64             // Head slot of the beacon node, 0 if unknown
+	Endpoint    string            // Host of the beacon endpoint in use
+	QueueDepth  int               // Messages waiting in the send queue
+	Subscribers int               // Count of Telegram subscribers
+	Time        int64             // Unix timestamp of collection
+}
+
+func endpointHost(endpoint string) string {
+	// Endpoint URLs often contain an API key: only show the host
+	parsed, err := url.Parse(endpoint)
+	if err != nil || parsed.Host == "" {
+		return "unknown"
+	}
+
+	return parsed.Host
+}
+
+func CollectStats(beacon *BeaconClient, store *state.Store, squeue *queue.SendQueue) StatsReport {
+	/* Collects statistics from the state store, the send queue and the beacon node */
+	now := time.Now()
+	report := StatsReport{
+		Stats:       state.GetStats(store),
+		Endpoint:    endpointHost(config.Endpoint(beacon.conf)),
+		QueueDepth:  queue.QueueLength(squeue),
+		Subscribers: len(state.Subscribers(store)),
+		Time:        now.Unix(),
+	}
+
+	for _, recent := range recentPeriods {
+		slashings := RecentSlashings{Count: recent.count, Unit: recent.unit}
+		period := time.Duration(recent.count) * recent.length
+
+		for _, record := range state.HistorySince(store, now.Add(-period).Unix(), now.Unix()) {
+			slashings.Validators += len(record.Validators)
+		}
+
+		report.Recent = append(report.Recent, slashings)
+	}
+
+	if head, err := beacon.Head(); err == nil {
+		report.HeadSlot, _ = strconv.ParseInt(head, 10, 64)
+	}
+
+	return report
+}
+
+func agoString(seconds int64, lang string) string {
+	// Format a duration in seconds, e.g. "3 days 4 hours"
+	return locale.DurationUnits(lang, time.Duration(seconds)*time.Second, 2)
+}
+
+func StatsString(report StatsReport, markup string, lang string) string {
+	/* Formats a statistics report, identically for Telegram and Discord save for markup */
+	bold, italic := "*", "_"
+	if markup == MarkupDiscord {
+		bold = "**"
+	}
+
+	heading := func(key string) string {
+		return bold + locale.T(lang, key) + bold + "\n"
+	}
+
+	number := func(n int64) string {
+		return locale.Number(lang, n)
+	}
+
+	stats := report.Stats
+	text := "🔪 " + heading("stats.title") + "\n"
+
+	// Slashings
+	text += heading("stats.slashings") +
+		locale.T(lang, "stats.attester", number(int64(stats.AttSlashings))) + "\n" +
+		locale.T(lang, "stats.proposer", number(int64(stats.PropSlashings))) + "\n"
+
+	if stats.LastSlashing != 0 {
+		text += locale.T(lang, "stats.last", agoString(report.Time-stats.LastSlashing, lang)) + "\n"
+	} else {
+		text += locale.T(lang, "stats.none") + "\n"
+	}
+
+	for _, recent := range report.Recent {
+		text += locale.T(lang, "stats.recent", locale.Plural(lang, recent.Count, recent.Unit), number(int64(recent.Validators))) + "\n"
+	}
+
+	// Sync health
+	text += "\n" + heading("stats.sync") + locale.T(lang, "stats.slot", number(stats.CurrentSlot))
+
+	switch behind := report.HeadSlot - stats.CurrentSlot; {
+	case report.HeadSlot == 0:
+		text += locale.T(lang, "stats.head.unknown") + "\n"
+	case behind <= 1:
+		text += locale.T(lang, "stats.head.synced") + "\n"
+	default:
+		text += locale.T(lang, "stats.head.behind", number(behind)) + "\n"
+	}
+
+	text += locale.T(lang, "stats.blocks", number(int64(stats.BlocksParsed))) + "\n" +
+		locale.T(lang, "stats.block", agoString(report.Time-stats.BlockTime, lang)) + "\n" +
+		locale.T(lang, "stats.endpoint", report.Endpoint) + "\n"
+
+	// Delivery
+	text += "\n" + heading("stats.delivery") +
+		locale.T(lang, "stats.subscribers", number(int64(report.Subscribers))) + "\n" +
+		locale.T(lang, "stats.queued", number(int64(report.QueueDepth))) + "\n" +
+		locale.T(lang, "stats.sent", number(int64(stats.MessagesSent))) + "\n\n"
+
+	text += italic + locale.T(lang, "stats.started", agoString(report.Time-stats.StartTime, lang)) + italic
+	return text
+}
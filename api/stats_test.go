@@ -0,0 +1,50 @@
+package api
+
+import (
+	"slashcaster/state"
+	"strings"
+	"testing"
+)
+
+func TestStatsString(t *testing.T) {
+	report := StatsReport{
+		Stats: state.Stats{
+			StartTime:     1000,
+			CurrentSlot:   4990,
+			BlockTime:     4988,
+			AttSlashings:  1234,
+			PropSlashings: 5,
+			LastSlashing:  1400,
+		},
+		Recent:   []RecentSlashings{{24, "unit.hour", 0}, {7, "unit.day", 3}},
+		HeadSlot: 5000,
+		Endpoint: endpointHost("https://mainnet.infura.io/v3/secret-key"),
+		Time:     5000,
+	}
+
+	telegram := StatsString(report, MarkupTelegram, "en")
+	for _, expected := range []string{"*Slashings*", "Attester slashings: 1,234", "Last slashing 1 hour ago",
+		"last 7 days: 3", "4,990 (10 slots behind head)", "`mainnet.infura.io`", "_Bot started 1 hour 6 minutes ago_"} {
+		if !strings.Contains(telegram, expected) {
+			t.Errorf("Expected %q in stats, got:\n%s", expected, telegram)
+		}
+	}
+
+	if strings.Contains(telegram, "secret-key") {
+		t.Errorf("Expected endpoint path to be left out, got:\n%s", telegram)
+	}
+
+	// Both bots get the same report, with their own markup
+	discord := StatsString(report, MarkupDiscord, "en")
+	if strings.ReplaceAll(discord, "**", "*") != telegram {
+		t.Errorf("Expected Discord stats to only differ in markup, got:\n%s", discord)
+	}
+
+	// Numbers and durations follow the chat's language
+	german := StatsString(report, MarkupTelegram, "de")
+	for _, expected := range []string{"Attester-Slashings: 1.234", "Letztes Slashing vor 1 Stunde", "letzten 7 Tage: 3"} {
+		if !strings.Contains(german, expected) {
+			t.Errorf("Expected %q in German stats, got:\n%s", expected, german)
+		}
+	}
+}
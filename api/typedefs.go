@@ -6,14 +6,20 @@ type Slashing struct {
 	ProposerViolation    bool
 	ValidatorIndex       string
 	Slot                 string
+	Penalty              uint64 // Initial slashing penalty in gwei, 0 if not yet known
+	OffenceEpoch         int64  // Epoch of the offence: the target epoch of the votes, or the epoch of the proposals
 }
 
 // Internal typedef
 type SlashingEvent struct {
-	Slashings     []Slashing
-	AttSlashings  int
-	PropSlashings int
-	Slot          string
+	Slashings        []Slashing
+	AttSlashings     int
+	PropSlashings    int
+	Slot             string
+	LastSlot         string // Last slot of a multi-slot incident, empty if single-slot
+	Time             int64  // Block time of the first slot
+	PreviousSlashing int64  // Time of the last slashing before this event
+	Reorged          bool   // Was the event reorged out of the canonical chain?
 }
 
 // Infura's data is unpacked here
@@ -59,7 +65,18 @@ type SignedBlockHeader struct {
 
 // A single attestation
 type Attestation struct {
-	AttestingIndices []string `json:"attesting_indices"`
+	AttestingIndices []string        `json:"attesting_indices"`
+	Data             AttestationData `json:"data"`
+}
+
+// What an attestation votes for
+type AttestationData struct {
+	Target Checkpoint `json:"target"`
+}
+
+// An epoch boundary checkpoint
+type Checkpoint struct {
+	Epoch string `json:"epoch"`
 }
 
 // Message within a block header
@@ -78,3 +95,32 @@ type ChainHead struct {
 	SyncDist  string `json:"sync_distance"`
 	IsSyncing bool   `json:"is_syncing"`
 }
+
+// For getting a block header
+type HeaderData struct {
+	Header Header `json:"data"`
+}
+type Header struct {
+	// https://ethereum.github.io/beacon-APIs/#/Beacon/getBlockHeader
+	Root      string `json:"root"`
+	Canonical bool   `json:"canonical"`
+}
+
+// For getting validators from a state
+type ValidatorsData struct {
+	Validators []ValidatorData `json:"data"`
+}
+type ValidatorData struct {
+	// https://ethereum.github.io/beacon-APIs/#/Beacon/getStateValidators
+	Index     string    `json:"index"`
+	Balance   string    `json:"balance"`
+	Status    string    `json:"status"`
+	Validator Validator `json:"validator"`
+}
+type Validator struct {
+	Pubkey            string `json:"pubkey"`
+	EffectiveBalance  string `json:"effective_balance"`
+	Slashed           bool   `json:"slashed"`
+	ExitEpoch         string `json:"exit_epoch"`
+	WithdrawableEpoch string `json:"withdrawable_epoch"`
+}
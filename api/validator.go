@@ -0,0 +1,119 @@
+package api
+
+import (
+	"errors"
+	"regexp"
+	"slashcaster/locale"
+	"slashcaster/state"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Mainnet genesis time, and length of an epoch in seconds
+const (
+	genesisTime  = int64(1606824023)
+	epochSeconds = int64(32 * 12)
+)
+
+// Epoch of validators that are not exiting, 2^64-1
+const farFutureEpoch = "18446744073709551615"
+
+// A validator index, or a 48-byte BLS pubkey
+var validatorId = regexp.MustCompile(`^([0-9]{1,10}|0x[0-9a-fA-F]{96})$`)
+
+// Returned for lookups of invalid validator IDs
+var ErrInvalidValidator = errors.New("not a validator index or pubkey")
+
+// Returned for lookups of validators the beacon node doesn't know
+var ErrUnknownValidator = errors.New("validator not found")
+
+type ValidatorReport struct {
+	/* A validator's status, and its slashings recorded in the event history */
+	Validator ValidatorData          // Validator as returned by the beacon node
+	History   []state.SlashingRecord // Records the validator was slashed in
+}
+
+func LookupValidator(beacon *BeaconClient, store *state.Store, id string) (ValidatorReport, error) {
+	/* Looks up a validator by index or pubkey at the chain head */
+	id = strings.ToLower(strings.TrimSpace(id))
+	if !validatorId.MatchString(id) {
+		return ValidatorReport{}, ErrInvalidValidator
+	}
+
+	validator, err := beacon.Validator(id)
+	if errors.Is(err, errNotFound) {
+		return ValidatorReport{}, ErrUnknownValidator
+	} else if err != nil {
+		return ValidatorReport{}, err
+	}
+
+	return ValidatorReport{Validator: validator, History: state.ValidatorHistory(store, validator.Index)}, nil
+}
+
+func epochTime(epoch int64) int64 {
+	// Unix timestamp of the first slot of epoch
+	return genesisTime + epoch*epochSeconds
+}
+
+func gweiString(gwei string, lang string) string {
+	// Format a balance in gwei in ETH, without the unit
+	value, _ := strconv.ParseUint(gwei, 10, 64)
+	return locale.Decimal(lang, float64(value)/1e9, 4)
+}
+
+func ValidatorString(report ValidatorReport, now int64, lang string) string {
+	/* Formats a validator report as plain text, shared by the Telegram and Discord bots */
+	validator := report.Validator
+	index, _ := strconv.ParseInt(validator.Index, 10, 64)
+
+	text := locale.T(lang, "validator.title", locale.Number(lang, index)) + "\n" +
+		locale.T(lang, "validator.status", validator.Status) + "\n" +
+		locale.T(lang, "validator.balance", gweiString(validator.Balance, lang)) + "\n"
+
+	if !validator.Validator.Slashed {
+		text += locale.T(lang, "validator.unslashed")
+	} else {
+		text += locale.T(lang, "validator.slashed")
+
+		// Slashed validators are withdrawable after a fixed delay
+		if validator.Validator.WithdrawableEpoch != "" && validator.Validator.WithdrawableEpoch != farFutureEpoch {
+			epoch, _ := strconv.ParseInt(validator.Validator.WithdrawableEpoch, 10, 64)
+			withdrawable := epochTime(epoch)
+			text += "\n" + locale.T(lang, "validator.withdrawable", locale.Number(lang, epoch))
+
+			if withdrawable > now {
+				eta := locale.DurationUnits(lang, time.Duration(withdrawable-now)*time.Second, 2)
+				text += locale.T(lang, "validator.eta", eta)
+			} else {
+				text += locale.T(lang, "validator.reached")
+			}
+		}
+	}
+
+	if len(report.History) != 0 {
+		text += "\n\n" + locale.T(lang, "validator.history")
+
+		for _, record := range report.History {
+			var reasons []string
+			for _, slashed := range record.Validators {
+				if slashed.Index != validator.Index {
+					continue
+				}
+
+				if slashed.AttestationViolation {
+					reasons = append(reasons, locale.T(lang, "validator.attester"))
+				}
+
+				if slashed.ProposerViolation {
+					reasons = append(reasons, locale.T(lang, "validator.proposer"))
+				}
+			}
+
+			day := time.Unix(record.Time, 0).UTC().Format(locale.T(lang, "format.date"))
+			text += "\n" + locale.T(lang, "validator.record", locale.Number(lang, record.Slot), day, strings.Join(reasons, ", "))
+		}
+	}
+
+	return text
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"slashcaster/state"
+	"strings"
+	"testing"
+)
+
+func TestValidatorString(t *testing.T) {
+	report := ValidatorReport{
+		Validator: ValidatorData{
+			Index:   "12345",
+			Balance: "31000000000",
+			Status:  "active_slashed",
+			Validator: Validator{
+				Slashed:           true,
+				WithdrawableEpoch: "100",
+			},
+		},
+		History: []state.SlashingRecord{{
+			Slot:       3200,
+			Time:       genesisTime + 3200*12,
+			Validators: []state.SlashedValidator{{Index: "12345", AttestationViolation: true}},
+		}},
+	}
+
+	// Epoch 100 is 10 epochs after epoch 90
+	text := ValidatorString(report, epochTime(90), "en")
+
+	for _, expected := range []string{"Validator 12,345", "31.0000 ETH", "Slashed: yes", "epoch 100 (in 1 hour 4 minutes)",
+		"Slot 3,200, 1 Dec 2020: attestation violation"} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("Expected %q in validator string, got:\n%s", expected, text)
+		}
+	}
+
+	text = ValidatorString(report, epochTime(90), "de")
+	for _, expected := range []string{"31,0000 ETH", "Geslasht: ja", "Epoche 100 (in 1 Stunde 4 Minuten)", "Slot 3.200, 1.12.2020"} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("Expected %q in German validator string, got:\n%s", expected, text)
+		}
+	}
+
+	// Invalid IDs are rejected before querying the beacon node
+	if _, err := LookupValidator(nil, nil, "0x1234"); err != ErrInvalidValidator {
+		t.Errorf("Expected invalid pubkey to be rejected, got %v", err)
+	}
+}
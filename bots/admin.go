@@ -0,0 +1,263 @@
+package bots
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slashcaster/api"
+	"slashcaster/config"
+	"slashcaster/locale"
+	"slashcaster/queue"
+	"slashcaster/state"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	tb "gopkg.in/telebot.v3"
+)
+
+// Owner commands are audit-logged to this file in the log folder
+const auditFile = "audit.log"
+
+// Dead letters shown by /dlq by default, and at most
+const (
+	defaultDeadLetters = 10
+	maxDeadLetters     = 50
+)
+
+type auditEntry struct {
+	/* An audit log entry for an owner command */
+	Time    int64  // Unix timestamp of the command
+	User    int64  // User who sent the command
+	Chat    int64  // Chat the command was sent in
+	Command string // The command, e.g. "/ban"
+	Payload string // The command's arguments
+	Result  string // The reply sent to the owner
+}
+
+// Mutex to avoid interleaved writes to the audit log
+var auditMutex sync.Mutex
+
+func audit(session *config.Session, message *tb.Message, command string, result string) {
+	// Record an owner command in the main log and in the audit log
+	entry := auditEntry{
+		Time:    message.Unixtime,
+		User:    senderId(message),
+		Chat:    message.Chat.ID,
+		Command: command,
+		Payload: message.Payload,
+		Result:  result,
+	}
+
+	log.Info().Msgf("🛂 [audit] user=%d chat=%d command=%s payload=%q", entry.User, entry.Chat, entry.Command, entry.Payload)
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Error().Err(err).Msg("⚠️ Error encoding audit log entry")
+		return
+	}
+
+	session.Config.Mutex.Lock()
+	logPath := session.Config.LogPath
+	session.Config.Mutex.Unlock()
+
+	auditMutex.Lock()
+	defer auditMutex.Unlock()
+
+	if err = os.MkdirAll(logPath, os.ModePerm); err != nil {
+		log.Error().Err(err).Msg("⚠️ Error writing audit log")
+		return
+	}
+
+	file, err := os.OpenFile(filepath.Join(logPath, auditFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		log.Error().Err(err).Msg("⚠️ Error writing audit log")
+		return
+	}
+
+	defer file.Close()
+
+	if _, err = file.Write(append(line, '\n')); err != nil {
+		log.Error().Err(err).Msg("⚠️ Error writing audit log")
+	}
+}
+
+func adminStatsCommand(session *config.Session, sendQueue *queue.SendQueue, streamer *api.Streamer, lang string) string {
+	// /admin stats: subscribers, queue, delivery errors and endpoint health
+	stats := state.GetStats(session.State)
+	deliveries := queue.RecentDeliveries(sendQueue)
+	_, deadLetters := queue.RecentDeadLetters(sendQueue, 0)
+
+	number := func(n int) string {
+		return locale.Number(lang, int64(n))
+	}
+
+	var endpoint string
+	if head, err := api.CheckEndpoint(session.Config); err != nil {
+		endpoint = "⚠️ " + err.Error()
+	} else {
+		endpoint = locale.T(lang, "owner.stats.reachable", head)
+	}
+
+	session.Config.Mutex.Lock()
+	noStream := session.Config.NoStream
+	session.Config.Mutex.Unlock()
+
+	streaming := locale.T(lang, "owner.streamer.running")
+	if noStream {
+		streaming = locale.T(lang, "owner.streamer.disabled")
+	} else if streamer.Paused() {
+		streaming = locale.T(lang, "owner.streamer.paused")
+	}
+
+	return locale.T(lang, "owner.stats.title") + "\n" +
+		locale.T(lang, "owner.stats.subscribers", number(len(state.Subscribers(session.State)))) + "\n" +
+		locale.T(lang, "owner.stats.queue", number(queue.QueueLength(sendQueue)), number(deadLetters)) + "\n" +
+		locale.T(lang, "owner.stats.broadcasts", number(deliveries.Broadcasts), number(deliveries.Delivered),
+			number(deliveries.Blocked), number(deliveries.Failed), locale.Decimal(lang, deliveries.ErrorRate()*100, 1),
+			number(deliveries.Retries)) + "\n" +
+		locale.T(lang, "owner.stats.endpoint", endpoint) + "\n" +
+		locale.T(lang, "owner.stats.streamer", streaming, locale.Number(lang, stats.CurrentSlot))
+}
+
+func announceCommand(session *config.Session, sendQueue *queue.SendQueue, payload string, lang string) string {
+	// /announce <text>: broadcast text to every subscriber
+	text := strings.TrimSpace(payload)
+	if text == "" {
+		return locale.T(lang, "owner.announce.usage")
+	}
+
+	recipients := state.Subscribers(session.State)
+	if len(recipients) == 0 {
+		return locale.T(lang, "owner.announce.nobody")
+	}
+
+	sopts := tb.SendOptions{DisableWebPagePreview: true}
+	broadcastId := queue.NewBroadcast(sendQueue, session.Config, session.State, recipients, sopts)
+
+	for _, chatId := range recipients {
+		queue.AddToQueue(sendQueue, &queue.Message{
+			Type:        "telegram",
+			Recipient:   chatId,
+			Message:     "📢 " + text,
+			Sopts:       sopts,
+			BroadcastId: broadcastId,
+		})
+	}
+
+	chats := locale.Number(lang, int64(len(recipients)))
+	if broadcastId == 0 {
+		return locale.T(lang, "owner.announce.unreported", chats)
+	}
+
+	return locale.T(lang, "owner.announce.queued", chats, broadcastId)
+}
+
+func resyncCommand(session *config.Session, streamer *api.Streamer, payload string, lang string) string {
+	// /resync <slot>: continue streaming from slot
+	slot, err := strconv.ParseInt(strings.TrimSpace(payload), 10, 64)
+	if err != nil || slot <= 0 {
+		return locale.T(lang, "owner.resync.usage")
+	}
+
+	// Past slots can be streamed again to backfill missed slots: recorded slashings aren't broadcast again
+	streamer.Resync(slot)
+	return locale.T(lang, "owner.resync.done", locale.Number(lang, slot))
+}
+
+func deadLettersCommand(sendQueue *queue.SendQueue, payload string, now int64, lang string) string {
+	// /dlq [count]: show the most recent dead letters
+	count := defaultDeadLetters
+	if payload = strings.TrimSpace(payload); payload != "" {
+		var err error
+		if count, err = strconv.Atoi(payload); err != nil || count <= 0 {
+			return locale.T(lang, "owner.dlq.usage")
+		}
+	}
+
+	if count > maxDeadLetters {
+		count = maxDeadLetters
+	}
+
+	letters, total := queue.RecentDeadLetters(sendQueue, count)
+	if total == 0 {
+		return locale.T(lang, "owner.dlq.empty")
+	}
+
+	text := locale.T(lang, "owner.dlq.title", locale.Number(lang, int64(len(letters))), locale.Number(lang, int64(total))) + "\n"
+	for _, letter := range letters {
+		ago := locale.Duration(lang, time.Duration(now-letter.Failed)*time.Second)
+		text += "\n" + locale.T(lang, "owner.dlq.letter", letter.Message.Recipient,
+			locale.Number(lang, int64(letter.Message.Attempts)), ago, letter.Error)
+	}
+
+	return text
+}
+
+func setupAdminHandlers(session *config.Session, sendQueue *queue.SendQueue, streamer *api.Streamer) {
+	/* Owner-only commands for managing the bot. Every use is audit-logged. */
+	handlers := map[string]func(message *tb.Message, lang string) string{
+		"/admin": func(message *tb.Message, lang string) string {
+			if strings.TrimSpace(message.Payload) != "stats" {
+				return locale.T(lang, "owner.admin.usage")
+			}
+
+			return adminStatsCommand(session, sendQueue, streamer, lang)
+		},
+		"/announce": func(message *tb.Message, lang string) string {
+			return announceCommand(session, sendQueue, message.Payload, lang)
+		},
+		"/ban": func(message *tb.Message, lang string) string {
+			return banCommand(session, message.Payload, message.Unixtime, lang)
+		},
+		"/unban": func(message *tb.Message, lang string) string {
+			return unbanCommand(session, message.Payload, lang)
+		},
+		"/pause": func(message *tb.Message, lang string) string {
+			if !streamer.Pause() {
+				return locale.T(lang, "owner.pause.already")
+			}
+
+			return locale.T(lang, "owner.pause.done")
+		},
+		"/resume": func(message *tb.Message, lang string) string {
+			if !streamer.Resume() {
+				return locale.T(lang, "owner.resume.already")
+			}
+
+			return locale.T(lang, "owner.resume.done")
+		},
+		"/resync": func(message *tb.Message, lang string) string {
+			return resyncCommand(session, streamer, message.Payload, lang)
+		},
+		"/dlq": func(message *tb.Message, lang string) string {
+			return deadLettersCommand(sendQueue, message.Payload, message.Unixtime, lang)
+		},
+	}
+
+	for command, handler := range handlers {
+		command, handler := command, handler
+
+		session.Telegram.Handle(command, func(c tb.Context) error {
+			message := c.Message()
+
+			// Ignore everyone but the owner
+			if message.Sender == nil || !isOwner(session, message.Sender.ID) {
+				return nil
+			}
+
+			result := handler(message, chatLanguage(session, message.Chat, message.Sender))
+			audit(session, message, command, result)
+
+			queue.AddToQueue(sendQueue, &queue.Message{
+				Type:      "telegram",
+				Recipient: message.Chat.ID,
+				Message:   result,
+			})
+
+			return nil
+		})
+	}
+}
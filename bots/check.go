@@ -0,0 +1,45 @@
+package bots
+
+import (
+	"net/http"
+	"slashcaster/config"
+	"time"
+
+	dg "github.com/bwmarrin/discordgo"
+	tb "gopkg.in/telebot.v3"
+)
+
+// Timeout for the API calls made by checks
+const checkTimeout = 15 * time.Second
+
+func CheckTelegram(conf *config.Config) (string, error) {
+	/* Verifies the Telegram token with getMe, returns the bot's username */
+	bot, err := tb.NewBot(tb.Settings{
+		Token:  conf.Tokens.Telegram,
+		URL:    conf.TelegramAPI,
+		Client: &http.Client{Timeout: checkTimeout},
+	})
+
+	if err != nil {
+		return "", config.RedactError(err)
+	}
+
+	return bot.Me.Username, nil
+}
+
+func CheckDiscord(conf *config.Config) (string, error) {
+	/* Verifies the Discord token by fetching the bot's own user */
+	session, err := dg.New("Bot " + conf.Tokens.Discord)
+	if err != nil {
+		return "", err
+	}
+
+	session.Client.Timeout = checkTimeout
+
+	user, err := session.User("@me")
+	if err != nil {
+		return "", err
+	}
+
+	return user.Username, nil
+}
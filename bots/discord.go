@@ -2,13 +2,112 @@ package bots
 
 import (
 	"log"
+	"slashcaster/api"
 	"slashcaster/config"
+	"slashcaster/locale"
 	"slashcaster/queue"
+	"slashcaster/spam"
+	"strconv"
 
 	dg "github.com/bwmarrin/discordgo"
 )
 
-func SetupDiscordBot(session *config.Session, sendQueue *queue.SendQueue) {
+// Slash commands registered with Discord
+var discordCommands = []*dg.ApplicationCommand{
+	{
+		Name:        "stats",
+		Description: "Show slashing statistics and the bot's sync status",
+	},
+	{
+		Name:        "validator",
+		Description: "Look up a validator's status and slashings",
+		Options: []*dg.ApplicationCommandOption{{
+			Type:        dg.ApplicationCommandOptionString,
+			Name:        "id",
+			Description: "Validator index or pubkey",
+			Required:    true,
+		}},
+	},
+}
+
+func discordUser(interaction *dg.Interaction) int64 {
+	// Users invoke commands as guild members, or directly in DMs
+	user := interaction.User
+	if interaction.Member != nil {
+		user = interaction.Member.User
+	}
+
+	if user == nil {
+		return 0
+	}
+
+	id, _ := strconv.ParseInt(user.ID, 10, 64)
+	return id
+}
+
+func discordReply(session *dg.Session, interaction *dg.Interaction, text string) {
+	// Replace the deferred response to an interaction with text
+	if _, err := session.InteractionResponseEdit(interaction, &dg.WebhookEdit{Content: text}); err != nil {
+		log.Println("Error responding to Discord interaction:", err)
+	}
+}
+
+func handleDiscordCommand(session *config.Session, sendQueue *queue.SendQueue, streamer *api.Streamer, s *dg.Session, i *dg.InteractionCreate) {
+	/* Handles slash commands. Replies can be slow, so the response is deferred. */
+	if i.Type != dg.InteractionApplicationCommand {
+		return
+	}
+
+	// Reply in the user's Discord language
+	data := i.ApplicationCommandData()
+	lang := locale.Match(string(i.Locale))
+
+	handlers := map[string]func() string{
+		"stats": func() string {
+			return api.StatsString(api.CollectStats(streamer.Beacon, session.State, sendQueue), api.MarkupDiscord, lang)
+		},
+		"validator": func() string {
+			if len(data.Options) == 0 {
+				return locale.T(lang, "validator.usage")
+			}
+
+			return validatorReply(session, streamer.Beacon, data.Options[0].StringValue(), lang)
+		},
+	}
+
+	handler, ok := handlers[data.Name]
+	if !ok {
+		return
+	}
+
+	// Throttle requests: Discord users are limited like Telegram users
+	user := discordUser(i.Interaction)
+	if allowed, _ := spam.CommandPreHandler(session.Spam, "/"+data.Name, user, user, lang); !allowed {
+		err := s.InteractionRespond(i.Interaction, &dg.InteractionResponse{
+			Type: dg.InteractionResponseChannelMessageWithSource,
+			Data: &dg.InteractionResponseData{Content: locale.T(lang, "button.slowdown"), Flags: uint64(dg.MessageFlagsEphemeral)},
+		})
+
+		if err != nil {
+			log.Println("Error responding to Discord interaction:", err)
+		}
+
+		return
+	}
+
+	err := s.InteractionRespond(i.Interaction, &dg.InteractionResponse{
+		Type: dg.InteractionResponseDeferredChannelMessageWithSource,
+	})
+
+	if err != nil {
+		log.Println("Error responding to Discord interaction:", err)
+		return
+	}
+
+	discordReply(s, i.Interaction, handler())
+}
+
+func SetupDiscordBot(session *config.Session, sendQueue *queue.SendQueue, streamer *api.Streamer) {
 	// If bot is not configured, return
 	if session.Config.Tokens.Discord == "" {
 		return
@@ -21,4 +120,36 @@ func SetupDiscordBot(session *config.Session, sendQueue *queue.SendQueue) {
 		log.Fatal("Error creating Discord bot:", err)
 		return
 	}
+
+	// Slash commands arrive as interactions
+	session.Discord.AddHandler(func(s *dg.Session, i *dg.InteractionCreate) {
+		handleDiscordCommand(session, sendQueue, streamer, s, i)
+	})
+
+	if err = session.Discord.Open(); err != nil {
+		log.Println("Error connecting to Discord:", config.RedactError(err))
+		return
+	}
+
+	// Register commands in the configured guild, where they're available at once, or globally
+	session.Config.Mutex.Lock()
+	guild := session.Config.Broadcast.DiscordGuild
+	session.Config.Mutex.Unlock()
+
+	for _, command := range discordCommands {
+		if _, err = session.Discord.ApplicationCommandCreate(session.Discord.State.User.ID, guild, command); err != nil {
+			log.Printf("Error registering Discord command /%s: %s", command.Name, config.RedactError(err))
+		}
+	}
+}
+
+func StopDiscordBot(session *config.Session) {
+	// If bot is not configured, nothing to stop
+	if session.Discord == nil {
+		return
+	}
+
+	if err := session.Discord.Close(); err != nil {
+		log.Println("Error closing Discord session:", err)
+	}
 }
@@ -0,0 +1,151 @@
+package bots
+
+import (
+	"errors"
+	"log"
+	"slashcaster/api"
+	"slashcaster/config"
+	"slashcaster/locale"
+	"slashcaster/state"
+	"strconv"
+	"strings"
+
+	tb "gopkg.in/telebot.v3"
+)
+
+// Unique IDs of the page buttons of /last and /history
+const (
+	lastButton    = "last"
+	historyButton = "history"
+)
+
+func pageMarkup(unique string, page int, pages int, lang string, args ...string) *tb.ReplyMarkup {
+	/* Inline keyboard to move between pages. Button data is args, followed by the page. */
+	if pages <= 1 {
+		return nil
+	}
+
+	markup := &tb.ReplyMarkup{}
+	button := func(text string, page int) tb.Btn {
+		data := append(append([]string{}, args...), strconv.Itoa(page))
+		return markup.Data(text, unique, data...)
+	}
+
+	var buttons []tb.Btn
+	if page > 0 {
+		buttons = append(buttons, button(locale.T(lang, "page.previous"), page-1))
+	}
+
+	if page < pages-1 {
+		buttons = append(buttons, button(locale.T(lang, "page.next"), page+1))
+	}
+
+	markup.Inline(markup.Row(buttons...))
+	return markup
+}
+
+func lastPage(session *config.Session, count int, page int, lang string) (string, *tb.ReplyMarkup) {
+	// A page of the last count slashings
+	records := state.LastSlashings(session.State, count)
+	pages := api.Pages(len(records), api.LastPageSize)
+
+	if page >= pages {
+		page = pages - 1
+	}
+
+	return api.LastString(records, page, lang), pageMarkup(lastButton, page, pages, lang, strconv.Itoa(count))
+}
+
+func lastCommand(session *config.Session, payload string, lang string) (string, *tb.ReplyMarkup) {
+	// /last [n]: the n most recent slashings
+	count := api.DefaultLast
+	if payload = strings.TrimSpace(payload); payload != "" {
+		var err error
+		if count, err = strconv.Atoi(payload); err != nil || count <= 0 {
+			return api.EscapeMarkdown(locale.T(lang, "last.usage")), nil
+		}
+	}
+
+	if count > api.MaxLast {
+		count = api.MaxLast
+	}
+
+	return lastPage(session, count, 0, lang)
+}
+
+func historyPage(session *config.Session, from string, to string, page int, lang string) (string, *tb.ReplyMarkup) {
+	// A page of slashing counts between from and to
+	start, end, err := api.ParseHistoryRange(from, to)
+	if errors.Is(err, api.ErrInvalidRange) {
+		return api.EscapeMarkdown(locale.T(lang, "history.usage")), nil
+	}
+
+	periods, granularity := api.SlashingHistory(session.State, start, end)
+	pages := api.Pages(len(periods), api.HistoryPageSize)
+
+	if page >= pages {
+		page = pages - 1
+	}
+
+	return api.HistoryString(periods, granularity, start, end, page, lang), pageMarkup(historyButton, page, pages, lang, from, to)
+}
+
+func historyCommand(session *config.Session, payload string, lang string) (string, *tb.ReplyMarkup) {
+	// /history <from> <to>
+	args := strings.Fields(payload)
+	if len(args) != 2 {
+		return api.EscapeMarkdown(locale.T(lang, "history.usage")), nil
+	}
+
+	return historyPage(session, args[0], args[1], 0, lang)
+}
+
+func setupPageHandlers(session *config.Session) {
+	/* Handles the page buttons of /last and /history by editing the message */
+	type pager struct {
+		args int // Count of arguments before the page
+		page func(args []string, page int, lang string) (string, *tb.ReplyMarkup)
+	}
+
+	pagers := map[string]pager{
+		lastButton: {1, func(args []string, page int, lang string) (string, *tb.ReplyMarkup) {
+			count, err := strconv.Atoi(args[0])
+			if err != nil || count <= 0 || count > api.MaxLast {
+				count = api.DefaultLast
+			}
+
+			return lastPage(session, count, page, lang)
+		}},
+		historyButton: {2, func(args []string, page int, lang string) (string, *tb.ReplyMarkup) {
+			return historyPage(session, args[0], args[1], page, lang)
+		}},
+	}
+
+	for unique, pager := range pagers {
+		pager := pager
+
+		session.Telegram.Handle(&tb.Btn{Unique: unique}, func(c tb.Context) error {
+			if !throttleButton(session, c) {
+				return nil
+			}
+
+			args := c.Args()
+			if len(args) != pager.args+1 {
+				return c.Respond()
+			}
+
+			page, err := strconv.Atoi(args[pager.args])
+			if err != nil || page < 0 {
+				return c.Respond()
+			}
+
+			text, markup := pager.page(args[:pager.args], page, chatLanguage(session, c.Chat(), c.Sender()))
+			err = c.Edit(text, &tb.SendOptions{ParseMode: "MarkdownV2", DisableWebPagePreview: true, ReplyMarkup: markup})
+			if err != nil && !errors.Is(err, tb.ErrMessageNotModified) {
+				log.Println("Error turning page:", config.RedactError(err))
+			}
+
+			return c.Respond()
+		})
+	}
+}
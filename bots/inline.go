@@ -0,0 +1,114 @@
+package bots
+
+import (
+	"fmt"
+	"log"
+	"slashcaster/api"
+	"slashcaster/config"
+	"slashcaster/locale"
+	"slashcaster/queue"
+	"slashcaster/state"
+	"strconv"
+	"strings"
+	"time"
+
+	tb "gopkg.in/telebot.v3"
+)
+
+// Slashings returned for "last" queries
+const inlineSlashings = 5
+
+// How long Telegram may cache inline results, in seconds
+const inlineCacheTime = 30
+
+func inlineArticle(id string, title string, description string, text string, parseMode tb.ParseMode) *tb.ArticleResult {
+	/*
+		An inline result that sends text when picked. Results of an answer need
+		unique IDs: telebot's default IDs are not unique.
+	*/
+	return &tb.ArticleResult{
+		ResultBase: tb.ResultBase{
+			ID:      id,
+			Content: &tb.InputTextMessageContent{Text: text, ParseMode: parseMode, DisablePreview: true},
+		},
+		Title:       title,
+		Description: description,
+	}
+}
+
+func lastResults(session *config.Session, lang string) tb.Results {
+	// The latest slashings, each as they were broadcast
+	records := state.LastSlashings(session.State, inlineSlashings+1)
+
+	results := tb.Results{}
+	for i, record := range records {
+		if i == inlineSlashings {
+			break
+		}
+
+		// Records are newest first: the next one is the previous slashing
+		var previous int64
+		if i+1 < len(records) {
+			previous = records[i+1].Time
+		}
+
+		title := locale.T(lang, "inline.slashing", locale.Number(lang, record.Slot),
+			locale.Plural(lang, len(record.Validators), "validators"))
+		description := time.Unix(record.Time, 0).UTC().Format(locale.T(lang, "format.time"))
+
+		text := api.RecordString(record, previous, lang)
+		results = append(results, inlineArticle(fmt.Sprintf("slot-%d", record.Slot), title, description, text, tb.ModeMarkdownV2))
+	}
+
+	return results
+}
+
+func inlineResults(session *config.Session, sendQueue *queue.SendQueue, streamer *api.Streamer, query string, lang string) tb.Results {
+	/*
+		Answers an inline query: "last" (or nothing) for the latest slashings,
+		"stats" for statistics, and a validator index or pubkey for the validator.
+	*/
+	query = strings.ToLower(strings.TrimSpace(query))
+
+	switch query {
+	case "", "last":
+		return lastResults(session, lang)
+	case "stats":
+		text := api.StatsString(api.CollectStats(streamer.Beacon, session.State, sendQueue), api.MarkupTelegram, lang)
+		return tb.Results{inlineArticle("stats", locale.T(lang, "inline.stats"), locale.T(lang, "inline.stats.about"), text, tb.ModeMarkdown)}
+	}
+
+	report, err := api.LookupValidator(streamer.Beacon, session.State, query)
+	if err != nil {
+		return tb.Results{}
+	}
+
+	index, _ := strconv.ParseInt(report.Validator.Index, 10, 64)
+	description := locale.T(lang, "validator.inline.no", report.Validator.Status)
+	if report.Validator.Validator.Slashed {
+		description = locale.T(lang, "validator.inline.yes", report.Validator.Status)
+	}
+
+	title := locale.T(lang, "validator.title", locale.Number(lang, index))
+	return tb.Results{inlineArticle("validator-"+report.Validator.Index, title, description,
+		api.ValidatorString(report, time.Now().Unix(), lang), "")}
+}
+
+func setupInlineHandler(session *config.Session, sendQueue *queue.SendQueue, streamer *api.Streamer) {
+	/* Handles inline queries, e.g. "@bot 12345", so results can be shared in any chat */
+	session.Telegram.Handle(tb.OnQuery, func(c tb.Context) error {
+		// Queries are sent while typing: limit them without counting offences
+		user := c.Sender().ID
+		if state.GetBan(session.State, user).Active(time.Now().Unix()) || !session.Spam.Limiter.AllowIsolated("inline", user) {
+			return nil
+		}
+
+		results := inlineResults(session, sendQueue, streamer, c.Query().Text, locale.Match(c.Sender().LanguageCode))
+		err := c.Answer(&tb.QueryResponse{Results: results, CacheTime: inlineCacheTime})
+		if err != nil {
+			log.Println("Error answering inline query:", config.RedactError(err))
+		}
+
+		return nil
+	})
+}
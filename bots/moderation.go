@@ -0,0 +1,69 @@
+package bots
+
+import (
+	"slashcaster/config"
+	"slashcaster/locale"
+	"slashcaster/spam"
+	"slashcaster/state"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func isOwner(session *config.Session, userId int64) bool {
+	/* Is userId the bot's owner? */
+	session.Config.Mutex.Lock()
+	defer session.Config.Mutex.Unlock()
+
+	return session.Config.Broadcast.TelegramOwner != 0 && userId == session.Config.Broadcast.TelegramOwner
+}
+
+func banCommand(session *config.Session, payload string, now int64, lang string) string {
+	// /ban <chat id> [duration]: without a duration, the ban is permanent
+	args := strings.Fields(payload)
+	if len(args) == 0 || len(args) > 2 {
+		return locale.T(lang, "owner.ban.usage")
+	}
+
+	chatId, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return locale.T(lang, "owner.ban.chat", args[0])
+	}
+
+	ban := state.Ban{Permanent: true, Reason: "banned by owner"}
+	if len(args) == 2 {
+		duration, err := time.ParseDuration(args[1])
+		if err != nil || duration <= 0 {
+			return locale.T(lang, "owner.ban.duration", args[1])
+		}
+
+		ban = state.Ban{Until: now + int64(duration.Seconds()), Reason: "banned by owner"}
+	}
+
+	if err = spam.BanChat(session.Spam, chatId, ban); err != nil {
+		return locale.T(lang, "owner.ban.error")
+	}
+
+	if ban.Permanent {
+		return locale.T(lang, "owner.ban.permanent", chatId)
+	}
+
+	return locale.T(lang, "owner.ban.done", chatId, locale.DurationUnits(lang, time.Duration(ban.Until-now)*time.Second, 2))
+}
+
+func unbanCommand(session *config.Session, payload string, lang string) string {
+	// /unban <chat id>
+	chatId, err := strconv.ParseInt(strings.TrimSpace(payload), 10, 64)
+	if err != nil {
+		return locale.T(lang, "owner.unban.usage")
+	}
+
+	removed, err := spam.UnbanChat(session.Spam, chatId)
+	if err != nil {
+		return locale.T(lang, "owner.unban.error")
+	} else if !removed {
+		return locale.T(lang, "owner.unban.none", chatId)
+	}
+
+	return locale.T(lang, "owner.unban.done", chatId)
+}
@@ -0,0 +1,455 @@
+package bots
+
+import (
+	"errors"
+	"log"
+	"slashcaster/config"
+	"slashcaster/locale"
+	"slashcaster/spam"
+	"slashcaster/state"
+	"strconv"
+	"strings"
+
+	tb "gopkg.in/telebot.v3"
+)
+
+// Unique IDs of the buttons of /settings and of the /start wizard
+const (
+	settingsButton = "settings"
+	onboardButton  = "onboard"
+)
+
+// Payload of /language, and button data, to follow the user's Telegram language
+const languageAuto = "auto"
+
+// Button data of the filter alerting on watched validators only
+const filterWatchlist = "watchlist"
+
+// Watched validators per row of the watchlist menu
+const watchlistColumns = 4
+
+func throttleButton(session *config.Session, c tb.Context) bool {
+	// Pressing buttons is limited like commands
+	lang := chatLanguage(session, c.Chat(), c.Sender())
+	allowed, _ := spam.CommandPreHandler(session.Spam, "button", c.Sender().ID, c.Chat().ID, lang)
+	if !allowed {
+		_ = c.Respond(&tb.CallbackResponse{Text: locale.T(lang, "button.slowdown")})
+	}
+
+	return allowed
+}
+
+func editMenu(c tb.Context, text string, markup *tb.ReplyMarkup) error {
+	// Replace a menu with its next step, and acknowledge the button press
+	err := c.Edit(text, &tb.SendOptions{ParseMode: tb.ModeMarkdown, ReplyMarkup: markup})
+	if err != nil {
+		log.Println("Error editing menu:", config.RedactError(err))
+	}
+
+	return c.Respond()
+}
+
+func deliveryButtons(markup *tb.ReplyMarkup, unique string, current string, lang string) []tb.Row {
+	// One button per delivery mode, the current one checked
+	var rows []tb.Row
+	for _, mode := range state.DeliveryModes {
+		label := locale.T(lang, "delivery."+mode)
+		if mode == current {
+			label = "✅ " + label
+		}
+
+		rows = append(rows, markup.Row(markup.Data(label, unique, "delivery", mode)))
+	}
+
+	return rows
+}
+
+func languageName(prefs state.Preferences, lang string) string {
+	// Name of the chat's language, noting if it follows the Telegram language
+	if prefs.Language == "" {
+		return locale.T(lang, "language.auto") + " (" + locale.Name(lang) + ")"
+	}
+
+	return locale.Name(prefs.Language)
+}
+
+func filterName(prefs state.Preferences, lang string) string {
+	// Description of the chat's alert filter
+	if prefs.WatchlistOnly {
+		return locale.T(lang, "filter.watchlist")
+	} else if prefs.MinValidators > 1 {
+		return locale.T(lang, "filter.min", locale.Number(lang, int64(prefs.MinValidators)))
+	}
+
+	return locale.T(lang, "filter.all")
+}
+
+func watchlistName(prefs state.Preferences, lang string) string {
+	// Size of the chat's watchlist
+	if len(prefs.Watchlist) == 0 {
+		return locale.T(lang, "watchlist.empty")
+	}
+
+	return locale.Plural(lang, len(prefs.Watchlist), "validators")
+}
+
+func settingsMenu(session *config.Session, chatId int64, lang string) (string, *tb.ReplyMarkup) {
+	/* The /settings menu of a chat: its subscription, delivery mode, filters, watchlist and language */
+	prefs := state.GetPreferences(session.State, chatId)
+	subscribed := state.IsSubscriber(session.State, chatId)
+
+	text := locale.T(lang, "settings.title")
+	markup := &tb.ReplyMarkup{}
+
+	var toggle tb.Btn
+	if subscribed {
+		text += locale.T(lang, "settings.on")
+		toggle = markup.Data(locale.T(lang, "settings.unsubscribe"), settingsButton, "unsubscribe")
+	} else {
+		text += locale.T(lang, "settings.off")
+		toggle = markup.Data(locale.T(lang, "settings.subscribe"), settingsButton, "subscribe")
+	}
+
+	text += locale.T(lang, "settings.delivery", locale.T(lang, "delivery."+prefs.Delivery))
+	text += locale.T(lang, "settings.filter", filterName(prefs, lang))
+	text += locale.T(lang, "settings.watchlist", watchlistName(prefs, lang))
+	text += locale.T(lang, "settings.language", languageName(prefs, lang))
+
+	markup.Inline(
+		markup.Row(toggle),
+		markup.Row(markup.Data(locale.T(lang, "settings.change.delivery"), settingsButton, "delivery")),
+		markup.Row(markup.Data(locale.T(lang, "settings.change.filter"), settingsButton, "filter")),
+		markup.Row(markup.Data(locale.T(lang, "settings.change.watchlist"), settingsButton, "watchlist")),
+		markup.Row(markup.Data(locale.T(lang, "settings.change.language"), settingsButton, "language")),
+		markup.Row(markup.Data(locale.T(lang, "settings.done"), settingsButton, "done")),
+	)
+
+	return text, markup
+}
+
+func deliveryMenu(session *config.Session, chatId int64, lang string) (string, *tb.ReplyMarkup) {
+	// The delivery mode step of /settings
+	prefs := state.GetPreferences(session.State, chatId)
+	markup := &tb.ReplyMarkup{}
+
+	rows := deliveryButtons(markup, settingsButton, prefs.Delivery, lang)
+	rows = append(rows, markup.Row(markup.Data(locale.T(lang, "settings.back"), settingsButton, "menu")))
+	markup.Inline(rows...)
+
+	return locale.T(lang, "settings.delivery.title") + locale.T(lang, "delivery.explain"), markup
+}
+
+func languageMenu(session *config.Session, chatId int64, lang string) (string, *tb.ReplyMarkup) {
+	// The language step of /settings
+	current := state.GetPreferences(session.State, chatId).Language
+	markup := &tb.ReplyMarkup{}
+
+	button := func(label string, choice string) tb.Row {
+		if choice == current || (choice == languageAuto && current == "") {
+			label = "✅ " + label
+		}
+
+		return markup.Row(markup.Data(label, settingsButton, "language", choice))
+	}
+
+	rows := []tb.Row{button(locale.T(lang, "language.auto"), languageAuto)}
+	for _, choice := range locale.Languages {
+		rows = append(rows, button(locale.Name(choice), choice))
+	}
+
+	rows = append(rows, markup.Row(markup.Data(locale.T(lang, "settings.back"), settingsButton, "menu")))
+	markup.Inline(rows...)
+
+	return locale.T(lang, "settings.language.title"), markup
+}
+
+func filterMenu(session *config.Session, chatId int64, lang string) (string, *tb.ReplyMarkup) {
+	// The filter step of /settings
+	prefs := state.GetPreferences(session.State, chatId)
+	markup := &tb.ReplyMarkup{}
+
+	button := func(label string, choice string, current bool) tb.Row {
+		if current {
+			label = "✅ " + label
+		}
+
+		return markup.Row(markup.Data(label, settingsButton, "filter", choice))
+	}
+
+	var rows []tb.Row
+	for _, size := range state.AlertSizes {
+		label := locale.T(lang, "filter.all")
+		if size > 1 {
+			label = locale.T(lang, "filter.min", locale.Number(lang, int64(size)))
+		}
+
+		current := !prefs.WatchlistOnly && (prefs.MinValidators == size || (size == 1 && prefs.MinValidators <= 1))
+		rows = append(rows, button(label, strconv.Itoa(size), current))
+	}
+
+	rows = append(rows, button(locale.T(lang, "filter.watchlist"), filterWatchlist, prefs.WatchlistOnly))
+	rows = append(rows, markup.Row(markup.Data(locale.T(lang, "settings.back"), settingsButton, "menu")))
+	markup.Inline(rows...)
+
+	return locale.T(lang, "settings.filter.title"), markup
+}
+
+func watchlistMenu(session *config.Session, chatId int64, lang string) (string, *tb.ReplyMarkup) {
+	// The watchlist step of /settings: a button per watched validator removes it
+	watchlist := state.GetPreferences(session.State, chatId).Watchlist
+	markup := &tb.ReplyMarkup{}
+
+	text := locale.T(lang, "settings.watchlist.title")
+	if len(watchlist) == 0 {
+		text += locale.T(lang, "settings.watchlist.none")
+	} else {
+		text += locale.T(lang, "settings.watchlist.list", strings.Join(watchlist, ", "))
+	}
+
+	var rows []tb.Row
+	var row tb.Row
+	for _, index := range watchlist {
+		row = append(row, markup.Data("❌ "+index, settingsButton, "unwatch", index))
+		if len(row) == watchlistColumns {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+
+	if len(row) != 0 {
+		rows = append(rows, row)
+	}
+
+	rows = append(rows, markup.Row(markup.Data(locale.T(lang, "settings.back"), settingsButton, "menu")))
+	markup.Inline(rows...)
+
+	return text + locale.T(lang, "settings.watchlist.add", state.MaxWatchlist), markup
+}
+
+func welcomeMenu(lang string) (string, *tb.ReplyMarkup) {
+	/* First step of the /start wizard */
+	markup := &tb.ReplyMarkup{}
+	markup.Inline(
+		markup.Row(markup.Data(locale.T(lang, "start.yes"), onboardButton, "subscribe")),
+		markup.Row(markup.Data(locale.T(lang, "start.no"), onboardButton, "skip")),
+	)
+
+	return locale.T(lang, "start.welcome") + locale.T(lang, "start.ask"), markup
+}
+
+func setDelivery(session *config.Session, chatId int64, mode string) error {
+	// Save the chat's delivery mode
+	prefs := state.GetPreferences(session.State, chatId)
+	prefs.Delivery = mode
+
+	return state.SetPreferences(session.State, chatId, prefs)
+}
+
+func setLanguage(session *config.Session, chatId int64, choice string) error {
+	// Save the chat's language, or follow the Telegram language for languageAuto
+	prefs := state.GetPreferences(session.State, chatId)
+	prefs.Language = choice
+	if choice == languageAuto {
+		prefs.Language = ""
+	}
+
+	return state.SetPreferences(session.State, chatId, prefs)
+}
+
+func setFilter(session *config.Session, chatId int64, choice string) error {
+	// Save the chat's alert filter: an alert size, or filterWatchlist. Unknown choices are ignored.
+	prefs := state.GetPreferences(session.State, chatId)
+
+	if choice == filterWatchlist {
+		prefs.WatchlistOnly, prefs.MinValidators = true, 0
+		return state.SetPreferences(session.State, chatId, prefs)
+	}
+
+	size, err := strconv.Atoi(choice)
+	if err != nil {
+		return nil
+	}
+
+	for _, valid := range state.AlertSizes {
+		if size == valid {
+			prefs.WatchlistOnly, prefs.MinValidators = false, size
+			if size == 1 {
+				prefs.MinValidators = 0
+			}
+
+			return state.SetPreferences(session.State, chatId, prefs)
+		}
+	}
+
+	return nil
+}
+
+func validatorIndex(payload string) (string, bool) {
+	// Parse a validator index, normalized for watchlists
+	index, err := strconv.ParseUint(strings.TrimSpace(payload), 10, 64)
+	if err != nil {
+		return "", false
+	}
+
+	return strconv.FormatUint(index, 10), true
+}
+
+func watchCommand(session *config.Session, chatId int64, payload string, watch bool, lang string) string {
+	/*
+		/watch <index> and /unwatch <index>: add a validator to the chat's
+		watchlist, or remove it. Without an index, the watchlist is shown.
+	*/
+	if strings.TrimSpace(payload) == "" {
+		watchlist := state.GetPreferences(session.State, chatId).Watchlist
+		if len(watchlist) == 0 {
+			return locale.T(lang, "watch.none")
+		}
+
+		return locale.T(lang, "watch.current", strings.Join(watchlist, ", "))
+	}
+
+	index, ok := validatorIndex(payload)
+	if !ok {
+		return locale.T(lang, "watch.invalid")
+	}
+
+	if !watch {
+		removed, err := state.Unwatch(session.State, chatId, index)
+		if err != nil {
+			return locale.T(lang, "error.preferences")
+		} else if !removed {
+			return locale.T(lang, "unwatch.nothing", index)
+		}
+
+		return locale.T(lang, "unwatch.removed", index)
+	}
+
+	added, err := state.Watch(session.State, chatId, index)
+	if errors.Is(err, state.ErrWatchlistFull) {
+		return locale.T(lang, "watch.full", locale.Number(lang, state.MaxWatchlist))
+	} else if err != nil {
+		return locale.T(lang, "error.preferences")
+	} else if !added {
+		return locale.T(lang, "watch.already", index)
+	}
+
+	return locale.T(lang, "watch.added", index)
+}
+
+func settingsStep(session *config.Session, c tb.Context) (string, *tb.ReplyMarkup, error) {
+	// Apply a /settings button press, returns the menu to show next
+	chatId, args := c.Chat().ID, c.Args()
+	var err error
+
+	switch args[0] {
+	case "subscribe":
+		_, err = state.AddSubscriber(session.State, chatId)
+	case "unsubscribe":
+		_, err = state.RemoveSubscriber(session.State, chatId)
+	case "delivery":
+		if len(args) == 1 {
+			text, markup := deliveryMenu(session, chatId, chatLanguage(session, c.Chat(), c.Sender()))
+			return text, markup, nil
+		}
+
+		if state.ValidDeliveryMode(args[1]) {
+			err = setDelivery(session, chatId, args[1])
+		}
+	case "language":
+		if len(args) == 1 {
+			text, markup := languageMenu(session, chatId, chatLanguage(session, c.Chat(), c.Sender()))
+			return text, markup, nil
+		}
+
+		if args[1] == languageAuto || locale.Supported(args[1]) {
+			err = setLanguage(session, chatId, args[1])
+		}
+	case "filter":
+		if len(args) == 1 {
+			text, markup := filterMenu(session, chatId, chatLanguage(session, c.Chat(), c.Sender()))
+			return text, markup, nil
+		}
+
+		err = setFilter(session, chatId, args[1])
+	case "watchlist", "unwatch":
+		if args[0] == "unwatch" && len(args) == 2 {
+			_, err = state.Unwatch(session.State, chatId, args[1])
+		}
+
+		// Stay on the watchlist, so more validators can be removed
+		text, markup := watchlistMenu(session, chatId, chatLanguage(session, c.Chat(), c.Sender()))
+		return text, markup, err
+	case "done":
+		lang := chatLanguage(session, c.Chat(), c.Sender())
+		text, _ := settingsMenu(session, chatId, lang)
+		return text + "\n\n" + locale.T(lang, "settings.later"), nil, nil
+	}
+
+	// Changes may have switched the language, e.g. subscribing remembers the Telegram language
+	text, markup := settingsMenu(session, chatId, chatLanguage(session, c.Chat(), c.Sender()))
+	return text, markup, err
+}
+
+func onboardingStep(session *config.Session, c tb.Context) (string, *tb.ReplyMarkup, error) {
+	// Apply a /start wizard button press, returns the step to show next
+	chatId, args := c.Chat().ID, c.Args()
+
+	switch args[0] {
+	case "subscribe":
+		if _, err := state.AddSubscriber(session.State, chatId); err != nil {
+			return "", nil, err
+		}
+
+		lang := chatLanguage(session, c.Chat(), c.Sender())
+		markup := &tb.ReplyMarkup{}
+		markup.Inline(deliveryButtons(markup, onboardButton, state.GetPreferences(session.State, chatId).Delivery, lang)...)
+
+		return locale.T(lang, "start.subscribed") + locale.T(lang, "delivery.explain"), markup, nil
+	case "delivery":
+		if len(args) == 2 && state.ValidDeliveryMode(args[1]) {
+			if err := setDelivery(session, chatId, args[1]); err != nil {
+				return "", nil, err
+			}
+		}
+
+		lang := chatLanguage(session, c.Chat(), c.Sender())
+		text, _ := settingsMenu(session, chatId, lang)
+		return locale.T(lang, "start.done") + text + "\n\n" + locale.T(lang, "settings.later"), nil, nil
+	}
+
+	lang := chatLanguage(session, c.Chat(), c.Sender())
+	return locale.T(lang, "start.welcome") + locale.T(lang, "start.skipped"), nil, nil
+}
+
+func setupSettingsHandlers(session *config.Session) {
+	/* Handles the buttons of /settings and of the /start wizard */
+	steps := map[string]func(session *config.Session, c tb.Context) (string, *tb.ReplyMarkup, error){
+		settingsButton: settingsStep,
+		onboardButton:  onboardingStep,
+	}
+
+	for unique, step := range steps {
+		step := step
+
+		session.Telegram.Handle(&tb.Btn{Unique: unique}, func(c tb.Context) error {
+			if !throttleButton(session, c) {
+				return nil
+			}
+
+			// In groups, only admins can change settings
+			if !isChatAdmin(session, c.Chat(), c.Sender()) {
+				lang := chatLanguage(session, c.Chat(), c.Sender())
+				return c.Respond(&tb.CallbackResponse{Text: locale.T(lang, "admin.settings")})
+			}
+
+			text, markup, err := step(session, c)
+			if err != nil {
+				log.Println("Error saving settings:", err)
+				lang := chatLanguage(session, c.Chat(), c.Sender())
+				return c.Respond(&tb.CallbackResponse{Text: locale.T(lang, "error.generic"), ShowAlert: true})
+			}
+
+			return editMenu(c, text, markup)
+		})
+	}
+}
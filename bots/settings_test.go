@@ -0,0 +1,200 @@
+package bots
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"reflect"
+	"slashcaster/config"
+	"slashcaster/locale"
+	"slashcaster/spam"
+	"slashcaster/state"
+	"strconv"
+	"sync"
+	"testing"
+
+	tb "gopkg.in/telebot.v3"
+)
+
+// User IDs the fake Bot API reports as a group admin, and as a group member
+const (
+	testAdmin  = 10
+	testMember = 20
+)
+
+type fakeTelegram struct {
+	/* A fake Bot API, recording the requests made to it */
+	mutex    sync.Mutex
+	requests []fakeRequest
+}
+
+type fakeRequest struct {
+	Method string
+	Params map[string]interface{}
+}
+
+func (fake *fakeTelegram) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	params := make(map[string]interface{})
+	_ = json.NewDecoder(r.Body).Decode(&params)
+	method := path.Base(r.URL.Path)
+
+	fake.mutex.Lock()
+	fake.requests = append(fake.requests, fakeRequest{Method: method, Params: params})
+	fake.mutex.Unlock()
+
+	if method == "getChatMember" {
+		status := "member"
+		if params["user_id"] == strconv.Itoa(testAdmin) {
+			status = "administrator"
+		}
+
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"status":"` + status + `","user":{"id":1}}}`))
+		return
+	}
+
+	_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":1,"date":0,"chat":{"id":1,"type":"private"}}}`))
+}
+
+func (fake *fakeTelegram) answers() []string {
+	// Texts of the callback query answers
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	var texts []string
+	for _, request := range fake.requests {
+		if request.Method == "answerCallbackQuery" {
+			text, _ := request.Params["text"].(string)
+			texts = append(texts, text)
+		}
+	}
+
+	return texts
+}
+
+func testSession(t *testing.T) (*config.Session, *fakeTelegram) {
+	fake := &fakeTelegram{}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	bot, err := tb.NewBot(tb.Settings{URL: server.URL, Token: "test", Offline: true, Synchronous: true})
+	if err != nil {
+		t.Fatalf("Error creating bot: %s", err)
+	}
+
+	store := &state.Store{}
+	generous := spam.Rule{Rate: 1000, Burst: 1000}
+	limiter := spam.NewLimiter(spam.Limits{User: generous, Group: generous, Command: generous}, nil)
+
+	session := &config.Session{
+		Config:   &config.Config{},
+		State:    store,
+		Spam:     spam.NewAntiSpam(store, limiter),
+		Telegram: bot,
+	}
+
+	setupSettingsHandlers(session)
+	return session, fake
+}
+
+func pressButton(session *config.Session, chat *tb.Chat, user int64, data string) {
+	session.Telegram.ProcessUpdate(tb.Update{Callback: &tb.Callback{
+		ID:      "1",
+		Data:    "\f" + data,
+		Sender:  &tb.User{ID: user},
+		Message: &tb.Message{ID: 1, Chat: chat},
+	}})
+}
+
+func TestSettingsButtons(t *testing.T) {
+	session, _ := testSession(t)
+	chat := &tb.Chat{ID: 1, Type: tb.ChatPrivate}
+
+	tests := []struct {
+		data     string
+		expected state.Preferences
+	}{
+		{"settings|delivery|daily", state.Preferences{Delivery: "daily"}},
+		{"settings|delivery|bogus", state.Preferences{Delivery: "daily"}},
+		{"settings|filter|10", state.Preferences{Delivery: "daily", MinValidators: 10}},
+		{"settings|filter|7", state.Preferences{Delivery: "daily", MinValidators: 10}},
+		{"settings|filter|watchlist", state.Preferences{Delivery: "daily", WatchlistOnly: true}},
+		{"settings|filter|1", state.Preferences{Delivery: "daily"}},
+		{"settings|language|de", state.Preferences{Delivery: "daily", Language: "de"}},
+		{"settings|language|xx", state.Preferences{Delivery: "daily", Language: "de"}},
+		{"settings|language|auto", state.Preferences{Delivery: "daily"}},
+	}
+
+	for _, test := range tests {
+		pressButton(session, chat, testAdmin, test.data)
+
+		if prefs := state.GetPreferences(session.State, chat.ID); !reflect.DeepEqual(prefs, test.expected) {
+			t.Errorf("%s: expected preferences %+v, got %+v", test.data, test.expected, prefs)
+		}
+	}
+
+	pressButton(session, chat, testAdmin, "settings|subscribe")
+	if !state.IsSubscriber(session.State, chat.ID) {
+		t.Errorf("Expected the subscribe button to subscribe the chat")
+	}
+
+	// Watched validators are removed with their button
+	for _, index := range []string{"5", "7"} {
+		if _, err := state.Watch(session.State, chat.ID, index); err != nil {
+			t.Fatalf("Error watching validator %s: %s", index, err)
+		}
+	}
+
+	pressButton(session, chat, testAdmin, "settings|unwatch|5")
+	if watchlist := state.GetPreferences(session.State, chat.ID).Watchlist; !reflect.DeepEqual(watchlist, []string{"7"}) {
+		t.Errorf("Expected watchlist [7] after unwatching 5, got %v", watchlist)
+	}
+}
+
+func TestSettingsPermissions(t *testing.T) {
+	session, fake := testSession(t)
+	group := &tb.Chat{ID: -100, Type: tb.ChatSuperGroup}
+
+	// Members of a group can't change its settings
+	pressButton(session, group, testMember, "settings|subscribe")
+	if state.IsSubscriber(session.State, group.ID) {
+		t.Errorf("Expected a group member to be denied")
+	}
+
+	denied := locale.T(locale.Default, "admin.settings")
+	if answers := fake.answers(); len(answers) != 1 || answers[0] != denied {
+		t.Errorf("Expected the member to be answered %q, got %q", denied, answers)
+	}
+
+	// Admins can
+	pressButton(session, group, testAdmin, "settings|subscribe")
+	if !state.IsSubscriber(session.State, group.ID) {
+		t.Errorf("Expected a group admin to subscribe the group")
+	}
+}
+
+func TestWatchCommand(t *testing.T) {
+	session, _ := testSession(t)
+	lang := locale.Default
+
+	tests := []struct {
+		payload  string
+		watch    bool
+		expected string
+	}{
+		{"", true, locale.T(lang, "watch.none")},
+		{"abc", true, locale.T(lang, "watch.invalid")},
+		{"-1", true, locale.T(lang, "watch.invalid")},
+		{"0042", true, locale.T(lang, "watch.added", "42")},
+		{"42", true, locale.T(lang, "watch.already", "42")},
+		{"", false, locale.T(lang, "watch.current", "42")},
+		{"43", false, locale.T(lang, "unwatch.nothing", "43")},
+		{" 42 ", false, locale.T(lang, "unwatch.removed", "42")},
+	}
+
+	for _, test := range tests {
+		if text := watchCommand(session, 1, test.payload, test.watch, lang); text != test.expected {
+			t.Errorf("watch=%v %q: expected %q, got %q", test.watch, test.payload, test.expected, text)
+		}
+	}
+}
@@ -1,81 +1,219 @@
 package bots
 
 import (
-	"fmt"
+	"context"
 	"log"
+	"slashcaster/api"
 	"slashcaster/config"
+	"slashcaster/locale"
 	"slashcaster/queue"
 	"slashcaster/spam"
+	"slashcaster/state"
+	"strings"
 	"time"
 
-	"github.com/dustin/go-humanize"
-	"github.com/hako/durafmt"
 	tb "gopkg.in/telebot.v3"
 )
 
-func SetupTelegramBot(session *config.Session, sendQueue *queue.SendQueue) {
+func senderId(message *tb.Message) int64 {
+	// Channel posts and anonymous group admins have no user: they act as the chat
+	if message.SenderChat != nil {
+		return message.SenderChat.ID
+	}
+
+	if message.Sender == nil {
+		return message.Chat.ID
+	}
+
+	return message.Sender.ID
+}
+
+func chatLanguage(session *config.Session, chat *tb.Chat, user *tb.User) string {
+	/*
+		Language to talk to a chat in: the language chosen with /language, else
+		the user's Telegram language in private chats. The Telegram language of
+		private subscribers is remembered, so broadcasts to them use it too.
+	*/
+	prefs := state.GetPreferences(session.State, chat.ID)
+	if chat.Type != tb.ChatPrivate || user == nil || user.LanguageCode == prefs.TelegramLanguage {
+		return locale.Match(prefs.Language, prefs.TelegramLanguage)
+	}
+
+	if state.IsSubscriber(session.State, chat.ID) {
+		prefs.TelegramLanguage = user.LanguageCode
+		if err := state.SetPreferences(session.State, chat.ID, prefs); err != nil {
+			log.Println("Error saving chat language:", err)
+		}
+	}
+
+	return locale.Match(prefs.Language, user.LanguageCode)
+}
+
+func throttle(session *config.Session, sendQueue *queue.SendQueue, command string, message *tb.Message) bool {
+	// Run anti-spam checks, notify the chat of warnings and bans
+	lang := chatLanguage(session, message.Chat, message.Sender)
+	allowed, notice := spam.CommandPreHandler(session.Spam, command, senderId(message), message.Chat.ID, lang)
+
+	if notice != "" {
+		queue.AddToQueue(sendQueue, &queue.Message{
+			Type:      "telegram",
+			Recipient: message.Chat.ID,
+			Message:   notice,
+		})
+	}
+
+	return allowed
+}
+
+func isChatAdmin(session *config.Session, chat *tb.Chat, user *tb.User) bool {
+	/* Is user an admin of chat? Everyone is in their private chat with the bot. */
+	if chat.Type == tb.ChatPrivate {
+		return true
+	}
+
+	if user == nil {
+		return false
+	}
+
+	member, err := session.Telegram.ChatMemberOf(chat, user)
+	if err != nil {
+		log.Println("Error checking chat member:", config.RedactError(err))
+		return false
+	}
+
+	return member.Role == tb.Creator || member.Role == tb.Administrator
+}
+
+func canManageChat(session *config.Session, message *tb.Message) bool {
+	/*
+		Can the sender change the chat's subscription? Anyone can in a private
+		chat. In groups, only admins can: channel posts and anonymous admins post
+		as the chat itself, everyone else is checked with getChatMember.
+	*/
+	if message.SenderChat != nil && message.SenderChat.ID == message.Chat.ID {
+		return true
+	}
+
+	return isChatAdmin(session, message.Chat, message.Sender)
+}
+
+func denyNonAdmin(session *config.Session, sendQueue *queue.SendQueue, message *tb.Message) bool {
+	// Tell group members that only admins can change the chat's subscription
+	if canManageChat(session, message) {
+		return false
+	}
+
+	queue.AddToQueue(sendQueue, &queue.Message{
+		Type:      "telegram",
+		Recipient: message.Chat.ID,
+		Message:   locale.T(chatLanguage(session, message.Chat, message.Sender), "admin.subscription"),
+	})
+
+	return true
+}
+
+func channelCommand(message *tb.Message, botName string) (string, bool) {
+	// Parse a command from a channel post, e.g. "/subscribe@SlashCasterBot payload"
+	fields := strings.SplitN(strings.TrimSpace(message.Text), " ", 2)
+	if len(fields[0]) < 2 || fields[0][0] != '/' {
+		return "", false
+	}
+
+	command, target, addressed := strings.Cut(fields[0], "@")
+	if addressed && !strings.EqualFold(target, botName) {
+		return "", false
+	}
+
+	message.Payload = ""
+	if len(fields) == 2 {
+		message.Payload = strings.TrimSpace(fields[1])
+	}
+
+	return command, true
+}
+
+func SetupTelegramBot(session *config.Session, sendQueue *queue.SendQueue, streamer *api.Streamer) {
 	var err error
 	session.Telegram, err = tb.NewBot(tb.Settings{
 		Token:  session.Config.Tokens.Telegram,
+		URL:    session.Config.TelegramAPI,
 		Poller: &tb.LongPoller{Timeout: 10 * time.Second},
 	})
 
 	if err != nil {
-		log.Fatal("Error creating Telegram bot:", err)
+		log.Fatal("Error creating Telegram bot:", config.RedactError(err))
+	}
+
+	// Commands are also accepted in channel posts, which Telegram doesn't deliver as commands
+	commands := make(map[string]tb.HandlerFunc)
+	handle := func(command string, handler tb.HandlerFunc) {
+		session.Telegram.Handle(command, handler)
+		commands[command] = handler
 	}
 
-	// Start command handler
-	session.Telegram.Handle("/start", func(c tb.Context) error {
+	// Start command handler: an onboarding wizard
+	handle("/start", func(c tb.Context) error {
 		// Extract message
 		message := *c.Message()
 
 		// Throttle requests
-		if !spam.CommandPreHandler(session.Spam, message.Sender.ID, message.Unixtime) {
+		if !throttle(session, sendQueue, "/start", &message) {
 			return nil
 		}
 
-		text := "🔪 Welcome to Eth2 slasher! " +
-			"This bot broadcasts slashing events occurring on the Ethereum beacon chain.\n\n" +
-			"To subscribe to slashing messages, use the channel @ethslashings."
+		// Walk new users through subscribing
+		text, markup := welcomeMenu(chatLanguage(session, message.Chat, message.Sender))
 
 		msg := queue.Message{
 			Type:      "telegram",
-			Recipient: message.Sender.ID,
+			Recipient: message.Chat.ID,
 			Message:   text,
-			Sopts:     tb.SendOptions{ParseMode: "Markdown"},
+			Sopts:     tb.SendOptions{ParseMode: "Markdown", ReplyMarkup: markup},
 		}
 
 		queue.AddToQueue(sendQueue, &msg)
 		return nil
 	})
 
-	// Output statistics
-	session.Telegram.Handle("/stats", func(c tb.Context) error {
+	// Settings menu
+	handle("/settings", func(c tb.Context) error {
 		// Extract message
 		message := *c.Message()
 
 		// Throttle requests
-		if !spam.CommandPreHandler(session.Spam, message.Sender.ID, message.Unixtime) {
+		if !throttle(session, sendQueue, "/settings", &message) {
 			return nil
 		}
 
-		ago := time.Now().Unix() - session.Config.Stats.BlockTime
-		slot := humanize.Comma(int64(session.Config.Stats.CurrentSlot))
-		blocksParsed := humanize.Comma(int64(session.Config.Stats.BlocksParsed))
+		text, markup := settingsMenu(session, message.Chat.ID, chatLanguage(session, message.Chat, message.Sender))
+
+		msg := queue.Message{
+			Type:      "telegram",
+			Recipient: message.Chat.ID,
+			Message:   text,
+			Sopts:     tb.SendOptions{ParseMode: "Markdown", ReplyMarkup: markup},
+		}
+
+		queue.AddToQueue(sendQueue, &msg)
+		return nil
+	})
+
+	// Output statistics
+	handle("/stats", func(c tb.Context) error {
+		// Extract message
+		message := *c.Message()
 
-		startedAgo := durafmt.Parse(
-			time.Since(time.Unix(session.Config.Stats.StartTime, 0)),
-		).LimitFirstN(2).String()
+		// Throttle requests
+		if !throttle(session, sendQueue, "/stats", &message) {
+			return nil
+		}
 
-		text := "🔪 *SlashCaster statistics*\n" +
-			fmt.Sprintf("Current slot: %s\n", slot) +
-			fmt.Sprintf("Blocks parsed: %s\n", blocksParsed) +
-			fmt.Sprintf("Last block %d seconds ago\n\n", ago) +
-			fmt.Sprintf("_Bot started %s ago_", startedAgo)
+		lang := chatLanguage(session, message.Chat, message.Sender)
+		text := api.StatsString(api.CollectStats(streamer.Beacon, session.State, sendQueue), api.MarkupTelegram, lang)
 
 		msg := queue.Message{
 			Type:      "telegram",
-			Recipient: message.Sender.ID,
+			Recipient: message.Chat.ID,
 			Message:   text,
 			Sopts:     tb.SendOptions{ParseMode: "Markdown"},
 		}
@@ -84,30 +222,136 @@ func SetupTelegramBot(session *config.Session, sendQueue *queue.SendQueue) {
 		return nil
 	})
 
+	// Validator lookup
+	handle("/validator", func(c tb.Context) error {
+		// Extract message
+		message := *c.Message()
+
+		// Throttle requests
+		if !throttle(session, sendQueue, "/validator", &message) {
+			return nil
+		}
+
+		lang := chatLanguage(session, message.Chat, message.Sender)
+		msg := queue.Message{
+			Type:      "telegram",
+			Recipient: message.Chat.ID,
+			Message:   validatorReply(session, streamer.Beacon, message.Payload, lang),
+			Sopts:     tb.SendOptions{DisableWebPagePreview: true},
+		}
+
+		queue.AddToQueue(sendQueue, &msg)
+		return nil
+	})
+
+	// Recent slashings, and slashing counts over time
+	pagedCommands := map[string]func(session *config.Session, payload string, lang string) (string, *tb.ReplyMarkup){
+		"/last":    lastCommand,
+		"/history": historyCommand,
+	}
+
+	for command, pagedCommand := range pagedCommands {
+		command, pagedCommand := command, pagedCommand
+
+		handle(command, func(c tb.Context) error {
+			// Extract message
+			message := *c.Message()
+
+			// Throttle requests
+			if !throttle(session, sendQueue, command, &message) {
+				return nil
+			}
+
+			text, markup := pagedCommand(session, message.Payload, chatLanguage(session, message.Chat, message.Sender))
+
+			msg := queue.Message{
+				Type:      "telegram",
+				Recipient: message.Chat.ID,
+				Message:   text,
+				Sopts:     tb.SendOptions{ParseMode: "MarkdownV2", DisableWebPagePreview: true, ReplyMarkup: markup},
+			}
+
+			queue.AddToQueue(sendQueue, &msg)
+			return nil
+		})
+	}
+
+	setupPageHandlers(session)
+	setupSettingsHandlers(session)
+
+	// Inline queries, e.g. "@bot last"
+	setupInlineHandler(session, sendQueue, streamer)
+
 	// Subscribe command handler
-	session.Telegram.Handle("/subscribe", func(c tb.Context) error {
+	handle("/subscribe", func(c tb.Context) error {
+		// Extract message
+		message := *c.Message()
+
+		// Throttle requests
+		if !throttle(session, sendQueue, "/subscribe", &message) {
+			return nil
+		}
+
+		// Only admins can subscribe groups
+		if denyNonAdmin(session, sendQueue, &message) {
+			return nil
+		}
+
+		// Subscribe the chat the command was sent in
+		success, err := state.AddSubscriber(session.State, message.Chat.ID)
+		lang := chatLanguage(session, message.Chat, message.Sender)
+
+		var text string
+		if err != nil {
+			text = locale.T(lang, "subscribe.error")
+		} else if success {
+			text = locale.T(lang, "subscribe.success")
+		} else {
+			text = locale.T(lang, "subscribe.already")
+		}
+
+		msg := queue.Message{
+			Type:      "telegram",
+			Recipient: message.Chat.ID,
+			Message:   text,
+			Sopts:     tb.SendOptions{ParseMode: "Markdown"},
+		}
+
+		queue.AddToQueue(sendQueue, &msg)
+		return nil
+	})
+
+	// Delivery mode command handler
+	handle("/digest", func(c tb.Context) error {
 		// Extract message
 		message := *c.Message()
 
 		// Throttle requests
-		if !spam.CommandPreHandler(session.Spam, message.Sender.ID, message.Unixtime) {
+		if !throttle(session, sendQueue, "/digest", &message) {
 			return nil
 		}
 
-		// Subscribe
-		success := config.AddSubscriber(session.Config, message.Sender.ID)
+		lang := chatLanguage(session, message.Chat, message.Sender)
+		prefs := state.GetPreferences(session.State, message.Chat.ID)
+		mode := strings.ToLower(strings.TrimSpace(message.Payload))
+		modes := strings.Join(state.DeliveryModes, ", ")
 
 		var text string
-		if success {
-			text = "✅ Successfully subscribed! You will now be notified of slashings."
+		if mode == "" {
+			text = locale.T(lang, "delivery.current", prefs.Delivery, modes)
+		} else if denyNonAdmin(session, sendQueue, &message) {
+			return nil
+		} else if !state.ValidDeliveryMode(mode) {
+			text = locale.T(lang, "delivery.unknown", modes)
+		} else if err := setDelivery(session, message.Chat.ID, mode); err != nil {
+			text = locale.T(lang, "error.preferences")
 		} else {
-			text = "ℹ️ You are already subscribed to notifications!\n\n" +
-				"_To unsubscribe, use /unsubscribe._"
+			text = locale.T(lang, "delivery.set."+mode)
 		}
 
 		msg := queue.Message{
 			Type:      "telegram",
-			Recipient: message.Sender.ID,
+			Recipient: message.Chat.ID,
 			Message:   text,
 			Sopts:     tb.SendOptions{ParseMode: "Markdown"},
 		}
@@ -116,30 +360,107 @@ func SetupTelegramBot(session *config.Session, sendQueue *queue.SendQueue) {
 		return nil
 	})
 
+	// Language command handler
+	handle("/language", func(c tb.Context) error {
+		// Extract message
+		message := *c.Message()
+
+		// Throttle requests
+		if !throttle(session, sendQueue, "/language", &message) {
+			return nil
+		}
+
+		lang := chatLanguage(session, message.Chat, message.Sender)
+		choice := strings.ToLower(strings.TrimSpace(message.Payload))
+		choices := strings.Join(append([]string{languageAuto}, locale.Languages...), ", ")
+
+		var text string
+		if choice == "" {
+			text = locale.T(lang, "language.current", locale.Name(lang), choices)
+		} else if denyNonAdmin(session, sendQueue, &message) {
+			return nil
+		} else if choice != languageAuto && !locale.Supported(choice) {
+			text = locale.T(lang, "language.unknown", choices)
+		} else if err := setLanguage(session, message.Chat.ID, choice); err != nil {
+			text = locale.T(lang, "error.preferences")
+		} else if choice == languageAuto {
+			text = locale.T(chatLanguage(session, message.Chat, message.Sender), "language.automatic")
+		} else {
+			text = locale.T(choice, "language.set")
+		}
+
+		msg := queue.Message{
+			Type:      "telegram",
+			Recipient: message.Chat.ID,
+			Message:   text,
+			Sopts:     tb.SendOptions{ParseMode: "Markdown"},
+		}
+
+		queue.AddToQueue(sendQueue, &msg)
+		return nil
+	})
+
+	// Watchlist command handlers
+	for _, command := range []string{"/watch", "/unwatch"} {
+		command := command
+		handle(command, func(c tb.Context) error {
+			// Extract message
+			message := *c.Message()
+
+			// Throttle requests
+			if !throttle(session, sendQueue, command, &message) {
+				return nil
+			}
+
+			// Anyone can see the watchlist, only admins can change it
+			if strings.TrimSpace(message.Payload) != "" && denyNonAdmin(session, sendQueue, &message) {
+				return nil
+			}
+
+			lang := chatLanguage(session, message.Chat, message.Sender)
+			msg := queue.Message{
+				Type:      "telegram",
+				Recipient: message.Chat.ID,
+				Message:   watchCommand(session, message.Chat.ID, message.Payload, command == "/watch", lang),
+				Sopts:     tb.SendOptions{ParseMode: "Markdown"},
+			}
+
+			queue.AddToQueue(sendQueue, &msg)
+			return nil
+		})
+	}
+
 	// Unsubscribe command handler
-	session.Telegram.Handle("/unsubscribe", func(c tb.Context) error {
+	handle("/unsubscribe", func(c tb.Context) error {
 		// Extract message
 		message := *c.Message()
 
 		// Throttle requests
-		if !spam.CommandPreHandler(session.Spam, message.Sender.ID, message.Unixtime) {
+		if !throttle(session, sendQueue, "/unsubscribe", &message) {
+			return nil
+		}
+
+		// Only admins can unsubscribe groups
+		if denyNonAdmin(session, sendQueue, &message) {
 			return nil
 		}
 
-		// Unsubscribe
-		success := config.RemoveSubscriber(session.Config, message.Sender.ID)
+		// Unsubscribe the chat the command was sent in
+		success, err := state.RemoveSubscriber(session.State, message.Chat.ID)
+		lang := chatLanguage(session, message.Chat, message.Sender)
 
 		var text string
-		if success {
-			text = "✅ Successfully unsubscribed! No notifications will be sent to you."
+		if err != nil {
+			text = locale.T(lang, "unsubscribe.error")
+		} else if success {
+			text = locale.T(lang, "unsubscribe.success")
 		} else {
-			text = "ℹ️Nothing to do, you will not receive notifications!\n\n" +
-				"_To receive notifications, use /subscribe._"
+			text = locale.T(lang, "unsubscribe.nothing")
 		}
 
 		msg := queue.Message{
 			Type:      "telegram",
-			Recipient: message.Sender.ID,
+			Recipient: message.Chat.ID,
 			Message:   text,
 			Sopts:     tb.SendOptions{ParseMode: "Markdown"},
 		}
@@ -147,4 +468,40 @@ func SetupTelegramBot(session *config.Session, sendQueue *queue.SendQueue) {
 		queue.AddToQueue(sendQueue, &msg)
 		return nil
 	})
+
+	// Route commands posted in channels to their handlers
+	session.Telegram.Handle(tb.OnChannelPost, func(c tb.Context) error {
+		command, ok := channelCommand(c.Message(), session.Telegram.Me.Username)
+		if handler, found := commands[command]; ok && found {
+			return handler(c)
+		}
+
+		return nil
+	})
+
+	// Groups upgraded to supergroups get a new chat ID: move the chat's subscription
+	session.Telegram.Handle(tb.OnMigration, func(c tb.Context) error {
+		from, to := c.Migration()
+
+		if migrated, err := state.MigrateChat(session.State, from, to); err != nil {
+			log.Println("Error migrating chat:", err)
+		} else if migrated {
+			log.Printf("Chat %d migrated to %d", from, to)
+		}
+
+		return nil
+	})
+
+	// Owner commands
+	setupAdminHandlers(session, sendQueue, streamer)
+}
+
+func RunTelegramBot(ctx context.Context, session *config.Session) {
+	/* Polls Telegram for updates until ctx is cancelled */
+	go func() {
+		<-ctx.Done()
+		session.Telegram.Stop()
+	}()
+
+	session.Telegram.Start()
 }
@@ -0,0 +1,32 @@
+package bots
+
+import (
+	"errors"
+	"log"
+	"slashcaster/api"
+	"slashcaster/config"
+	"slashcaster/locale"
+	"strings"
+	"time"
+)
+
+func validatorReply(session *config.Session, beacon *api.BeaconClient, id string, lang string) string {
+	/* Looks up a validator for the /validator command, on Telegram and Discord */
+	if strings.TrimSpace(id) == "" {
+		return locale.T(lang, "validator.usage")
+	}
+
+	report, err := api.LookupValidator(beacon, session.State, id)
+
+	switch {
+	case errors.Is(err, api.ErrInvalidValidator):
+		return locale.T(lang, "validator.invalid") + "\n\n" + locale.T(lang, "validator.usage")
+	case errors.Is(err, api.ErrUnknownValidator):
+		return locale.T(lang, "validator.unknown", strings.TrimSpace(id))
+	case err != nil:
+		log.Println("Error looking up validator:", err)
+		return locale.T(lang, "validator.error")
+	}
+
+	return api.ValidatorString(report, time.Now().Unix(), lang)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"slashcaster/api"
+	"slashcaster/bots"
+	"slashcaster/config"
+)
+
+type checkReport struct {
+	/* Results of a config check */
+	problems int
+}
+
+func (report *checkReport) ok(format string, args ...interface{}) {
+	fmt.Printf("  ✅ "+format+"\n", args...)
+}
+
+func (report *checkReport) skip(format string, args ...interface{}) {
+	fmt.Printf("  ➖ "+format+"\n", args...)
+}
+
+func (report *checkReport) fail(format string, args ...interface{}) {
+	fmt.Printf("  ❌ "+format+"\n", args...)
+	report.problems++
+}
+
+func runConfigCheck(options config.Options) int {
+	/*
+		Loads and validates the config like the bot would, then verifies the
+		beacon endpoint and bot tokens against their APIs. Prints a report, and
+		returns the exit code: non-zero if any problems were found. Nothing is
+		written: an outdated config is migrated in memory only.
+	*/
+	options.Interactive = false
+	options.DryRun = true
+	report := checkReport{}
+
+	conf, err := config.Load(options)
+	errs, invalid := err.(config.ValidationErrors)
+	if err != nil && !invalid {
+		fmt.Printf("❌ Loading config failed: %s\n", err)
+		return 1
+	}
+
+	fmt.Printf("🔎 Checking config (schema version %d)\n", conf.SchemaVersion)
+
+	if from, pending := config.PendingMigration(conf); pending {
+		report.skip("Config file is at schema version %d: it is migrated when the bot starts", from)
+	}
+
+	// Field validation: formats and limits
+	if len(errs) == 0 {
+		report.ok("All fields valid (RateLimit=%d/s, ChatRateLimit=%d/s, GroupRateLimit=%d/min)",
+			conf.RateLimit, conf.ChatRateLimit, conf.GroupRateLimit)
+	}
+
+	for _, err := range errs {
+		report.fail("%s", err)
+	}
+
+	// Beacon endpoint
+	if conf.Tokens.Infura == "" {
+		report.skip("Beacon endpoint: not configured")
+	} else if head, err := api.CheckEndpoint(conf); err != nil {
+		report.fail("Beacon endpoint: unreachable: %s", err)
+	} else {
+		report.ok("Beacon endpoint: reachable, head at slot %s", head)
+	}
+
+	// Telegram, against the configured Bot API server
+	if conf.Tokens.Telegram == "" {
+		report.skip("Telegram: not configured")
+	} else if username, err := bots.CheckTelegram(conf); err != nil {
+		report.fail("Telegram: getMe failed: %s", err)
+	} else {
+		report.ok("Telegram: authorized as @%s", username)
+	}
+
+	// Discord is optional
+	if conf.Tokens.Discord == "" {
+		report.skip("Discord: not configured")
+	} else if username, err := bots.CheckDiscord(conf); err != nil {
+		report.fail("Discord: invalid token: %s", err)
+	} else {
+		report.ok("Discord: authorized as %s", username)
+	}
+
+	if report.problems != 0 {
+		fmt.Printf("⚠️ %d problem(s) found\n", report.problems)
+		return 1
+	}
+
+	fmt.Println("👍 Config OK")
+	return 0
+}
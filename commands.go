@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slashcaster/config"
+	"slashcaster/state"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func fail(format string, args ...interface{}) int {
+	fmt.Fprintf(os.Stderr, "⚠️ "+format+"\n", args...)
+	return 1
+}
+
+func runCommand(args []string, options config.Options) int {
+	/* Runs a command given on the command line, returns the exit code */
+	options.Interactive = false
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC822Z}).Level(zerolog.WarnLevel)
+
+	command := args[0]
+	if len(args) > 1 {
+		command += " " + args[1]
+	}
+
+	switch command {
+	case "config check":
+		// Validate the config, check tokens and endpoints
+		return runConfigCheck(options)
+	case "config genkey":
+		// Generate a key for encrypting tokens
+		key, err := config.GenerateKey()
+		if err != nil {
+			return fail("Error generating key: %s", err)
+		}
+
+		fmt.Println(key)
+		return 0
+	case "config encrypt":
+		// Encrypt the tokens in the config file
+		if err := config.EncryptFile(options); err != nil {
+			return fail("Error encrypting tokens: %s", err)
+		}
+
+		fmt.Println("🔐 Tokens encrypted")
+		return 0
+	case "state migrate":
+		// Copy JSON state to the configured SQL backend
+		conf, err := config.Load(options)
+		if err != nil {
+			return fail("Error loading config: %s", err)
+		}
+
+		// The running bot would keep writing the old storage
+		unlock, err := state.Lock(config.Dir(conf))
+		if errors.Is(err, state.ErrLocked) {
+			return fail("%s: stop the bot first, then migrate", err)
+		} else if err != nil {
+			return fail("Error locking state: %s", err)
+		}
+
+		defer unlock()
+
+		copied, err := config.MigrateStorage(conf)
+		if err != nil {
+			return fail("Error migrating state: %s", err)
+		}
+
+		fmt.Printf("📦 Migrated state of %d subscriber(s) to %s storage\n", copied, conf.Storage)
+		return 0
+	}
+
+	switch args[0] {
+	case "export":
+		return runExport(args[1:], options)
+	case "import":
+		return runImport(args[1:], options)
+	}
+
+	return fail("Unknown command: %s", strings.Join(args, " "))
+}
+
+func archiveFormat(format string, path string) string {
+	// The format defaults to the file's extension, JSON for stdin and stdout
+	if format != "" {
+		return format
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return state.FormatCSV
+	}
+
+	return state.FormatJSON
+}
+
+func runExport(args []string, options config.Options) int {
+	/* export [--format json|csv] <file|-> */
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", "", "Archive format: json or csv (default: from the file extension)")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fail("Usage: slashcaster export [--format json|csv] <file|->")
+	}
+
+	// Read-only: the bot may be running
+	options.DryRun = true
+	conf, err := config.Load(options)
+	if err != nil {
+		return fail("Error loading config: %s", err)
+	}
+
+	// Pre-1.5 configs hold the state until they're migrated
+	if from, pending := config.PendingMigration(conf); pending {
+		return fail("Config file is at schema version %d: start the bot once to migrate it, then export", from)
+	}
+
+	backend, err := config.StorageBackend(conf)
+	if err != nil {
+		return fail("Error opening storage: %s", err)
+	}
+
+	defer backend.Close()
+
+	loaded, err := backend.Load()
+	if err != nil {
+		return fail("Error loading state: %s", err)
+	}
+
+	archive, err := state.Export(&state.Store{State: loaded})
+	if err != nil {
+		return fail("Error exporting state: %s", err)
+	}
+
+	var out io.Writer = os.Stdout
+	if path := flags.Arg(0); path != "-" {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return fail("Error creating archive: %s", err)
+		}
+
+		defer file.Close()
+		out = file
+	}
+
+	if err = state.WriteArchive(out, archive, archiveFormat(*format, flags.Arg(0))); err != nil {
+		return fail("Error writing archive: %s", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "📦 Exported %d subscriber(s)\n", len(archive.Subscribers))
+	return 0
+}
+
+func runImport(args []string, options config.Options) int {
+	/* import [--replace] [--format json|csv] <file|-> */
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	format := flags.String("format", "", "Archive format: json or csv (default: from the file extension)")
+	replace := flags.Bool("replace", false, "Replace the current subscribers, preferences and history instead of merging")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fail("Usage: slashcaster import [--replace] [--format json|csv] <file|->")
+	}
+
+	var in io.Reader = os.Stdin
+	if path := flags.Arg(0); path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return fail("Error opening archive: %s", err)
+		}
+
+		defer file.Close()
+		in = file
+	}
+
+	archive, err := state.ReadArchive(in, archiveFormat(*format, flags.Arg(0)))
+	if err != nil {
+		return fail("Error reading archive: %s", err)
+	}
+
+	conf, err := config.Load(options)
+	if err != nil {
+		return fail("Error loading config: %s", err)
+	}
+
+	// A running bot would overwrite the import with the state it holds in memory
+	unlock, err := state.Lock(config.Dir(conf))
+	if errors.Is(err, state.ErrLocked) {
+		return fail("%s: stop the bot first, then import", err)
+	} else if err != nil {
+		return fail("Error locking state: %s", err)
+	}
+
+	defer unlock()
+
+	store, err := config.OpenState(conf)
+	if err != nil {
+		return fail("Error loading state: %s", err)
+	}
+
+	defer state.Close(store)
+
+	mode := state.ImportMerge
+	if *replace {
+		mode = state.ImportReplace
+	}
+
+	result, err := state.Import(store, archive, mode)
+	if err != nil {
+		return fail("Error importing archive: %s", err)
+	}
+
+	fmt.Printf("📦 Imported archive (%s): %d subscriber(s) added, %d duplicate(s) skipped, %d preference(s), %d history record(s)\n",
+		mode, result.Added, result.Duplicates, result.Preferences, result.Records)
+	return 0
+}
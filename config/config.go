@@ -4,37 +4,64 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
+	"slashcaster/persist"
 	"slashcaster/spam"
+	"slashcaster/state"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/rs/zerolog/log"
 
 	dg "github.com/bwmarrin/discordgo"
+	"golang.org/x/term"
 	tb "gopkg.in/telebot.v3"
 )
 
 type Session struct {
 	Config   *Config
+	State    *state.Store
 	Spam     *spam.AntiSpam
 	Discord  *dg.Session
 	Telegram *tb.Bot
 }
 
 type Config struct {
-	Version   string     // Version number
-	Debug     bool       // Is debugging enabled?
-	NoStream  bool       // Skip slot streaming?
-	LogPath   string     // Folder to log to
-	RateLimit int        // Rate-limit, messages/second
-	Tokens    Tokens     // Tokens for auth
-	Stats     Stats      // Statistics
-	Broadcast Broadcast  // Channels we broadcast to
-	Mutex     sync.Mutex // Mutex to avoid concurrent writes
+	/* Operator configuration: runtime state is kept in the state store */
+	SchemaVersion   int         // Version of the config file's schema, see migrate.go
+	Version         string      // Version number
+	Debug           bool        // Is debugging enabled?
+	NoStream        bool        // Skip slot streaming?
+	LogPath         string      // Folder to log to
+	RateLimit       int         // Rate-limit, messages/second across all chats
+	ChatRateLimit   int         // Rate-limit, messages/second to a single chat
+	GroupRateLimit  int         // Rate-limit, messages/minute to a single group
+	Backups         int         // Count of rotating backups kept of config and state files, state rotating at most hourly
+	StateDir        string      // Folder for runtime state, defaults to the config's folder
+	TelegramAPI     string      // Telegram Bot API base URL, defaults to https://api.telegram.org
+	Storage         string      // Storage backend for runtime state: json (default), sqlite or postgres
+	StorageDSN      string      // SQLite database file or PostgreSQL connection string
+	Tokens          Tokens      // Tokens for auth, only written to disk if no key is set
+	EncryptedTokens string      `json:",omitempty"` // Tokens, encrypted with the key from SLASHCASTER_SECRET_KEY
+	Broadcast       Broadcast   // Channels we broadcast to
+	Templates       Templates   // Alert templates and formats
+	Spam            spam.Limits // Command rate-limits: per user, per group and per command
+	Mutex           sync.Mutex  `json:"-"` // Mutex to avoid concurrent writes
+	file            string      // File the config was loaded from
+	key             *[32]byte   // Key for EncryptedTokens, nil if none is set
+	pending         bool        // Was the file migrated in memory only? See Options.DryRun
+	pendingFrom     int         // Schema version of the file, if pending
+}
+
+type Options struct {
+	/* Where and how the config is loaded */
+	ConfigFile  string // Path of the config file, defaults to ./config/bot-config.json
+	StateDir    string // Folder for runtime state, overrides the config and environment
+	Interactive bool   // Prompt for missing tokens on stdin?
+	DryRun      bool   // Never write: migrations are applied in memory only, e.g. for checks
+	Debug       bool   // Enable debugging, regardless of the config
+	NoStream    bool   // Disable slot streaming, regardless of the config
 }
 
 type Tokens struct {
@@ -43,213 +70,282 @@ type Tokens struct {
 	Discord  string // Discord bot token
 }
 
-type Stats struct {
-	StartTime     int64  // Unix timestamp of startup time
-	CurrentSlot   int64  // Current slot
-	BlockTime     int64  // Current block time
-	BlocksParsed  uint64 // Count of blocks parsed
-	AttSlashings  int    // Keep track of observed slashings
-	PropSlashings int    // Keep track of observed slashings
-	LastSlashing  int64  // Timestamp to keep track of last slashing
-	MessagesSent  int    // Keep track of converted images
-}
-
 type Broadcast struct {
-	TelegramOwner       int64   // Owner of the bot: skips logging
-	TelegramChannel     int64   // The channel the bot broadcasts in
-	TelegramSubscribers []int64 // Telegram subscribers
-	DiscordGuild        string
+	TelegramOwner   int64 // Owner of the bot: skips logging
+	TelegramChannel int64 // The channel the bot broadcasts in
+	DiscordGuild    string
+	DiscordChannel  string // Discord channel slashings are broadcast to as embeds
 }
 
-func SlashingObserved(config *Config, attCount int, propCount int, time int64) {
-	// Lock struct
-	config.Mutex.Lock()
-
-	// Update stats
-	config.Stats.AttSlashings += attCount
-	config.Stats.PropSlashings += propCount
-	config.Stats.LastSlashing = time
-	config.Stats.MessagesSent++
-
-	// Unlock
-	config.Mutex.Unlock()
-
-	// Dump config now to avoid possible data loss
-	DumpConfig(config)
+type Templates struct {
+	Dir      string // Folder with templates overriding the built-in ones, see readme
+	Telegram string // Format of Telegram alerts: markdownv2 (default), html or plain
 }
 
-func AddSubscriber(config *Config, chatId int64) bool {
-	// Lock struct
-	config.Mutex.Lock()
+// Default config file, relative to the working directory
+var defaultConfigFile = filepath.Join("config", "bot-config.json")
 
-	// Update config with ID
-	subs := config.Broadcast.TelegramSubscribers
+func configPath(options Options) string {
+	// Path of the config file, defaulting to ./config/bot-config.json
+	if options.ConfigFile != "" {
+		return options.ConfigFile
+	}
 
-	// Find index
-	index := -1
+	wd, _ := os.Getwd()
+	return filepath.Join(wd, defaultConfigFile)
+}
 
-	for i, id := range subs {
-		if id == chatId {
-			index = i
-			break
-		}
+func Dir(config *Config) string {
+	/* Returns the folder runtime state is stored in */
+	if config.StateDir != "" {
+		return config.StateDir
 	}
 
-	if index == -1 {
-		// Update config with ID
-		config.Broadcast.TelegramSubscribers = append(config.Broadcast.TelegramSubscribers, chatId)
-	} else {
-		// Unlock
-		config.Mutex.Unlock()
-
-		return false
+	if config.file == "" {
+		wd, _ := os.Getwd()
+		return filepath.Join(wd, "config")
 	}
 
-	// Unlock
-	config.Mutex.Unlock()
+	return filepath.Dir(config.file)
+}
 
-	// Dump config now to avoid possible data loss
-	DumpConfig(config)
+func Endpoint(config *Config) string {
+	/* Returns the beacon API endpoint, which may change on reload */
+	config.Mutex.Lock()
+	defer config.Mutex.Unlock()
 
-	return true
+	return config.Tokens.Infura
 }
 
-func RemoveSubscriber(config *Config, chatId int64) bool {
-	// Lock struct
-	config.Mutex.Lock()
+func StatePath(config *Config, name string) string {
+	/* Returns the path of a runtime state file */
+	return filepath.Join(Dir(config), name)
+}
 
-	// Update config with ID
-	subs := config.Broadcast.TelegramSubscribers
+func IsTerminal(file *os.File) bool {
+	/* Is file an interactive terminal? Other character devices, like /dev/null, are not */
+	return term.IsTerminal(int(file.Fd()))
+}
 
-	// Find index
-	index := -1
+func defaultConfig() Config {
+	return Config{
+		SchemaVersion:  SchemaVersion,
+		LogPath:        "logs",
+		RateLimit:      30,
+		ChatRateLimit:  1,
+		GroupRateLimit: 20,
+		Backups:        persist.DefaultBackups,
+		Spam:           defaultSpamLimits(),
+	}
+}
 
-	for i, id := range subs {
-		if id == chatId {
-			index = i
-			break
-		}
+func defaultSpamLimits() spam.Limits {
+	// Copy the default limits: loading the config must not modify them
+	limits := spam.DefaultLimits
+	limits.Commands = make(map[string]spam.Rule, len(spam.DefaultLimits.Commands))
+
+	for command, rule := range spam.DefaultLimits.Commands {
+		limits.Commands[command] = rule
 	}
 
-	if index != -1 {
-		// Index mangling
-		subs[index] = subs[len(subs)-1]
-		subs = subs[:len(subs)-1]
+	return limits
+}
 
-		// Update to new list
-		config.Broadcast.TelegramSubscribers = subs
-	} else {
-		// Unlock
-		config.Mutex.Unlock()
+func prompt(reader *bufio.Reader, text string) string {
+	fmt.Print(text)
+	inp, _ := reader.ReadString('\n')
+	return strings.TrimSpace(inp)
+}
 
-		return false
+func marshalConfig(config *Config) ([]byte, error) {
+	// Marshal the config for disk, with tokens encrypted if a key is set
+	if config.key == nil {
+		return json.MarshalIndent(config, "", "\t")
 	}
 
-	// Unlock
-	config.Mutex.Unlock()
+	encrypted, err := encryptTokens(config.Tokens, config.key)
+	if err != nil {
+		return nil, err
+	}
 
-	// Dump config now to avoid possible data loss
-	DumpConfig(config)
+	tokens := config.Tokens
+	config.Tokens, config.EncryptedTokens = Tokens{}, encrypted
+	defer func() { config.Tokens = tokens }()
 
-	return true
+	return json.MarshalIndent(config, "", "\t")
 }
 
 func DumpConfig(config *Config) {
-	// Dumps config to disk
-	jsonbytes, err := json.MarshalIndent(config, "", "\t")
+	// Take a consistent snapshot of the config
+	config.Mutex.Lock()
+	jsonbytes, err := marshalConfig(config)
+	backups := config.Backups
+	config.Mutex.Unlock()
 
 	if err != nil {
 		log.Error().Err(err).Msg("⚠️ Error marshaling json")
+		return
 	}
 
-	wd, _ := os.Getwd()
-	configf := filepath.Join(wd, "config", "bot-config.json")
-
-	file, err := os.Create(configf)
+	// Atomically replace the config file on disk
+	err = persist.WriteFile(config.file, jsonbytes, backups)
 	if err != nil {
-		log.Error().Err(err)
-		os.Exit(1)
+		log.Error().Err(err).Msg("⚠️ Dumping config failed")
 	}
+}
 
-	// Write, close
-	_, err = file.Write(jsonbytes)
-	if err != nil {
-		log.Error().Err(err).Msg("Dumping config failed")
+func Load(options Options) (*Config, error) {
+	/*
+		Loads the config file, applies SLASHCASTER_* environment overrides and
+		validates the result. If no config file exists, one is created: tokens
+		missing from the environment are prompted for if running interactively,
+		otherwise loading fails with validation errors. On validation errors, the
+		invalid config is returned along with the errors, e.g. for reporting.
+	*/
+	configFile := configPath(options)
+
+	// Load the config, falling back to a backup if it is damaged
+	var original []byte
+	_, err := persist.ReadFile(configFile, persist.DefaultBackups, func(data []byte) error {
+		var raw map[string]interface{}
+		original = data
+		return json.Unmarshal(data, &raw)
+	})
+
+	created := os.IsNotExist(err)
+	if err != nil && !created {
+		return nil, err
 	}
 
-	file.Close()
-}
+	config := defaultConfig()
+	if !created {
+		if err = loadMigrated(&config, configFile, original, options); err != nil {
+			return nil, err
+		}
+	}
 
-func LoadConfig(cfgPath string) *Config {
-	/* Loads the config, returns a pointer to it */
+	// Tokens are only ever decrypted in memory
+	if err = decryptConfig(&config); err != nil {
+		return nil, err
+	}
 
-	// Get log file's path relative to working dir
-	var configPath string
-	if cfgPath == "" {
-		wd, _ := os.Getwd()
-		configPath = filepath.Join(wd, "config")
-	} else {
-		configPath = cfgPath
+	config.file = configFile
+
+	// Environment overrides the file
+	applied, err := ApplyEnv(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(applied) != 0 {
+		log.Debug().Msgf("Config overridden from environment: %s", strings.Join(applied, ", "))
+	}
+
+	if options.StateDir != "" {
+		config.StateDir = options.StateDir
 	}
 
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		_ = os.Mkdir(configPath, os.ModePerm)
+	// Flags can enable, but not disable these
+	config.Debug = config.Debug || options.Debug
+	config.NoStream = config.NoStream || options.NoStream
+
+	if config.Backups == 0 {
+		config.Backups = persist.DefaultBackups
 	}
 
-	configf := filepath.Join(configPath, "bot-config.json")
-	if _, err := os.Stat(configf); os.IsNotExist(err) {
-		// Config doesn't exist: create
-		fmt.Print("\nEnter bot API key: ")
+	if created {
+		if !options.Interactive {
+			// Nothing to prompt with: the environment must provide everything
+			if errs := Validate(&config); len(errs) != 0 {
+				return &config, errs
+			}
+
+			return &config, nil
+		}
+
+		// Config doesn't exist: create, prompting for tokens not in the environment
 		reader := bufio.NewReader(os.Stdin)
-		inp, _ := reader.ReadString('\n')
-		tgBotToken := strings.TrimSuffix(inp, "\n")
-
-		fmt.Print("\nEnter Infura API key: ")
-		reader = bufio.NewReader(os.Stdin)
-		inp, _ = reader.ReadString('\n')
-		infuraToken := strings.TrimSuffix(inp, "\n")
-
-		// Create config
-		config := Config{
-			LogPath:   "logs",
-			RateLimit: 5,
-
-			Tokens: Tokens{
-				Telegram: tgBotToken,
-				Infura:   infuraToken,
-			},
-
-			Stats: Stats{
-				StartTime: time.Now().Unix(),
-			},
+		if config.Tokens.Telegram == "" {
+			config.Tokens.Telegram = prompt(reader, "\nEnter bot API key: ")
+		}
+
+		if config.Tokens.Infura == "" {
+			config.Tokens.Infura = prompt(reader, "\nEnter Infura API key: ")
 		}
 
-		// Dump config
-		go DumpConfig(&config)
+		if errs := Validate(&config); len(errs) != 0 {
+			return &config, errs
+		}
 
+		if err = os.MkdirAll(filepath.Dir(configFile), os.ModePerm); err != nil {
+			return nil, err
+		}
+
+		DumpConfig(&config)
 		fmt.Println("Config created! Transitioning to logging...")
-		return &config
+
+		return &config, nil
 	}
 
-	// Config exists: load
-	fbytes, err := ioutil.ReadFile(configf)
+	if errs := Validate(&config); len(errs) != 0 {
+		return &config, errs
+	}
+
+	return &config, nil
+}
+
+func loadMigrated(config *Config, configFile string, original []byte, options Options) error {
+	// Upgrade the file to the current schema, keeping a copy of the original
+	ctx := migrationContext{StateDir: options.StateDir, Backups: persist.DefaultBackups, DryRun: options.DryRun}
+	if ctx.StateDir == "" {
+		if dir, ok, _ := lookupEnv(envPrefix + envName("StateDir")); ok && dir != "" {
+			ctx.StateDir = dir
+		} else {
+			ctx.StateDir = filepath.Dir(configFile)
+		}
+	}
+
+	migrated, from, err := Migrate(original, ctx)
 	if err != nil {
-		log.Error().Err(err).Msg("⚠️ Error reading config file")
-		os.Exit(1)
+		return err
 	}
 
-	// New config struct
-	var config Config
+	if from != SchemaVersion && options.DryRun {
+		// Neither the config nor state is written: the file is migrated on the next start
+		config.pending, config.pendingFrom = true, from
+	} else if from != SchemaVersion {
+		log.Info().Msgf("📦 Migrated config from schema version %d to %d", from, SchemaVersion)
 
-	// Unmarshal into our config struct
-	err = json.Unmarshal(fbytes, &config)
+		// The config may be mounted read-only: the migrated config is still used
+		if err = saveMigrated(configFile, original, migrated, from, persist.DefaultBackups); err != nil {
+			log.Warn().Err(err).Msg("⚠️ Saving migrated config failed")
+		}
+	}
+
+	return json.Unmarshal(migrated, config)
+}
+
+func PendingMigration(config *Config) (int, bool) {
+	/*
+		Returns the schema version of a config file that was loaded with
+		Options.DryRun and still has to be migrated. Until it is, runtime state
+		in a pre-1.5 file has not been moved to the state store.
+	*/
+	return config.pendingFrom, config.pending
+}
+
+func LoadConfig(cfgPath string) *Config {
+	/* Loads the config from the folder cfgPath interactively, exits on errors */
+	var configFile string
+	if cfgPath != "" {
+		configFile = filepath.Join(cfgPath, "bot-config.json")
+	}
+
+	config, err := Load(Options{ConfigFile: configFile, Interactive: IsTerminal(os.Stdin)})
 	if err != nil {
-		log.Error().Err(err).Msg("⚠️ Error unmarshaling config json")
+		log.Error().Err(err).Msg("⚠️ Error loading config")
 		os.Exit(1)
 	}
 
-	// Set startup time
-	config.Stats.StartTime = time.Now().Unix()
-
-	return &config
+	return config
 }
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// A syntactically valid bot token
+const testTelegramToken = "123456789:AAHdqTcvCH1vGWJxfSeofSAs0K5PALDsawq"
+
+func TestEnvName(t *testing.T) {
+	names := map[string]string{
+		"RateLimit":       "RATE_LIMIT",
+		"TelegramOwner":   "TELEGRAM_OWNER",
+		"LogPath":         "LOG_PATH",
+		"Debug":           "DEBUG",
+		"BeaconAPIURL":    "BEACON_APIURL",
+		"TelegramAPIBase": "TELEGRAM_API_BASE",
+	}
+
+	for field, expected := range names {
+		if name := envName(field); name != expected {
+			t.Errorf("Expected %s to map to %s, got %s", field, expected, name)
+		}
+	}
+}
+
+func TestLoadFromEnvironment(t *testing.T) {
+	dir := t.TempDir()
+
+	// Secrets can be read from files, e.g. Docker secrets
+	secretFile := filepath.Join(dir, "telegram-token")
+	if err := os.WriteFile(secretFile, []byte(testTelegramToken+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("SLASHCASTER_TOKENS_TELEGRAM_FILE", secretFile)
+	t.Setenv("SLASHCASTER_TOKENS_INFURA", "https://beacon.example.com")
+	t.Setenv("SLASHCASTER_RATE_LIMIT", "10")
+	t.Setenv("SLASHCASTER_BROADCAST_TELEGRAM_CHANNEL", "-1001234")
+	t.Setenv("SLASHCASTER_SPAM_USER_RATE", "40")
+	t.Setenv("SLASHCASTER_SPAM_COMMANDS", `{"/history": {"Rate": 2, "Burst": 1}}`)
+
+	config, err := Load(Options{ConfigFile: filepath.Join(dir, "bot-config.json"), StateDir: filepath.Join(dir, "state")})
+	if err != nil {
+		t.Fatalf("Loading config from environment failed: %v", err)
+	}
+
+	if config.Tokens.Telegram != testTelegramToken {
+		t.Errorf("Expected token to be read from file, got %q", config.Tokens.Telegram)
+	}
+
+	if config.RateLimit != 10 || config.Broadcast.TelegramChannel != -1001234 {
+		t.Errorf("Expected overrides to apply, got RateLimit=%d TelegramChannel=%d",
+			config.RateLimit, config.Broadcast.TelegramChannel)
+	}
+
+	if config.Spam.User.Rate != 40 || config.Spam.Commands["/history"].Burst != 1 {
+		t.Errorf("Expected spam limits to be overridden, got %+v", config.Spam)
+	}
+
+	if Dir(config) != filepath.Join(dir, "state") {
+		t.Errorf("Expected state dir to be set from options, got %s", Dir(config))
+	}
+
+	// Non-interactive loading never writes a config file
+	if _, err = os.Stat(filepath.Join(dir, "bot-config.json")); !os.IsNotExist(err) {
+		t.Errorf("Expected no config file to be created")
+	}
+}
+
+func TestLoadNonInteractiveFailsValidation(t *testing.T) {
+	t.Setenv("SLASHCASTER_RATE_LIMIT", "0")
+
+	_, err := Load(Options{ConfigFile: filepath.Join(t.TempDir(), "bot-config.json")})
+	errs, ok := err.(ValidationErrors)
+
+	if !ok {
+		t.Fatalf("Expected validation errors, got %v", err)
+	}
+
+	// Telegram token, Infura endpoint, rate-limit
+	if len(errs) != 3 {
+		t.Fatalf("Expected 3 validation errors, got %d: %v", len(errs), errs)
+	}
+}
+
+func TestValidateTemplates(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "html"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "html", "dm.tmpl"), []byte("{{end}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := defaultConfig()
+	config.Tokens = Tokens{Telegram: testTelegramToken, Infura: "https://beacon.example.com"}
+	config.Templates = Templates{Dir: dir, Telegram: "markdown"}
+	config.Broadcast.DiscordChannel = "#slashings"
+
+	// Template folder, Telegram format, Discord channel and its missing token
+	if errs := Validate(&config); len(errs) != 4 {
+		t.Fatalf("Expected 4 validation errors, got %d: %v", len(errs), errs)
+	}
+
+	config.Templates = Templates{Telegram: "html"}
+	config.Broadcast.DiscordChannel = "1234567890"
+	config.Tokens.Discord = "discord-token"
+	if errs := Validate(&config); len(errs) != 0 {
+		t.Fatalf("Expected no validation errors, got %v", errs)
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	// /dev/null is a character device, but not a terminal
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Skip(err)
+	}
+
+	defer devNull.Close()
+
+	if IsTerminal(devNull) {
+		t.Errorf("Expected %s not to be a terminal", os.DevNull)
+	}
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Prefix of environment variables overriding config fields
+const envPrefix = "SLASHCASTER_"
+
+// Suffix of environment variables naming a file to read a value from, e.g. Docker secrets
+const envFileSuffix = "_FILE"
+
+// Fields that are set at runtime, never from the environment
+var envSkipped = map[string]bool{"Version": true, "SchemaVersion": true}
+
+func envName(field string) string {
+	// Convert a CamelCase field name to SNAKE_CASE, e.g. RateLimit -> RATE_LIMIT
+	var name strings.Builder
+	runes := []rune(field)
+
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			// Word boundary, unless within an acronym
+			if unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				name.WriteRune('_')
+			}
+		}
+
+		name.WriteRune(unicode.ToUpper(r))
+	}
+
+	return name.String()
+}
+
+func lookupEnv(name string) (string, bool, error) {
+	/* Looks up name, or reads the file named by name_FILE */
+	if value, ok := os.LookupEnv(name); ok {
+		return value, true, nil
+	}
+
+	path, ok := os.LookupEnv(name + envFileSuffix)
+	if !ok {
+		return "", false, nil
+	}
+
+	fbytes, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("%s%s: %w", name, envFileSuffix, err)
+	}
+
+	return strings.TrimSpace(string(fbytes)), true, nil
+}
+
+func setField(field reflect.Value, value string) error {
+	// Parse value into field according to its kind
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+
+		field.SetBool(parsed)
+	case reflect.Int, reflect.Int64:
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+
+		field.SetInt(parsed)
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+
+		field.SetFloat(parsed)
+	case reflect.Map, reflect.Slice:
+		// Replaced as a whole, e.g. SLASHCASTER_SPAM_COMMANDS='{"/history": {"Rate": 2, "Burst": 1}}'
+		parsed := reflect.New(field.Type())
+		if err := json.Unmarshal([]byte(value), parsed.Interface()); err != nil {
+			return err
+		}
+
+		field.Set(parsed.Elem())
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+
+	return nil
+}
+
+func applyEnv(value reflect.Value, prefix string) ([]string, error) {
+	// Walk the struct, overriding fields from the environment. Returns the variables applied.
+	var applied []string
+
+	for i := 0; i < value.NumField(); i++ {
+		fieldType := value.Type().Field(i)
+		field := value.Field(i)
+
+		// Fields that aren't stored in the config, e.g. its mutex
+		if !fieldType.IsExported() || envSkipped[fieldType.Name] || fieldType.Tag.Get("json") == "-" {
+			continue
+		}
+
+		name := prefix + envName(fieldType.Name)
+
+		// Nested config sections, e.g. Tokens -> SLASHCASTER_TOKENS_TELEGRAM, Spam -> SLASHCASTER_SPAM_USER_RATE
+		if field.Kind() == reflect.Struct {
+			nested, err := applyEnv(field, name+"_")
+			if err != nil {
+				return applied, err
+			}
+
+			applied = append(applied, nested...)
+			continue
+		}
+
+		raw, ok, err := lookupEnv(name)
+		if err != nil {
+			return applied, err
+		} else if !ok {
+			continue
+		}
+
+		if err = setField(field, raw); err != nil {
+			return applied, fmt.Errorf("%s: %w", name, err)
+		}
+
+		applied = append(applied, name)
+	}
+
+	return applied, nil
+}
+
+func ApplyEnv(config *Config) ([]string, error) {
+	/*
+		Overrides config fields from SLASHCASTER_* environment variables, named
+		after the field path, e.g. SLASHCASTER_RATE_LIMIT or
+		SLASHCASTER_TOKENS_TELEGRAM. Maps and lists are given as JSON. Any
+		variable can instead be read from a file by appending _FILE to its name.
+		Returns the names of the variables applied.
+	*/
+	return applyEnv(reflect.ValueOf(config).Elem(), envPrefix)
+}
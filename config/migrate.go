@@ -0,0 +1,137 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"slashcaster/persist"
+	"slashcaster/state"
+)
+
+// Schema version written by this version of the bot
+const SchemaVersion = 2
+
+type migrationContext struct {
+	/* Where a migration may move data that no longer belongs in the config */
+	StateDir string // Folder runtime state is stored in
+	Backups  int    // Count of rotating backups kept of state files
+	DryRun   bool   // Migrate in memory only, without moving data to the state store
+}
+
+type migration struct {
+	/* Upgrades a raw config from schema version From to From+1 */
+	From        int
+	Description string
+	Migrate     func(raw map[string]interface{}, ctx migrationContext) error
+}
+
+// Registry of migrations, applied in order. Append new migrations at the end.
+var migrations = []migration{
+	{
+		From:        0,
+		Description: "move subscribers, statistics, preferences and history to the state store",
+		Migrate:     migrateRuntimeState,
+	},
+	{
+		From:        1,
+		Description: "add per-chat and per-group rate-limits and backup count",
+		Migrate:     migrateLimits,
+	},
+}
+
+func migrateRuntimeState(raw map[string]interface{}, ctx migrationContext) error {
+	// Import runtime state into the state store, then drop it from the config
+	legacy, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+
+	// A dry run drops the state from the migrated config, but leaves the file as is
+	if !ctx.DryRun {
+		if err = state.ImportLegacy(ctx.StateDir, legacy, ctx.Backups); err != nil {
+			return err
+		}
+	}
+
+	delete(raw, "Stats")
+	delete(raw, "Preferences")
+	delete(raw, "History")
+	delete(raw, "Mutex")
+
+	if broadcast, ok := raw["Broadcast"].(map[string]interface{}); ok {
+		delete(broadcast, "TelegramSubscribers")
+	}
+
+	return nil
+}
+
+func migrateLimits(raw map[string]interface{}, ctx migrationContext) error {
+	// Make limits explicit, using the defaults for anything missing
+	defaults := defaultConfig()
+
+	setDefault := func(key string, value interface{}) {
+		if current, ok := raw[key]; !ok || current == float64(0) {
+			raw[key] = value
+		}
+	}
+
+	setDefault("ChatRateLimit", defaults.ChatRateLimit)
+	setDefault("GroupRateLimit", defaults.GroupRateLimit)
+	setDefault("Backups", defaults.Backups)
+
+	return nil
+}
+
+func schemaVersion(raw map[string]interface{}) int {
+	// Files predating schema versions are version 0
+	version, _ := raw["SchemaVersion"].(float64)
+	return int(version)
+}
+
+func Migrate(data []byte, ctx migrationContext) ([]byte, int, error) {
+	/*
+		Upgrades raw config JSON to the current schema version, one migration at
+		a time. Returns the migrated JSON and the version the data started at.
+	*/
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, 0, err
+	}
+
+	from := schemaVersion(raw)
+	if from > SchemaVersion {
+		return nil, from, fmt.Errorf("config schema version %d is newer than supported version %d", from, SchemaVersion)
+	}
+
+	if from == SchemaVersion {
+		return data, from, nil
+	}
+
+	for _, step := range migrations {
+		if step.From < schemaVersion(raw) {
+			continue
+		}
+
+		if err := step.Migrate(raw, ctx); err != nil {
+			return nil, from, fmt.Errorf("migrating config from version %d (%s): %w", step.From, step.Description, err)
+		}
+
+		raw["SchemaVersion"] = step.From + 1
+	}
+
+	migrated, err := json.MarshalIndent(raw, "", "\t")
+	return migrated, from, err
+}
+
+func migrationBackupPath(configFile string, version int) string {
+	// Pre-migration copies are kept per version, outside the rotating backups
+	return fmt.Sprintf("%s.v%d", configFile, version)
+}
+
+func saveMigrated(configFile string, original []byte, migrated []byte, from int, backups int) error {
+	/* Keeps a copy of the original file, then replaces it with the migrated one */
+	if err := persist.WriteFile(migrationBackupPath(configFile, from), original, 0); err != nil {
+		return err
+	}
+
+	return persist.WriteFile(configFile, migrated, backups)
+}
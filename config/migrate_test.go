@@ -0,0 +1,124 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slashcaster/state"
+	"testing"
+)
+
+func loadFixture(t *testing.T, fixture string) (*Config, string) {
+	// Load a historical config fixture from a copy in a temporary folder
+	dir := t.TempDir()
+	data, err := os.ReadFile(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configFile := filepath.Join(dir, "bot-config.json")
+	if err = os.WriteFile(configFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := Load(Options{ConfigFile: configFile})
+	if err != nil {
+		t.Fatalf("Loading %s failed: %v", fixture, err)
+	}
+
+	return config, dir
+}
+
+func TestMigrateV0(t *testing.T) {
+	config, dir := loadFixture(t, "v0-bot-config.json")
+
+	if config.SchemaVersion != SchemaVersion || config.RateLimit != 20 || config.Broadcast.TelegramChannel != -1001234 {
+		t.Fatalf("Expected config to be migrated, got %+v", config)
+	}
+
+	if config.ChatRateLimit != 1 || config.GroupRateLimit != 20 || config.Backups == 0 {
+		t.Errorf("Expected default limits to be set, got %+v", config)
+	}
+
+	// Runtime state is moved to the state store
+	store, err := state.Load(dir, 0)
+	if err != nil {
+		t.Fatalf("Loading state failed: %v", err)
+	}
+
+	if len(store.State.Subscribers) != 3 || store.State.Stats.AttSlashings != 4 {
+		t.Errorf("Expected runtime state to be imported, got %+v", store.State)
+	}
+
+	// The original is kept, and the migrated config is written without runtime state
+	if _, err = os.Stat(migrationBackupPath(filepath.Join(dir, "bot-config.json"), 0)); err != nil {
+		t.Errorf("Expected a pre-migration backup: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "bot-config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var raw map[string]interface{}
+	if err = json.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := raw["Stats"]; ok || schemaVersion(raw) != SchemaVersion {
+		t.Errorf("Expected migrated config on disk, got %s", data)
+	}
+}
+
+func TestMigrateDryRun(t *testing.T) {
+	dir := t.TempDir()
+	data, err := os.ReadFile(filepath.Join("testdata", "v0-bot-config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configFile := filepath.Join(dir, "bot-config.json")
+	if err = os.WriteFile(configFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := Load(Options{ConfigFile: configFile, DryRun: true})
+	if err != nil {
+		t.Fatalf("Loading failed: %v", err)
+	}
+
+	// Migrated in memory, pending on disk
+	if from, pending := PendingMigration(config); config.SchemaVersion != SchemaVersion || !pending || from != 0 {
+		t.Fatalf("Expected a pending migration from version 0, got version %d, pending=%v from %d", config.SchemaVersion, pending, from)
+	}
+
+	// Nothing but the original config is in the folder
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected a dry run to write nothing, found %d files", len(entries))
+	}
+
+	if onDisk, _ := os.ReadFile(configFile); string(onDisk) != string(data) {
+		t.Errorf("Expected the config file to be left as is")
+	}
+}
+
+func TestMigrateV1(t *testing.T) {
+	config, dir := loadFixture(t, "v1-bot-config.json")
+
+	if config.SchemaVersion != SchemaVersion || config.RateLimit != 25 || config.GroupRateLimit != 20 {
+		t.Fatalf("Expected config to be migrated, got %+v", config)
+	}
+
+	// Only migrations after version 1 run: no state is imported
+	if _, err := os.Stat(filepath.Join(dir, "state.json")); !os.IsNotExist(err) {
+		t.Errorf("Expected no state file to be created")
+	}
+}
+
+func TestMigrateNewerSchema(t *testing.T) {
+	_, _, err := Migrate([]byte(`{"SchemaVersion": 99}`), migrationContext{StateDir: t.TempDir()})
+	if err == nil {
+		t.Fatalf("Expected a config from a newer version to be rejected")
+	}
+}
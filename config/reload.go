@@ -0,0 +1,131 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Fields that can't be applied to a running bot: changing them requires a restart
+var restartRequired = map[string]bool{
+	"Debug":           true,
+	"NoStream":        true,
+	"LogPath":         true,
+	"Backups":         true,
+	"StateDir":        true,
+	"TelegramAPI":     true,
+	"Storage":         true,
+	"StorageDSN":      true,
+	"Tokens.Telegram": true,
+	"Tokens.Discord":  true,
+}
+
+// Fields whose values are never logged
+var secretFields = map[string]bool{
+	"Tokens.Telegram": true,
+	"Tokens.Discord":  true,
+	"Tokens.Infura":   true,
+	"EncryptedTokens": true,
+	"StorageDSN":      true,
+}
+
+type Change struct {
+	/* A single changed config field */
+	Field   string // Field path, e.g. Broadcast.TelegramChannel
+	Old     string // Previous value, redacted for secrets
+	New     string // New value, redacted for secrets
+	Applied bool   // Was the change applied live?
+}
+
+func (change Change) String() string {
+	if change.Applied {
+		return fmt.Sprintf("%s: %s -> %s", change.Field, change.Old, change.New)
+	}
+
+	return fmt.Sprintf("%s: %s -> %s (requires restart)", change.Field, change.Old, change.New)
+}
+
+func diff(old reflect.Value, new reflect.Value, prefix string) []Change {
+	// Walk both configs, returning the fields that differ
+	var changes []Change
+
+	for i := 0; i < old.NumField(); i++ {
+		fieldType := old.Type().Field(i)
+		if !fieldType.IsExported() || envSkipped[fieldType.Name] || fieldType.Tag.Get("json") == "-" {
+			continue
+		}
+
+		name := prefix + fieldType.Name
+		oldField, newField := old.Field(i), new.Field(i)
+
+		// Nested config sections, e.g. Tokens.Infura. Other structs are compared as a whole.
+		if oldField.Kind() == reflect.Struct && fieldType.Type.PkgPath() == old.Type().PkgPath() {
+			changes = append(changes, diff(oldField, newField, name+".")...)
+			continue
+		}
+
+		if reflect.DeepEqual(oldField.Interface(), newField.Interface()) {
+			continue
+		}
+
+		change := Change{
+			Field: name,
+			Old:   fmt.Sprintf("%v", oldField.Interface()),
+			New:   fmt.Sprintf("%v", newField.Interface()),
+		}
+
+		if secretFields[name] {
+			change.Old, change.New = "<redacted>", "<redacted>"
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes
+}
+
+func Diff(old *Config, new *Config) []Change {
+	/* Returns the fields that differ between two configs */
+	return diff(reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem(), "")
+}
+
+func setPath(config *Config, source *Config, path string) {
+	// Copy the field at path from source to config
+	dst, src := reflect.ValueOf(config).Elem(), reflect.ValueOf(source).Elem()
+	for _, name := range strings.Split(path, ".") {
+		dst, src = dst.FieldByName(name), src.FieldByName(name)
+	}
+
+	dst.Set(src)
+}
+
+func Reload(config *Config, options Options) ([]Change, error) {
+	/*
+		Re-reads the operator config from the file the config was loaded from,
+		including environment overrides, and applies safe changes live. Invalid
+		configs are rejected as a whole. Returns every changed field; fields that
+		require a restart are reported, but not applied.
+	*/
+	options.ConfigFile = config.file
+	options.Interactive = false
+
+	reloaded, err := Load(options)
+	if err != nil {
+		return nil, err
+	}
+
+	config.Mutex.Lock()
+	defer config.Mutex.Unlock()
+
+	changes := Diff(config, reloaded)
+	for i, change := range changes {
+		if restartRequired[change.Field] {
+			continue
+		}
+
+		setPath(config, reloaded, change.Field)
+		changes[i].Applied = true
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slashcaster/spam"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, path string, body string) {
+	if err := os.WriteFile(path, []byte(body), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "bot-config.json")
+	writeConfig(t, configFile, `{
+		"SchemaVersion": 2,
+		"LogPath": "logs",
+		"RateLimit": 30,
+		"Tokens": {"Telegram": "`+testTelegramToken+`", "Infura": "https://beacon.example.com"},
+		"Broadcast": {"TelegramChannel": -100}
+	}`)
+
+	config, err := Load(Options{ConfigFile: configFile})
+	if err != nil {
+		t.Fatalf("Loading config failed: %v", err)
+	}
+
+	// Safe changes apply, restart-only changes are reported
+	writeConfig(t, configFile, `{
+		"SchemaVersion": 2,
+		"LogPath": "other-logs",
+		"RateLimit": 10,
+		"Tokens": {"Telegram": "`+testTelegramToken+`", "Infura": "https://other.example.com"},
+		"Broadcast": {"TelegramChannel": -200},
+		"Spam": {"Commands": {"/history": {"Rate": 1, "Burst": 1}}}
+	}`)
+
+	changes, err := Reload(config, Options{})
+	if err != nil {
+		t.Fatalf("Reloading config failed: %v", err)
+	}
+
+	if len(changes) != 5 {
+		t.Fatalf("Expected 5 changes, got %v", changes)
+	}
+
+	if config.RateLimit != 10 || config.Broadcast.TelegramChannel != -200 || Endpoint(config) != "https://other.example.com" {
+		t.Errorf("Expected safe changes to be applied, got %+v", config)
+	}
+
+	if rule := config.Spam.Commands["/history"]; rule.Rate != 1 || config.Spam.User != spam.DefaultLimits.User {
+		t.Errorf("Expected spam limits to be applied, got %+v", config.Spam)
+	}
+
+	if config.LogPath != "logs" {
+		t.Errorf("Expected LogPath to require a restart, got %s", config.LogPath)
+	}
+
+	for _, change := range changes {
+		if strings.Contains(change.String(), "example.com") {
+			t.Errorf("Expected endpoint to be redacted, got %s", change)
+		}
+	}
+
+	// Invalid configs are rejected as a whole
+	writeConfig(t, configFile, `{"SchemaVersion": 2, "LogPath": "logs", "RateLimit": 5,
+		"Tokens": {"Telegram": "invalid", "Infura": "https://beacon.example.com"}}`)
+
+	if _, err = Reload(config, Options{}); err == nil || config.RateLimit != 10 {
+		t.Fatalf("Expected invalid config to be rejected, got err=%v RateLimit=%d", err, config.RateLimit)
+	}
+}
@@ -0,0 +1,272 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"slashcaster/persist"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// Environment variable holding the base64-encoded key for encrypted tokens.
+// Like other variables, it can be read from a file with the _FILE suffix.
+const secretKeyEnv = envPrefix + "SECRET_KEY"
+
+// Size of secretbox nonces
+const nonceSize = 24
+
+func (tokens Tokens) String() string {
+	// Tokens never end up in logs, whatever the format verb
+	return "{<redacted>}"
+}
+
+func (tokens Tokens) GoString() string {
+	return tokens.String()
+}
+
+func RedactError(err error) error {
+	/* Removes request URLs from err: the Bot API and Infura URLs contain tokens */
+	var urlErr *url.Error
+	if err == nil || !errors.As(err, &urlErr) {
+		return err
+	}
+
+	message := strings.ReplaceAll(err.Error(), strconv.Quote(urlErr.URL), "<redacted url>")
+	return errors.New(strings.ReplaceAll(message, urlErr.URL, "<redacted url>"))
+}
+
+type redactingWriter struct {
+	/* Replaces tokens in everything written through it */
+	out    io.Writer
+	config *Config
+}
+
+func (writer redactingWriter) Write(p []byte) (int, error) {
+	writer.config.Mutex.Lock()
+	tokens := writer.config.Tokens
+	dsn := writer.config.StorageDSN
+	writer.config.Mutex.Unlock()
+
+	text := string(p)
+	for _, token := range []string{tokens.Telegram, tokens.Infura, tokens.Discord, dsn} {
+		if token != "" {
+			text = strings.ReplaceAll(text, token, "<redacted>")
+		}
+	}
+
+	if _, err := io.WriteString(writer.out, text); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func RedactingWriter(out io.Writer, config *Config) io.Writer {
+	/* Wraps out for logging, so tokens never end up in log files */
+	return redactingWriter{out: out, config: config}
+}
+
+func GenerateKey() (string, error) {
+	/* Returns a new random key for encrypting tokens, base64-encoded */
+	var key [32]byte
+	if _, err := io.ReadFull(rand.Reader, key[:]); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(key[:]), nil
+}
+
+func loadKey() (*[32]byte, error) {
+	// Read the key from the environment or a key file, nil if none is set
+	encoded, ok, err := lookupEnv(secretKeyEnv)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(decoded) != 32 {
+		return nil, fmt.Errorf("%s must be a base64-encoded 32-byte key", secretKeyEnv)
+	}
+
+	var key [32]byte
+	copy(key[:], decoded)
+
+	return &key, nil
+}
+
+func encryptTokens(tokens Tokens, key *[32]byte) (string, error) {
+	// Seal the tokens with secretbox: the output is base64(nonce || box)
+	plaintext, err := json.Marshal(tokens)
+	if err != nil {
+		return "", err
+	}
+
+	var nonce [nonceSize]byte
+	if _, err = io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return "", err
+	}
+
+	sealed := secretbox.Seal(nonce[:], plaintext, &nonce, key)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptTokens(encrypted string, key *[32]byte) (Tokens, error) {
+	// Open tokens sealed by encryptTokens
+	var tokens Tokens
+
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil || len(sealed) < nonceSize {
+		return tokens, errors.New("encrypted tokens are malformed")
+	}
+
+	var nonce [nonceSize]byte
+	copy(nonce[:], sealed[:nonceSize])
+
+	plaintext, ok := secretbox.Open(nil, sealed[nonceSize:], &nonce, key)
+	if !ok {
+		return tokens, errors.New("decrypting tokens failed: wrong key?")
+	}
+
+	err = json.Unmarshal(plaintext, &tokens)
+	return tokens, err
+}
+
+func decryptConfig(config *Config) error {
+	// Decrypt the tokens in memory, keeping the key to re-encrypt them on dumps
+	key, err := loadKey()
+	if err != nil {
+		return err
+	}
+
+	config.key = key
+	if config.EncryptedTokens == "" {
+		return nil
+	}
+
+	if key == nil {
+		return fmt.Errorf("config contains encrypted tokens: set %s or %s%s", secretKeyEnv, secretKeyEnv, envFileSuffix)
+	}
+
+	decrypted, err := decryptTokens(config.EncryptedTokens, key)
+	if err != nil {
+		return err
+	}
+
+	// Plaintext tokens in the file take precedence, e.g. right after editing it
+	config.Tokens = mergeTokens(decrypted, config.Tokens)
+	return nil
+}
+
+func EncryptFile(options Options) error {
+	/*
+		Encrypts the plaintext tokens of a config file with the key from the
+		environment, replacing them with EncryptedTokens. The file is modified
+		as-is: environment overrides are not written to it. Backups, which may
+		contain plaintext tokens, are removed.
+	*/
+	key, err := loadKey()
+	if err != nil {
+		return err
+	} else if key == nil {
+		return fmt.Errorf("no key set: set %s or %s%s", secretKeyEnv, secretKeyEnv, envFileSuffix)
+	}
+
+	configFile := configPath(options)
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return err
+	}
+
+	var raw map[string]json.RawMessage
+	if err = json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	var tokens Tokens
+	if rawTokens, ok := raw["Tokens"]; ok {
+		if err = json.Unmarshal(rawTokens, &tokens); err != nil {
+			return err
+		}
+	}
+
+	// Merge with tokens that are already encrypted
+	if rawEncrypted, ok := raw["EncryptedTokens"]; ok {
+		var encrypted string
+		if err = json.Unmarshal(rawEncrypted, &encrypted); err != nil {
+			return err
+		}
+
+		if encrypted != "" {
+			existing, err := decryptTokens(encrypted, key)
+			if err != nil {
+				return err
+			}
+
+			tokens = mergeTokens(existing, tokens)
+		}
+	}
+
+	encrypted, err := encryptTokens(tokens, key)
+	if err != nil {
+		return err
+	}
+
+	raw["EncryptedTokens"], _ = json.Marshal(encrypted)
+	delete(raw, "Tokens")
+
+	jsonbytes, err := json.MarshalIndent(raw, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	if err = persist.WriteFile(configFile, jsonbytes, 0); err != nil {
+		return err
+	}
+
+	return removeBackups(configFile, persist.DefaultBackups)
+}
+
+func removeBackups(configFile string, backups int) error {
+	// Remove rotating and pre-migration backups of the config file
+	paths := []string{}
+	for i := 1; i <= backups; i++ {
+		paths = append(paths, fmt.Sprintf("%s.%d", configFile, i))
+	}
+
+	for version := 0; version < SchemaVersion; version++ {
+		paths = append(paths, migrationBackupPath(configFile, version))
+	}
+
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func mergeTokens(base Tokens, override Tokens) Tokens {
+	// Non-empty tokens in override replace those in base
+	if override.Telegram != "" {
+		base.Telegram = override.Telegram
+	}
+
+	if override.Infura != "" {
+		base.Infura = override.Infura
+	}
+
+	if override.Discord != "" {
+		base.Discord = override.Discord
+	}
+
+	return base
+}
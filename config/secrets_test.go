@@ -0,0 +1,76 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncryptedTokens(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(secretKeyEnv, key)
+
+	configFile := filepath.Join(t.TempDir(), "bot-config.json")
+	writeConfig(t, configFile, `{
+		"SchemaVersion": 2,
+		"LogPath": "logs",
+		"RateLimit": 30,
+		"Tokens": {"Telegram": "`+testTelegramToken+`", "Infura": "https://beacon.example.com/secret"}
+	}`)
+
+	if err = EncryptFile(Options{ConfigFile: configFile}); err != nil {
+		t.Fatalf("Encrypting tokens failed: %v", err)
+	}
+
+	// The file no longer contains tokens
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(data, []byte(testTelegramToken)) || bytes.Contains(data, []byte("secret")) {
+		t.Fatalf("Expected tokens to be encrypted, got %s", data)
+	}
+
+	// Tokens are decrypted in memory
+	config, err := Load(Options{ConfigFile: configFile})
+	if err != nil {
+		t.Fatalf("Loading encrypted config failed: %v", err)
+	}
+
+	if config.Tokens.Telegram != testTelegramToken || Endpoint(config) != "https://beacon.example.com/secret" {
+		t.Fatalf("Expected tokens to be decrypted, got %s", config.Tokens.Telegram)
+	}
+
+	// Dumps are encrypted too
+	DumpConfig(config)
+	if data, err = os.ReadFile(configFile); err != nil || bytes.Contains(data, []byte(testTelegramToken)) {
+		t.Fatalf("Expected dumped tokens to be encrypted, got %s (err=%v)", data, err)
+	}
+
+	// Tokens can't be formatted into logs
+	if formatted := fmt.Sprintf("%v %+v", config.Tokens, config); strings.Contains(formatted, testTelegramToken) {
+		t.Errorf("Expected tokens to be redacted, got %s", formatted)
+	}
+
+	var logs bytes.Buffer
+	fmt.Fprintf(RedactingWriter(&logs, config), "Post https://api.telegram.org/bot%s/getMe failed", testTelegramToken)
+	if strings.Contains(logs.String(), testTelegramToken) {
+		t.Errorf("Expected logs to be redacted, got %s", logs.String())
+	}
+
+	// Without the key, loading fails
+	t.Setenv(secretKeyEnv, "")
+	os.Unsetenv(secretKeyEnv)
+
+	if _, err = Load(Options{ConfigFile: configFile}); err == nil {
+		t.Fatalf("Expected loading encrypted tokens without a key to fail")
+	}
+}
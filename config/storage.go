@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"slashcaster/state"
+)
+
+// Storage backends for runtime state
+const (
+	StorageJSON     = "json"
+	StorageSQLite   = "sqlite"
+	StoragePostgres = "postgres"
+)
+
+// Default SQLite database, in the state folder
+const sqliteFile = "state.db"
+
+func StorageBackend(config *Config) (state.Backend, error) {
+	/* Opens the configured storage backend */
+	switch config.Storage {
+	case "", StorageJSON:
+		return state.NewJSONBackend(Dir(config), config.Backups)
+	case StorageSQLite:
+		dsn := config.StorageDSN
+		if dsn == "" {
+			dsn = StatePath(config, sqliteFile)
+		}
+
+		return state.NewSQLBackend(state.DriverSQLite, dsn)
+	case StoragePostgres:
+		return state.NewSQLBackend(state.DriverPostgres, config.StorageDSN)
+	}
+
+	return nil, fmt.Errorf("unknown storage backend %s", config.Storage)
+}
+
+func OpenState(config *Config) (*state.Store, error) {
+	/* Opens the state store with the configured storage backend */
+	backend, err := StorageBackend(config)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := state.Open(backend)
+	if err != nil {
+		backend.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+func MigrateStorage(config *Config) (int, error) {
+	/*
+		Copies the JSON state in the state folder, including state imported from
+		a pre-split bot-config.json, to the configured SQL backend. The target
+		must not contain subscribers yet. Returns the count of subscribers copied.
+	*/
+	if config.Storage == "" || config.Storage == StorageJSON {
+		return 0, fmt.Errorf("storage backend is %s: set Storage to %s or %s to migrate", StorageJSON, StorageSQLite, StoragePostgres)
+	}
+
+	source, err := state.Load(Dir(config), config.Backups)
+	if err != nil {
+		return 0, err
+	}
+
+	target, err := OpenState(config)
+	if err != nil {
+		return 0, err
+	}
+
+	defer state.Close(target)
+
+	if len(state.Subscribers(target)) != 0 {
+		return 0, fmt.Errorf("%s storage already contains subscribers", config.Storage)
+	}
+
+	if err = state.Copy(source, target); err != nil {
+		return 0, err
+	}
+
+	return len(state.Subscribers(target)), nil
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"path/filepath"
+	"slashcaster/state"
+	"testing"
+)
+
+func TestMigrateStorage(t *testing.T) {
+	// A v0 config: its runtime state is imported into state.json on load
+	config, dir := loadFixture(t, "v0-bot-config.json")
+
+	config.Storage = StorageSQLite
+	copied, err := MigrateStorage(config)
+	if err != nil {
+		t.Fatalf("Migrating storage failed: %v", err)
+	}
+
+	if copied != 3 {
+		t.Fatalf("Expected 3 subscribers to be migrated, got %d", copied)
+	}
+
+	store, err := OpenState(config)
+	if err != nil {
+		t.Fatalf("Opening SQLite storage failed: %v", err)
+	}
+
+	defer state.Close(store)
+
+	if stats := state.GetStats(store); stats.AttSlashings != 4 {
+		t.Errorf("Expected stats to be migrated, got %+v", stats)
+	}
+
+	if StatePath(config, sqliteFile) != filepath.Join(dir, sqliteFile) {
+		t.Errorf("Expected database in the state folder, got %s", StatePath(config, sqliteFile))
+	}
+
+	// Migrating twice would duplicate state
+	if _, err = MigrateStorage(config); err == nil {
+		t.Errorf("Expected migrating into non-empty storage to fail")
+	}
+}
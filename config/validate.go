@@ -0,0 +1,125 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slashcaster/alerts"
+	"slashcaster/spam"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Telegram bot tokens are of the form <bot id>:<secret>
+var telegramTokenRegex = regexp.MustCompile(`^\d+:[A-Za-z0-9_-]{30,}$`)
+
+type ValidationErrors []error
+
+func (errs ValidationErrors) Error() string {
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+
+	return "invalid config: " + strings.Join(messages, "; ")
+}
+
+func isHttpURL(raw string) bool {
+	parsed, err := url.Parse(raw)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+func Validate(config *Config) ValidationErrors {
+	/* Validates the config, returning every problem found */
+	var errs ValidationErrors
+
+	if config.Tokens.Telegram == "" {
+		errs = append(errs, fmt.Errorf("Tokens.Telegram is not set (SLASHCASTER_TOKENS_TELEGRAM)"))
+	} else if !telegramTokenRegex.MatchString(config.Tokens.Telegram) {
+		errs = append(errs, fmt.Errorf("Tokens.Telegram is not a valid bot token"))
+	}
+
+	if config.Tokens.Infura == "" {
+		errs = append(errs, fmt.Errorf("Tokens.Infura is not set (SLASHCASTER_TOKENS_INFURA)"))
+	} else if !isHttpURL(config.Tokens.Infura) {
+		errs = append(errs, fmt.Errorf("Tokens.Infura is not a valid http(s) beacon endpoint URL"))
+	}
+
+	if config.TelegramAPI != "" && !isHttpURL(config.TelegramAPI) {
+		errs = append(errs, fmt.Errorf("TelegramAPI is not a valid http(s) URL"))
+	}
+
+	switch config.Storage {
+	case "", StorageJSON, StorageSQLite:
+	case StoragePostgres:
+		if config.StorageDSN == "" {
+			errs = append(errs, fmt.Errorf("StorageDSN must be set for %s storage", StoragePostgres))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("Storage must be one of %s, %s or %s, got %s",
+			StorageJSON, StorageSQLite, StoragePostgres, config.Storage))
+	}
+
+	if config.RateLimit <= 0 || config.RateLimit > 30 {
+		errs = append(errs, fmt.Errorf("RateLimit must be between 1 and 30 messages/second, got %d", config.RateLimit))
+	}
+
+	if config.ChatRateLimit < 0 {
+		errs = append(errs, fmt.Errorf("ChatRateLimit must not be negative, got %d", config.ChatRateLimit))
+	} else if config.RateLimit > 0 && config.ChatRateLimit > config.RateLimit {
+		errs = append(errs, fmt.Errorf("ChatRateLimit must not exceed RateLimit, got %d > %d", config.ChatRateLimit, config.RateLimit))
+	}
+
+	if config.GroupRateLimit < 0 {
+		errs = append(errs, fmt.Errorf("GroupRateLimit must not be negative, got %d", config.GroupRateLimit))
+	}
+
+	if config.Backups < 0 {
+		errs = append(errs, fmt.Errorf("Backups must not be negative, got %d", config.Backups))
+	}
+
+	rules := map[string]spam.Rule{"Spam.User": config.Spam.User, "Spam.Group": config.Spam.Group, "Spam.Command": config.Spam.Command}
+	for command, rule := range config.Spam.Commands {
+		rules["Spam.Commands."+command] = rule
+	}
+
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		if rule := rules[name]; rule.Rate < 0 || rule.Burst < 0 {
+			errs = append(errs, fmt.Errorf("%s must not have a negative rate or burst, got %+v", name, rule))
+		}
+	}
+
+	if config.Broadcast.DiscordChannel != "" {
+		if _, err := strconv.ParseInt(config.Broadcast.DiscordChannel, 10, 64); err != nil {
+			errs = append(errs, fmt.Errorf("Broadcast.DiscordChannel is not a valid channel ID, got %s", config.Broadcast.DiscordChannel))
+		}
+
+		if config.Tokens.Discord == "" {
+			errs = append(errs, fmt.Errorf("Broadcast.DiscordChannel is set, but Tokens.Discord is not (SLASHCASTER_TOKENS_DISCORD)"))
+		}
+	}
+
+	if config.Templates.Telegram != "" && !alerts.ValidTelegramFormat(config.Templates.Telegram) {
+		errs = append(errs, fmt.Errorf("Templates.Telegram must be one of %s, got %s",
+			strings.Join(alerts.TelegramFormats, ", "), config.Templates.Telegram))
+	}
+
+	if config.Templates.Dir != "" {
+		if _, err := alerts.Load(config.Templates.Dir); err != nil {
+			errs = append(errs, fmt.Errorf("Templates.Dir: %w", err))
+		}
+	}
+
+	if config.LogPath == "" {
+		errs = append(errs, fmt.Errorf("LogPath is not set"))
+	}
+
+	return errs
+}
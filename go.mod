@@ -4,8 +4,10 @@ go 1.19
 
 require (
 	github.com/bwmarrin/discordgo v0.25.0
-	github.com/dustin/go-humanize v1.0.0
+	github.com/lib/pq v1.10.7
+	github.com/mattn/go-sqlite3 v1.14.16
 	github.com/rs/zerolog v1.27.0
+	golang.org/x/term v0.0.0-20210927222741-03fcf44c2211
 )
 
 require (
@@ -20,8 +22,7 @@ require (
 	github.com/go-co-op/gocron v1.16.2
 	github.com/go-resty/resty/v2 v2.7.0
 	github.com/gorilla/websocket v1.5.0 // indirect
-	github.com/hako/durafmt v0.0.0-20210608085754-5c1018a4e16b
-	golang.org/x/crypto v0.0.0-20220722155217-630584e8d5aa // indirect
+	golang.org/x/crypto v0.0.0-20220722155217-630584e8d5aa
 	golang.org/x/sys v0.0.0-20220811171246-fbc7d0a398ab // indirect
 	gopkg.in/telebot.v3 v3.0.0
 )
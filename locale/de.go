@@ -0,0 +1,252 @@
+package locale
+
+var german = Catalog{
+	Name:      "Deutsch",
+	Thousands: ".",
+	Decimal:   ",",
+	Messages: map[string]string{
+		// Counts and units
+		"validators.one":    "%s Validator",
+		"validators.other":  "%s Validatoren",
+		"incidents.one":     "%s Vorfall",
+		"incidents.other":   "%s Vorfällen",
+		"slashings.one":     "%s Slashing",
+		"slashings.other":   "%s Slashings",
+		"unit.second.one":   "%s Sekunde",
+		"unit.second.other": "%s Sekunden",
+		"unit.minute.one":   "%s Minute",
+		"unit.minute.other": "%s Minuten",
+		"unit.hour.one":     "%s Stunde",
+		"unit.hour.other":   "%s Stunden",
+		"unit.day.one":      "%s Tag",
+		"unit.day.other":    "%s Tage",
+		"unit.week.one":     "%s Woche",
+		"unit.week.other":   "%s Wochen",
+		"unit.month.one":    "%s Monat",
+		"unit.month.other":  "%s Monate",
+		"unit.year.one":     "%s Jahr",
+		"unit.year.other":   "%s Jahre",
+
+		// Shared replies
+		"error.preferences":  "⚠️ Beim Speichern deiner Einstellungen ist etwas schiefgelaufen, bitte versuche es später erneut.",
+		"error.generic":      "⚠️ Etwas ist schiefgelaufen, bitte versuche es später erneut.",
+		"admin.subscription": "⛔️ Nur Admins können das Abonnement dieses Chats ändern.",
+		"admin.settings":     "⛔️ Nur Admins können die Einstellungen dieses Chats ändern.",
+		"button.slowdown":    "⚠️ Nicht so schnell!",
+
+		// /subscribe and /unsubscribe
+		"subscribe.error":     "⚠️ Beim Abonnieren ist etwas schiefgelaufen, bitte versuche es später erneut.",
+		"subscribe.success":   "✅ Erfolgreich abonniert! Du wirst jetzt über Slashings benachrichtigt.",
+		"subscribe.already":   "ℹ️ Du hast die Benachrichtigungen bereits abonniert!\n\n_Zum Abbestellen nutze /unsubscribe._",
+		"unsubscribe.error":   "⚠️ Beim Abbestellen ist etwas schiefgelaufen, bitte versuche es später erneut.",
+		"unsubscribe.success": "✅ Erfolgreich abbestellt! Du erhältst keine Benachrichtigungen mehr.",
+		"unsubscribe.nothing": "ℹ️ Nichts zu tun, du erhältst keine Benachrichtigungen!\n\n_Um Benachrichtigungen zu erhalten, nutze /subscribe._",
+
+		// Delivery modes and /digest
+		"delivery.realtime":     "⚡️ Sofort",
+		"delivery.hourly":       "🕐 Stündliche Zusammenfassung",
+		"delivery.daily":        "📅 Tägliche Zusammenfassung",
+		"delivery.weekly":       "🗓 Wöchentliche Zusammenfassung",
+		"delivery.explain":      "Sofort sendet jedes Slashing, sobald es passiert. Zusammenfassungen kommen einmal pro Stunde, Tag oder Woche.",
+		"delivery.current":      "ℹ️ Dein Zustellmodus ist *%s*.\n\n_Zum Ändern nutze /digest gefolgt von: %s._",
+		"delivery.unknown":      "⚠️ Unbekannter Zustellmodus! Nutze einen von: %s.",
+		"delivery.set.realtime": "✅ Slashings werden dir jetzt sofort gesendet.",
+		"delivery.set.hourly":   "✅ Slashings werden dir jetzt in einer stündlichen Zusammenfassung gesendet.",
+		"delivery.set.daily":    "✅ Slashings werden dir jetzt in einer täglichen Zusammenfassung gesendet.",
+		"delivery.set.weekly":   "✅ Slashings werden dir jetzt in einer wöchentlichen Zusammenfassung gesendet.",
+
+		// /language
+		"language.current":   "ℹ️ Die Sprache dieses Chats ist *%s*.\n\n_Zum Ändern nutze /language gefolgt von: %s._",
+		"language.unknown":   "⚠️ Unbekannte Sprache! Nutze eine von: %s.",
+		"language.set":       "✅ Ich spreche jetzt Deutsch mit dir.",
+		"language.automatic": "✅ Ich spreche jetzt deine Telegram-Sprache mit dir.",
+		"language.auto":      "🌐 Automatisch",
+
+		// /start wizard and /settings menu
+		"start.welcome":             "🔪 *Willkommen beim Eth2 slasher!* Dieser Bot meldet Slashings auf der Ethereum Beacon Chain.\n\n",
+		"start.ask":                 "Möchtest du in diesem Chat über Slashings benachrichtigt werden?",
+		"start.yes":                 "🔔 Ja, benachrichtige mich",
+		"start.no":                  "Jetzt nicht",
+		"start.subscribed":          "✅ *Abonniert!*\n\nWie sollen Slashings zugestellt werden? ",
+		"start.done":                "🎉 *Alles erledigt!*\n\n",
+		"start.skipped":             "Kein Problem! Nutze /settings, wann immer du abonnieren möchtest, oder folge dem Kanal @ethslashings.",
+		"settings.title":            "⚙️ *Einstellungen für diesen Chat*\n\n",
+		"settings.on":               "🔔 Benachrichtigungen: an\n",
+		"settings.off":              "🔕 Benachrichtigungen: aus\n",
+		"settings.delivery":         "📬 Zustellung: %s\n",
+		"settings.language":         "🌐 Sprache: %s",
+		"settings.subscribe":        "🔔 Abonnieren",
+		"settings.unsubscribe":      "🔕 Abbestellen",
+		"settings.change.delivery":  "📬 Zustellung ändern",
+		"settings.change.language":  "🌐 Sprache ändern",
+		"settings.done":             "✔️ Fertig",
+		"settings.back":             "◀️ Zurück",
+		"settings.later":            "_Nutze /settings, um das später zu ändern._",
+		"settings.delivery.title":   "📬 *Wie sollen Slashings zugestellt werden?*\n\n",
+		"settings.language.title":   "🌐 *Welche Sprache soll ich in diesem Chat sprechen?*\n\nAutomatisch folgt in privaten Chats der Telegram-Sprache.",
+		"settings.filter":           "🔍 Benachrichtigungen: %s\n",
+		"settings.watchlist":        "👁 Beobachtungsliste: %s\n",
+		"settings.change.filter":    "🔍 Benachrichtigungen ändern",
+		"settings.change.watchlist": "👁 Beobachtungsliste bearbeiten",
+		"settings.filter.title":     "🔍 *Über welche Slashings soll ich dich benachrichtigen?*\n\nÜber Validatoren auf deiner Beobachtungsliste wirst du immer benachrichtigt.",
+		"settings.watchlist.title":  "👁 *Beobachtungsliste*\n\n",
+		"settings.watchlist.none":   "Es werden noch keine Validatoren beobachtet.",
+		"settings.watchlist.list":   "Beobachtete Validatoren: %s\n\nTippe auf einen Validator, um ihn nicht mehr zu beobachten.",
+		"settings.watchlist.add":    "\n\n_Nutze /watch gefolgt von einem Validator-Index, um einen hinzuzufügen, bis zu %d._",
+
+		// Alert filters and /watch, /unwatch
+		"filter.all":       "Alle Slashings",
+		"filter.min":       "Ab %s Validatoren",
+		"filter.watchlist": "Nur beobachtete Validatoren",
+		"watchlist.empty":  "leer",
+		"watch.current":    "👁 Beobachtete Validatoren: %s\n\n_Nutze /watch oder /unwatch gefolgt von einem Validator-Index, um sie zu ändern._",
+		"watch.none":       "👁 Du beobachtest keine Validatoren.\n\n_Nutze /watch gefolgt von einem Validator-Index, um über seine Slashings benachrichtigt zu werden._",
+		"watch.invalid":    "⚠️ Das ist kein Validator-Index! Nutze z. B. /watch 1234.",
+		"watch.added":      "✅ Validator %s wurde deiner Beobachtungsliste hinzugefügt.",
+		"watch.already":    "ℹ️ Validator %s ist bereits auf deiner Beobachtungsliste.",
+		"watch.full":       "⚠️ Deine Beobachtungsliste ist voll! Du kannst bis zu %s Validatoren beobachten.",
+		"unwatch.removed":  "✅ Validator %s wurde von deiner Beobachtungsliste entfernt.",
+		"unwatch.nothing":  "ℹ️ Validator %s ist nicht auf deiner Beobachtungsliste.",
+
+		// Alerts, marked up by the alert templates
+		"alert.title":          "%s geslasht",
+		"alert.reorged":        "Reorg:",
+		"alert.reorged.detail": "dieses Slashing ist nicht mehr Teil der kanonischen Chain.",
+		"alert.slot":           "%s geslasht in Slot %s",
+		"alert.slots":          "%s geslasht in den Slots %s bis %s",
+		"alert.validators":     "Geslashte Validatoren",
+		"alert.both":           "Attestierungs- & Proposer-Verstoß",
+		"alert.attester":       "Attestierungsverstoß",
+		"alert.proposer":       "Proposer-Verstoß",
+		"alert.penalty":        "(-%s ETH)",
+		"alert.since":          "%s seit dem letzten Slashing.",
+		"alert.manage":         "Mit /settings änderst du, wie du Meldungen erhältst.",
+		"digest.title.hourly":  "Stündliche Slashing-Zusammenfassung",
+		"digest.title.daily":   "Tägliche Slashing-Zusammenfassung",
+		"digest.title.weekly":  "Wöchentliche Slashing-Zusammenfassung",
+		"digest.summary":       "%s geslasht in %s",
+		"digest.attester":      "Attester-Slashings: %s",
+		"digest.proposer":      "Proposer-Slashings: %s",
+		"digest.penalties":     "Anfängliche Strafen: %s ETH",
+		"digest.largest":       "Größte Vorfälle",
+		"digest.incident":      "Slot %s: %s",
+		"digest.involved":      "Betroffene Validatoren",
+		"digest.more":          "und %s weitere",
+
+		// Inline query results
+		"inline.slashing":    "🔪 Slot %s: %s geslasht",
+		"inline.stats":       "📊 SlashCaster-Statistiken",
+		"inline.stats.about": "Gesehene Slashings und Sync-Status",
+
+		// Dates, as Go time layouts
+		"format.date":  "2.1.2006",
+		"format.time":  "2.1.2006 15:04 UTC",
+		"format.day":   "2.1.2006",
+		"format.month": "01/2006",
+
+		// /stats
+		"stats.title":        "SlashCaster-Statistiken",
+		"stats.slashings":    "Slashings",
+		"stats.attester":     "Attester-Slashings: %s",
+		"stats.proposer":     "Proposer-Slashings: %s",
+		"stats.last":         "Letztes Slashing vor %s",
+		"stats.none":         "Noch keine Slashings gesehen",
+		"stats.recent":       "Geslashte Validatoren in den letzten %s: %s",
+		"stats.sync":         "Sync",
+		"stats.slot":         "Aktueller Slot: %s",
+		"stats.head.unknown": " (Head unbekannt)",
+		"stats.head.synced":  " (synchron)",
+		"stats.head.behind":  " (%s Slots hinter dem Head)",
+		"stats.blocks":       "Verarbeitete Blöcke: %s",
+		"stats.block":        "Letzter Block vor %s",
+		"stats.endpoint":     "Endpunkt: `%s`",
+		"stats.delivery":     "Zustellung",
+		"stats.subscribers":  "Abonnenten: %s",
+		"stats.queued":       "Wartende Nachrichten: %s",
+		"stats.sent":         "Gesendete Nachrichten: %s",
+		"stats.started":      "Bot gestartet vor %s",
+
+		// /last and /history, escaped for MarkdownV2 when sent
+		"last.usage":          "ℹ️ Verwendung: /last [Anzahl]",
+		"last.empty":          "ℹ️ Es wurden noch keine Slashings aufgezeichnet.",
+		"last.title":          "Letzte %s",
+		"last.page":           "(Seite %s/%s)",
+		"last.slot":           "Slot %s, %s",
+		"history.usage":       "ℹ️ Verwendung: /history <von> <bis>, mit Daten als JJJJ-MM-TT, z. B. /history 2023-01-01 2023-03-31",
+		"history.title.day":   "Slashings pro Tag",
+		"history.title.week":  "Slashings pro Woche",
+		"history.title.month": "Slashings pro Monat",
+		"history.range":       "%s bis %s: %s (%s Attester-, %s Proposer-Slashings)",
+		"history.page":        "Seite %s/%s",
+		"history.week":        "Woche vom %s",
+		"history.split":       " (%s Attester, %s Proposer)",
+		"page.previous":       "◀️ Zurück",
+		"page.next":           "Weiter ▶️",
+
+		// /validator
+		"validator.usage":        "ℹ️ Verwendung: /validator <Index oder Pubkey>",
+		"validator.invalid":      "⚠️ Das ist kein Validator-Index oder Pubkey.",
+		"validator.unknown":      "ℹ️ Kein Validator für %s gefunden.",
+		"validator.error":        "⚠️ Beim Nachschlagen des Validators ist etwas schiefgelaufen, bitte versuche es später erneut.",
+		"validator.title":        "🔎 Validator %s",
+		"validator.status":       "Status: %s",
+		"validator.balance":      "Guthaben: %s ETH",
+		"validator.slashed":      "Geslasht: ja 🔪",
+		"validator.unslashed":    "Geslasht: nein ✅",
+		"validator.withdrawable": "Abhebbar ab Epoche %s",
+		"validator.eta":          " (in %s)",
+		"validator.reached":      " (erreicht)",
+		"validator.history":      "Vom Bot gesehene Slashings:",
+		"validator.record":       "• Slot %s, %s: %s",
+		"validator.attester":     "Attestierungsverstoß",
+		"validator.proposer":     "Proposer-Verstoß",
+		"validator.inline.yes":   "%s, geslasht",
+		"validator.inline.no":    "%s, nicht geslasht",
+
+		// Spam notices
+		"spam.warning":   "⚠️ Nicht so schnell! Du sendest Befehle zu schnell: wenn du so weitermachst, wirst du gesperrt.",
+		"spam.ban":       "⛔️ Du wurdest für %s gesperrt, weil du Befehle gespammt hast.",
+		"spam.ban.final": "⛔️ Du wurdest dauerhaft gesperrt, weil du Befehle gespammt hast.",
+
+		// Replies to the bot's owner
+		"owner.admin.usage":         "ℹ️ Verwendung: /admin stats",
+		"owner.stats.title":         "🛂 Admin-Statistiken",
+		"owner.stats.subscribers":   "Abonnenten: %s",
+		"owner.stats.queue":         "Warteschlange: %s Nachricht(en), %s Dead Letter(s)",
+		"owner.stats.broadcasts":    "Letzte Broadcasts: %s, %s zugestellt, %s blockiert, %s fehlgeschlagen (%s%% Fehler, %s Wiederholungen)",
+		"owner.stats.endpoint":      "Endpunkt: %s",
+		"owner.stats.reachable":     "✅ erreichbar, Head-Slot %s",
+		"owner.stats.streamer":      "Streamer: %s, bei Slot %s",
+		"owner.streamer.running":    "läuft",
+		"owner.streamer.disabled":   "deaktiviert",
+		"owner.streamer.paused":     "pausiert",
+		"owner.announce.usage":      "ℹ️ Verwendung: /announce <Text>",
+		"owner.announce.nobody":     "ℹ️ Es gibt keine Abonnenten für eine Ankündigung.",
+		"owner.announce.queued":     "📢 Ankündigung für %s Chat(s) als Broadcast #%d eingereiht.",
+		"owner.announce.unreported": "📢 Ankündigung für %s Chat(s) eingereiht, ohne Zustellbericht.",
+		"owner.ban.usage":           "ℹ️ Verwendung: /ban <Chat-ID> [Dauer, z. B. 12h]",
+		"owner.ban.chat":            "⚠️ Ungültige Chat-ID: %s",
+		"owner.ban.duration":        "⚠️ Ungültige Dauer: %s",
+		"owner.ban.error":           "⚠️ Beim Sperren des Chats ist etwas schiefgelaufen.",
+		"owner.ban.permanent":       "⛔️ Chat %d dauerhaft gesperrt.",
+		"owner.ban.done":            "⛔️ Chat %d für %s gesperrt.",
+		"owner.unban.usage":         "ℹ️ Verwendung: /unban <Chat-ID>",
+		"owner.unban.error":         "⚠️ Beim Entsperren des Chats ist etwas schiefgelaufen.",
+		"owner.unban.none":          "ℹ️ Chat %d ist nicht gesperrt.",
+		"owner.unban.done":          "✅ Chat %d entsperrt.",
+		"owner.pause.already":       "ℹ️ Streaming ist bereits pausiert.",
+		"owner.pause.done":          "⏸ Streaming pausiert: mit /resume geht es weiter.",
+		"owner.resume.already":      "ℹ️ Streaming ist nicht pausiert.",
+		"owner.resume.done":         "▶️ Streaming fortgesetzt.",
+		"owner.resync.usage":        "ℹ️ Verwendung: /resync <Slot>",
+		"owner.resync.done":         "⏮ Streaming wird ab Slot %s fortgesetzt. Bereits aufgezeichnete Slashings werden nicht erneut gesendet.",
+		"owner.dlq.usage":           "ℹ️ Verwendung: /dlq [Anzahl]",
+		"owner.dlq.empty":           "✅ Die Dead-Letter-Queue ist leer.",
+		"owner.dlq.title":           "📭 Dead Letters: %s von %s",
+		"owner.broadcast.summary":   "Broadcast #%d: %s/%s zugestellt",
+		"owner.broadcast.blocked":   ", %s blockiert",
+		"owner.broadcast.failed":    ", %s fehlgeschlagen",
+		"owner.broadcast.retries":   " (%s Wiederholungen)",
+		"owner.dlq.letter":          "Chat=%d, %s Versuch(e), vor %s: %s",
+	},
+}
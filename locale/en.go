@@ -0,0 +1,252 @@
+package locale
+
+var english = Catalog{
+	Name:      "English",
+	Thousands: ",",
+	Decimal:   ".",
+	Messages: map[string]string{
+		// Counts and units
+		"validators.one":    "%s validator",
+		"validators.other":  "%s validators",
+		"incidents.one":     "%s incident",
+		"incidents.other":   "%s incidents",
+		"slashings.one":     "%s slashing",
+		"slashings.other":   "%s slashings",
+		"unit.second.one":   "%s second",
+		"unit.second.other": "%s seconds",
+		"unit.minute.one":   "%s minute",
+		"unit.minute.other": "%s minutes",
+		"unit.hour.one":     "%s hour",
+		"unit.hour.other":   "%s hours",
+		"unit.day.one":      "%s day",
+		"unit.day.other":    "%s days",
+		"unit.week.one":     "%s week",
+		"unit.week.other":   "%s weeks",
+		"unit.month.one":    "%s month",
+		"unit.month.other":  "%s months",
+		"unit.year.one":     "%s year",
+		"unit.year.other":   "%s years",
+
+		// Shared replies
+		"error.preferences":  "⚠️ Something went wrong while saving your preferences, please try again later.",
+		"error.generic":      "⚠️ Something went wrong, please try again later.",
+		"admin.subscription": "⛔️ Only chat admins can change this chat's subscription.",
+		"admin.settings":     "⛔️ Only chat admins can change this chat's settings.",
+		"button.slowdown":    "⚠️ Slow down!",
+
+		// /subscribe and /unsubscribe
+		"subscribe.error":     "⚠️ Something went wrong while subscribing, please try again later.",
+		"subscribe.success":   "✅ Successfully subscribed! You will now be notified of slashings.",
+		"subscribe.already":   "ℹ️ You are already subscribed to notifications!\n\n_To unsubscribe, use /unsubscribe._",
+		"unsubscribe.error":   "⚠️ Something went wrong while unsubscribing, please try again later.",
+		"unsubscribe.success": "✅ Successfully unsubscribed! No notifications will be sent to you.",
+		"unsubscribe.nothing": "ℹ️ Nothing to do, you will not receive notifications!\n\n_To receive notifications, use /subscribe._",
+
+		// Delivery modes and /digest
+		"delivery.realtime":     "⚡️ Real-time",
+		"delivery.hourly":       "🕐 Hourly digest",
+		"delivery.daily":        "📅 Daily digest",
+		"delivery.weekly":       "🗓 Weekly digest",
+		"delivery.explain":      "Real-time sends each slashing as it happens. Digests summarize them once an hour, day or week.",
+		"delivery.current":      "ℹ️ Your delivery mode is *%s*.\n\n_To change it, use /digest followed by one of: %s._",
+		"delivery.unknown":      "⚠️ Unknown delivery mode! Use one of: %s.",
+		"delivery.set.realtime": "✅ Slashings will now be sent to you as they happen.",
+		"delivery.set.hourly":   "✅ Slashings will now be sent to you in an hourly digest.",
+		"delivery.set.daily":    "✅ Slashings will now be sent to you in a daily digest.",
+		"delivery.set.weekly":   "✅ Slashings will now be sent to you in a weekly digest.",
+
+		// /language
+		"language.current":   "ℹ️ This chat's language is *%s*.\n\n_To change it, use /language followed by one of: %s._",
+		"language.unknown":   "⚠️ Unknown language! Use one of: %s.",
+		"language.set":       "✅ I will now talk to you in English.",
+		"language.automatic": "✅ I will now talk to you in your Telegram language.",
+		"language.auto":      "🌐 Automatic",
+
+		// /start wizard and /settings menu
+		"start.welcome":             "🔪 *Welcome to Eth2 slasher!* This bot broadcasts slashing events occurring on the Ethereum beacon chain.\n\n",
+		"start.ask":                 "Would you like to be notified of slashings in this chat?",
+		"start.yes":                 "🔔 Yes, notify me",
+		"start.no":                  "Not now",
+		"start.subscribed":          "✅ *Subscribed!*\n\nHow should slashings be delivered? ",
+		"start.done":                "🎉 *All set!*\n\n",
+		"start.skipped":             "No problem! Use /settings whenever you'd like to subscribe, or follow the channel @ethslashings.",
+		"settings.title":            "⚙️ *Settings for this chat*\n\n",
+		"settings.on":               "🔔 Notifications: on\n",
+		"settings.off":              "🔕 Notifications: off\n",
+		"settings.delivery":         "📬 Delivery: %s\n",
+		"settings.language":         "🌐 Language: %s",
+		"settings.subscribe":        "🔔 Subscribe",
+		"settings.unsubscribe":      "🔕 Unsubscribe",
+		"settings.change.delivery":  "📬 Change delivery",
+		"settings.change.language":  "🌐 Change language",
+		"settings.done":             "✔️ Done",
+		"settings.back":             "◀️ Back",
+		"settings.later":            "_Use /settings to change these later._",
+		"settings.delivery.title":   "📬 *How should slashings be delivered?*\n\n",
+		"settings.language.title":   "🌐 *Which language should I use in this chat?*\n\nAutomatic follows the Telegram language of private chats.",
+		"settings.filter":           "🔍 Alerts: %s\n",
+		"settings.watchlist":        "👁 Watchlist: %s\n",
+		"settings.change.filter":    "🔍 Change alerts",
+		"settings.change.watchlist": "👁 Edit watchlist",
+		"settings.filter.title":     "🔍 *Which slashings should I alert you of?*\n\nValidators on your watchlist are always alerted.",
+		"settings.watchlist.title":  "👁 *Watchlist*\n\n",
+		"settings.watchlist.none":   "No validators are watched yet.",
+		"settings.watchlist.list":   "Watched validators: %s\n\nTap a validator to stop watching it.",
+		"settings.watchlist.add":    "\n\n_Use /watch followed by a validator index to add one, up to %d._",
+
+		// Alert filters and /watch, /unwatch
+		"filter.all":       "All slashings",
+		"filter.min":       "%s+ validators",
+		"filter.watchlist": "Watched validators only",
+		"watchlist.empty":  "empty",
+		"watch.current":    "👁 Watched validators: %s\n\n_Use /watch or /unwatch followed by a validator index to change them._",
+		"watch.none":       "👁 You are not watching any validators.\n\n_Use /watch followed by a validator index to be alerted of its slashings._",
+		"watch.invalid":    "⚠️ That is not a validator index! Use e.g. /watch 1234.",
+		"watch.added":      "✅ Validator %s added to your watchlist.",
+		"watch.already":    "ℹ️ Validator %s is already on your watchlist.",
+		"watch.full":       "⚠️ Your watchlist is full! You can watch up to %s validators.",
+		"unwatch.removed":  "✅ Validator %s removed from your watchlist.",
+		"unwatch.nothing":  "ℹ️ Validator %s is not on your watchlist.",
+
+		// Alerts, marked up by the alert templates
+		"alert.title":          "%s slashed",
+		"alert.reorged":        "Reorged out:",
+		"alert.reorged.detail": "this slashing is no longer part of the canonical chain.",
+		"alert.slot":           "%s slashed in slot %s",
+		"alert.slots":          "%s slashed in slots %s to %s",
+		"alert.validators":     "Validators slashed",
+		"alert.both":           "attestator & proposer violation",
+		"alert.attester":       "attestor violation",
+		"alert.proposer":       "proposer violation",
+		"alert.penalty":        "(-%s ETH)",
+		"alert.since":          "%s since last slashing.",
+		"alert.manage":         "Change how you receive alerts with /settings.",
+		"digest.title.hourly":  "Hourly slashing digest",
+		"digest.title.daily":   "Daily slashing digest",
+		"digest.title.weekly":  "Weekly slashing digest",
+		"digest.summary":       "%s slashed in %s",
+		"digest.attester":      "Attester slashings: %s",
+		"digest.proposer":      "Proposer slashings: %s",
+		"digest.penalties":     "Initial penalties: %s ETH",
+		"digest.largest":       "Largest incidents",
+		"digest.incident":      "Slot %s: %s",
+		"digest.involved":      "Validators involved",
+		"digest.more":          "and %s more",
+
+		// Inline query results
+		"inline.slashing":    "🔪 Slot %s: %s slashed",
+		"inline.stats":       "📊 SlashCaster statistics",
+		"inline.stats.about": "Slashings seen and sync status",
+
+		// Dates, as Go time layouts
+		"format.date":  "2 Jan 2006",
+		"format.time":  "2 Jan 2006 15:04 UTC",
+		"format.day":   "Mon 2 Jan 2006",
+		"format.month": "Jan 2006",
+
+		// /stats
+		"stats.title":        "SlashCaster statistics",
+		"stats.slashings":    "Slashings",
+		"stats.attester":     "Attester slashings: %s",
+		"stats.proposer":     "Proposer slashings: %s",
+		"stats.last":         "Last slashing %s ago",
+		"stats.none":         "No slashings seen yet",
+		"stats.recent":       "Validators slashed in the last %s: %s",
+		"stats.sync":         "Sync",
+		"stats.slot":         "Current slot: %s",
+		"stats.head.unknown": " (head unknown)",
+		"stats.head.synced":  " (in sync)",
+		"stats.head.behind":  " (%s slots behind head)",
+		"stats.blocks":       "Blocks parsed: %s",
+		"stats.block":        "Last block %s ago",
+		"stats.endpoint":     "Endpoint: `%s`",
+		"stats.delivery":     "Delivery",
+		"stats.subscribers":  "Subscribers: %s",
+		"stats.queued":       "Queued messages: %s",
+		"stats.sent":         "Messages sent: %s",
+		"stats.started":      "Bot started %s ago",
+
+		// /last and /history, escaped for MarkdownV2 when sent
+		"last.usage":          "ℹ️ Usage: /last [count]",
+		"last.empty":          "ℹ️ No slashings have been recorded yet.",
+		"last.title":          "Last %s",
+		"last.page":           "(page %s/%s)",
+		"last.slot":           "Slot %s, %s",
+		"history.usage":       "ℹ️ Usage: /history <from> <to>, with dates as YYYY-MM-DD, e.g. /history 2023-01-01 2023-03-31",
+		"history.title.day":   "Slashings per day",
+		"history.title.week":  "Slashings per week",
+		"history.title.month": "Slashings per month",
+		"history.range":       "%s to %s: %s (%s attester, %s proposer slashings)",
+		"history.page":        "Page %s/%s",
+		"history.week":        "Week of %s",
+		"history.split":       " (%s attester, %s proposer)",
+		"page.previous":       "◀️ Previous",
+		"page.next":           "Next ▶️",
+
+		// /validator
+		"validator.usage":        "ℹ️ Usage: /validator <index or pubkey>",
+		"validator.invalid":      "⚠️ That's not a validator index or pubkey.",
+		"validator.unknown":      "ℹ️ No validator found for %s.",
+		"validator.error":        "⚠️ Something went wrong while looking up the validator, please try again later.",
+		"validator.title":        "🔎 Validator %s",
+		"validator.status":       "Status: %s",
+		"validator.balance":      "Balance: %s ETH",
+		"validator.slashed":      "Slashed: yes 🔪",
+		"validator.unslashed":    "Slashed: no ✅",
+		"validator.withdrawable": "Withdrawable at epoch %s",
+		"validator.eta":          " (in %s)",
+		"validator.reached":      " (reached)",
+		"validator.history":      "Slashings seen by the bot:",
+		"validator.record":       "• Slot %s, %s: %s",
+		"validator.attester":     "attestation violation",
+		"validator.proposer":     "proposer violation",
+		"validator.inline.yes":   "%s, slashed",
+		"validator.inline.no":    "%s, not slashed",
+
+		// Spam notices
+		"spam.warning":   "⚠️ Slow down! You are sending commands too quickly: continuing to do so will get you banned.",
+		"spam.ban":       "⛔️ You have been banned for %s for spamming commands.",
+		"spam.ban.final": "⛔️ You have been banned permanently for spamming commands.",
+
+		// Replies to the bot's owner
+		"owner.admin.usage":         "ℹ️ Usage: /admin stats",
+		"owner.stats.title":         "🛂 Admin statistics",
+		"owner.stats.subscribers":   "Subscribers: %s",
+		"owner.stats.queue":         "Queue: %s message(s), %s dead letter(s)",
+		"owner.stats.broadcasts":    "Recent broadcasts: %s, %s delivered, %s blocked, %s failed (%s%% errors, %s retries)",
+		"owner.stats.endpoint":      "Endpoint: %s",
+		"owner.stats.reachable":     "✅ reachable, head slot %s",
+		"owner.stats.streamer":      "Streamer: %s, at slot %s",
+		"owner.streamer.running":    "running",
+		"owner.streamer.disabled":   "disabled",
+		"owner.streamer.paused":     "paused",
+		"owner.announce.usage":      "ℹ️ Usage: /announce <text>",
+		"owner.announce.nobody":     "ℹ️ There are no subscribers to announce to.",
+		"owner.announce.queued":     "📢 Announcement queued for %s chat(s) as broadcast #%d.",
+		"owner.announce.unreported": "📢 Announcement queued for %s chat(s), without a delivery report.",
+		"owner.ban.usage":           "ℹ️ Usage: /ban <chat id> [duration, e.g. 12h]",
+		"owner.ban.chat":            "⚠️ Invalid chat ID: %s",
+		"owner.ban.duration":        "⚠️ Invalid duration: %s",
+		"owner.ban.error":           "⚠️ Something went wrong while banning the chat.",
+		"owner.ban.permanent":       "⛔️ Chat %d banned permanently.",
+		"owner.ban.done":            "⛔️ Chat %d banned for %s.",
+		"owner.unban.usage":         "ℹ️ Usage: /unban <chat id>",
+		"owner.unban.error":         "⚠️ Something went wrong while unbanning the chat.",
+		"owner.unban.none":          "ℹ️ Chat %d is not banned.",
+		"owner.unban.done":          "✅ Chat %d unbanned.",
+		"owner.pause.already":       "ℹ️ Streaming is already paused.",
+		"owner.pause.done":          "⏸ Streaming paused: use /resume to continue.",
+		"owner.resume.already":      "ℹ️ Streaming is not paused.",
+		"owner.resume.done":         "▶️ Streaming resumed.",
+		"owner.resync.usage":        "ℹ️ Usage: /resync <slot>",
+		"owner.resync.done":         "⏮ Streaming will continue from slot %s. Slashings already recorded are not broadcast again.",
+		"owner.dlq.usage":           "ℹ️ Usage: /dlq [count]",
+		"owner.dlq.empty":           "✅ The dead-letter queue is empty.",
+		"owner.dlq.title":           "📭 Dead letters: showing %s of %s",
+		"owner.broadcast.summary":   "broadcast #%d: %s/%s delivered",
+		"owner.broadcast.blocked":   ", %s blocked",
+		"owner.broadcast.failed":    ", %s failed",
+		"owner.broadcast.retries":   " (%s retries)",
+		"owner.dlq.letter":          "chat=%d, %s attempt(s), %s ago: %s",
+	},
+}
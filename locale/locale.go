@@ -0,0 +1,201 @@
+package locale
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Language used when a chat's language is unknown or not supported
+const Default = "en"
+
+// Supported languages, in the order they are shown to users
+var Languages = []string{"en", "de"}
+
+type Catalog struct {
+	/* Messages and number formatting of a language */
+	Name      string            // Name of the language, in the language itself
+	Thousands string            // Separator between groups of thousands
+	Decimal   string            // Separator of the fractional part
+	Messages  map[string]string // Map message key to a fmt format string
+}
+
+var catalogs = map[string]*Catalog{
+	"en": &english,
+	"de": &german,
+}
+
+func catalog(lang string) *Catalog {
+	// Catalog of lang, falling back to the default language
+	if catalog, ok := catalogs[lang]; ok {
+		return catalog
+	}
+
+	return catalogs[Default]
+}
+
+func Supported(lang string) bool {
+	/* Is lang one of the supported languages? */
+	_, ok := catalogs[lang]
+	return ok
+}
+
+func Match(codes ...string) string {
+	/*
+		Returns the first supported language of codes, e.g. "de" for Telegram's
+		language_code "de-AT". Empty and unsupported codes are skipped.
+	*/
+	for _, code := range codes {
+		lang, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(code)), "-")
+		if Supported(lang) {
+			return lang
+		}
+	}
+
+	return Default
+}
+
+func Name(lang string) string {
+	/* Name of the language, e.g. "Deutsch" */
+	return catalog(lang).Name
+}
+
+func T(lang string, key string, args ...interface{}) string {
+	/*
+		Formats the message key in lang with args. Messages missing from lang
+		fall back to the default language, unknown keys are returned as is.
+	*/
+	format, ok := catalog(lang).Messages[key]
+	if !ok {
+		if format, ok = catalogs[Default].Messages[key]; !ok {
+			return key
+		}
+	}
+
+	if len(args) == 0 {
+		return format
+	}
+
+	return fmt.Sprintf(format, args...)
+}
+
+func Plural(lang string, n int, key string) string {
+	/*
+		Formats a count with the singular or plural form of key, e.g.
+		"1 validator" or "1,234 validators". Catalogs hold the forms as
+		key.one and key.other.
+	*/
+	form := key + ".other"
+	if n == 1 {
+		form = key + ".one"
+	}
+
+	return T(lang, form, Number(lang, int64(n)))
+}
+
+func Number(lang string, n int64) string {
+	/* Formats an integer with the language's thousands separator */
+	digits := strconv.FormatInt(n, 10)
+
+	var sign string
+	if n < 0 {
+		sign, digits = "-", digits[1:]
+	}
+
+	var grouped strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			grouped.WriteString(catalog(lang).Thousands)
+		}
+
+		grouped.WriteRune(digit)
+	}
+
+	return sign + grouped.String()
+}
+
+func Decimal(lang string, f float64, precision int) string {
+	/* Formats a number with precision decimals, e.g. "1,234.50" or "1.234,50" */
+	formatted := strconv.FormatFloat(math.Abs(f), 'f', precision, 64)
+	whole, fraction, _ := strings.Cut(formatted, ".")
+
+	wholeInt, _ := strconv.ParseInt(whole, 10, 64)
+	text := Number(lang, wholeInt)
+	if fraction != "" {
+		text += catalog(lang).Decimal + fraction
+	}
+
+	if f < 0 && strings.Trim(formatted, "0.") != "" {
+		text = "-" + text
+	}
+
+	return text
+}
+
+// Units durations are expressed in, largest first
+var durationUnits = []struct {
+	key    string
+	length time.Duration
+}{
+	{"unit.year", 365 * 24 * time.Hour},
+	{"unit.month", 30 * 24 * time.Hour},
+	{"unit.week", 7 * 24 * time.Hour},
+	{"unit.day", 24 * time.Hour},
+	{"unit.hour", time.Hour},
+	{"unit.minute", time.Minute},
+	{"unit.second", time.Second},
+}
+
+func Duration(lang string, d time.Duration) string {
+	/* Formats a duration in its largest whole unit, e.g. "3 days" or "3 Tage" */
+	return DurationUnits(lang, d, 1)
+}
+
+func DurationUnits(lang string, d time.Duration, units int) string {
+	/* Formats a duration in up to units units, largest first, e.g. "3 days 4 hours" */
+	if d < 0 {
+		d = -d
+	}
+
+	var parts []string
+	for _, unit := range durationUnits {
+		if len(parts) == units {
+			break
+		}
+
+		if d >= unit.length {
+			parts = append(parts, Plural(lang, int(d/unit.length), unit.key))
+			d %= unit.length
+		}
+	}
+
+	if len(parts) == 0 {
+		return Plural(lang, 0, "unit.second")
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// A message in each supported language, keyed by language
+type Texts map[string]string
+
+func Render(render func(lang string) string) Texts {
+	/* Renders a message in every supported language, e.g. for a broadcast */
+	texts := make(Texts, len(Languages))
+	for _, lang := range Languages {
+		texts[lang] = render(lang)
+	}
+
+	return texts
+}
+
+func (texts Texts) For(lang string) string {
+	/* The text in lang, falling back to the default language */
+	if text, ok := texts[lang]; ok {
+		return text
+	}
+
+	return texts[Default]
+}
@@ -0,0 +1,90 @@
+package locale
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Formatting verbs of a message, e.g. %s or %d
+var verbPattern = regexp.MustCompile(`%[a-z]`)
+
+func TestCatalogsComplete(t *testing.T) {
+	for _, lang := range Languages {
+		if _, ok := catalogs[lang]; !ok {
+			t.Fatalf("Expected a catalog for supported language %s", lang)
+		}
+	}
+
+	// Every key exists in every catalog, taking the same arguments
+	for lang, catalog := range catalogs {
+		for otherLang, other := range catalogs {
+			for key, format := range other.Messages {
+				translated, ok := catalog.Messages[key]
+				if !ok {
+					t.Errorf("Key %q of %s is missing from %s", key, otherLang, lang)
+					continue
+				}
+
+				verbs := verbPattern.FindAllString(format, -1)
+				if translatedVerbs := verbPattern.FindAllString(translated, -1); strings.Join(verbs, "") != strings.Join(translatedVerbs, "") {
+					t.Errorf("Key %q takes %v in %s but %v in %s", key, verbs, otherLang, translatedVerbs, lang)
+				}
+			}
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := map[string][]string{
+		"de": {"", "de-AT"},
+		"en": {"fr", "EN-us", "de"},
+	}
+
+	for expected, codes := range tests {
+		if lang := Match(codes...); lang != expected {
+			t.Errorf("Expected %v to match %s, got %s", codes, expected, lang)
+		}
+	}
+
+	if lang := Match("xx", ""); lang != Default {
+		t.Errorf("Expected unsupported languages to fall back to %s, got %s", Default, lang)
+	}
+}
+
+func TestFormatting(t *testing.T) {
+	tests := []struct {
+		got      string
+		expected string
+	}{
+		{Number("en", 4700000), "4,700,000"},
+		{Number("de", -1234), "-1.234"},
+		{Number("de", 999), "999"},
+		{Decimal("en", 1234.5, 2), "1,234.50"},
+		{Decimal("de", 1234.5, 2), "1.234,50"},
+		{Decimal("de", -0.001, 2), "0,00"},
+		{Plural("en", 1, "validators"), "1 validator"},
+		{Plural("de", 2, "validators"), "2 Validatoren"},
+		{Duration("en", time.Hour), "1 hour"},
+		{Duration("en", 50*time.Hour), "2 days"},
+		{Duration("de", 3*7*24*time.Hour), "3 Wochen"},
+		{Duration("de", 0), "0 Sekunden"},
+		{DurationUnits("en", 3*time.Hour+30*time.Second, 2), "3 hours 30 seconds"},
+		{DurationUnits("de", 26*time.Hour+5*time.Minute, 2), "1 Tag 2 Stunden"},
+	}
+
+	for _, test := range tests {
+		if test.got != test.expected {
+			t.Errorf("Expected %q, got %q", test.expected, test.got)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	texts := Render(func(lang string) string { return T(lang, "settings.done") })
+
+	if len(texts) != len(Languages) || texts.For("de") != "✔️ Fertig" || texts.For("xx") != texts[Default] {
+		t.Fatalf("Expected a text per language falling back to %s, got %v", Default, texts)
+	}
+}
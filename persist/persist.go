@@ -0,0 +1,182 @@
+package persist
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Default count of rotating backups kept for each file
+const DefaultBackups = 3
+
+// Minimum age of the newest backup before frequently written files, like state, rotate again
+const BackupInterval = time.Hour
+
+func backupPath(path string, n int) string {
+	// Backups are numbered, path.1 being the newest
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+func syncDir(dir string) error {
+	// Fsync a folder, so a rename in it survives a crash
+	dirf, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	defer dirf.Close()
+	return dirf.Sync()
+}
+
+func copyFile(src string, dst string) error {
+	// Copy src to dst, fsyncing dst
+	srcf, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+
+	defer srcf.Close()
+
+	dstf, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(dstf, srcf); err != nil {
+		dstf.Close()
+		return err
+	}
+
+	if err = dstf.Sync(); err != nil {
+		dstf.Close()
+		return err
+	}
+
+	return dstf.Close()
+}
+
+func rotateBackups(path string, backups int, interval time.Duration) error {
+	/*
+		Shift backups up by one, then copy the live file into path.1. Skipped if
+		path.1 is less than interval old, so backups span a useful period.
+	*/
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	if stat, err := os.Stat(backupPath(path, 1)); err == nil && time.Since(stat.ModTime()) < interval {
+		return nil
+	}
+
+	for n := backups - 1; n >= 1; n-- {
+		err := os.Rename(backupPath(path, n), backupPath(path, n+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return copyFile(path, backupPath(path, 1))
+}
+
+func WriteFile(path string, data []byte, backups int) error {
+	/*
+		Replaces the file at path with data. The data is written to a temporary
+		file and fsynced before being renamed over path, so a crash at any point
+		leaves either the old or the new file in place. The previous file is
+		kept as a rotating backup.
+	*/
+	return WriteFileEvery(path, data, backups, 0)
+}
+
+func WriteFileEvery(path string, data []byte, backups int, interval time.Duration) error {
+	/*
+		Like WriteFile, but the previous file is only kept as a backup if the
+		newest backup is at least interval old. For files written often.
+	*/
+	dir := filepath.Dir(path)
+
+	tmpf, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := tmpf.Name()
+
+	// Write, sync, close: on failure, remove the temporary file
+	_, err = tmpf.Write(data)
+	if err == nil {
+		err = tmpf.Sync()
+	}
+
+	if closeErr := tmpf.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil && backups > 0 {
+		err = rotateBackups(path, backups, interval)
+	}
+
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+func ReadFile(path string, backups int, decode func(data []byte) error) (string, error) {
+	/*
+		Reads the file at path and passes it to decode. If the file is missing,
+		unreadable or fails to decode, backups are tried from newest to oldest.
+		Returns the path that was used. If no file exists at all, the returned
+		error satisfies os.IsNotExist.
+	*/
+	var firstErr error
+	found := false
+
+	for n := 0; n <= backups; n++ {
+		candidate := path
+		if n > 0 {
+			candidate = backupPath(path, n)
+		}
+
+		data, err := os.ReadFile(candidate)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		found = true
+
+		if err == nil {
+			err = decode(data)
+		}
+
+		if err == nil {
+			if n > 0 {
+				log.Warn().Err(firstErr).Msgf("⚠️ %s is damaged: loaded backup %s", path, candidate)
+			}
+
+			return candidate, nil
+		}
+
+		if firstErr == nil {
+			firstErr = err
+		}
+
+		log.Error().Err(err).Msgf("⚠️ Error loading %s", candidate)
+	}
+
+	if !found {
+		return "", &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
+
+	return "", fmt.Errorf("no valid file or backup of %s: %w", path, firstErr)
+}
@@ -0,0 +1,119 @@
+package persist
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readCount(t *testing.T, path string, backups int) (int, string, error) {
+	var data struct{ Count int }
+
+	used, err := ReadFile(path, backups, func(raw []byte) error {
+		return json.Unmarshal(raw, &data)
+	})
+
+	return data.Count, used, err
+}
+
+func TestWriteRotatesBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	for i := 1; i <= 5; i++ {
+		jsonbytes, _ := json.Marshal(struct{ Count int }{i})
+		if err := WriteFile(path, jsonbytes, 2); err != nil {
+			t.Fatalf("Write %d failed: %v", i, err)
+		}
+	}
+
+	// Live file is the latest write, backups the two before it
+	expected := map[string]int{path: 5, path + ".1": 4, path + ".2": 3}
+	for file, count := range expected {
+		if got, _, err := readCount(t, file, 0); err != nil || got != count {
+			t.Fatalf("Expected %s to hold count=%d, got %d (err=%v)", file, count, got, err)
+		}
+	}
+
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("Expected at most 2 backups to be kept")
+	}
+
+	// No temporary files are left behind
+	matches, _ := filepath.Glob(path + ".tmp-*")
+	if len(matches) != 0 {
+		t.Fatalf("Expected no temporary files, found %v", matches)
+	}
+}
+
+func TestWriteRotatesBackupsPerInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	write := func(count int) {
+		jsonbytes, _ := json.Marshal(struct{ Count int }{count})
+		if err := WriteFileEvery(path, jsonbytes, 2, time.Hour); err != nil {
+			t.Fatalf("Write %d failed: %v", count, err)
+		}
+	}
+
+	// Within the interval, only the first overwrite is backed up
+	for i := 1; i <= 5; i++ {
+		write(i)
+	}
+
+	if got, _, err := readCount(t, path+".1", 0); err != nil || got != 1 {
+		t.Fatalf("Expected %s.1 to hold count=1, got %d (err=%v)", path, got, err)
+	}
+
+	if _, err := os.Stat(path + ".2"); !os.IsNotExist(err) {
+		t.Fatalf("Expected a single backup within the interval")
+	}
+
+	// Once the newest backup is older than the interval, backups rotate again
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(path+".1", old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	write(6)
+
+	expected := map[string]int{path: 6, path + ".1": 5, path + ".2": 1}
+	for file, count := range expected {
+		if got, _, err := readCount(t, file, 0); err != nil || got != count {
+			t.Fatalf("Expected %s to hold count=%d, got %d (err=%v)", file, count, got, err)
+		}
+	}
+}
+
+func TestReadFallsBackToBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bot-config.json")
+
+	for i := 1; i <= 2; i++ {
+		jsonbytes, _ := json.Marshal(struct{ Count int }{i})
+		if err := WriteFile(path, jsonbytes, 3); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Simulate a truncated write of the live file
+	if err := os.WriteFile(path, []byte(`{"Cou`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	count, used, err := readCount(t, path, 3)
+	if err != nil || count != 1 || used != path+".1" {
+		t.Fatalf("Expected fallback to %s.1 with count=1, got %s with count=%d (err=%v)", path, used, count, err)
+	}
+
+	// Nothing valid at all
+	os.WriteFile(path+".1", []byte(""), 0600)
+	if _, _, err = readCount(t, path, 3); err == nil || os.IsNotExist(err) {
+		t.Fatalf("Expected a decode error when no valid file exists, got %v", err)
+	}
+
+	// Nothing at all
+	if _, _, err = readCount(t, filepath.Join(t.TempDir(), "missing.json"), 3); !os.IsNotExist(err) {
+		t.Fatalf("Expected a not-exist error for a missing file, got %v", err)
+	}
+}
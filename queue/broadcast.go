@@ -0,0 +1,438 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"slashcaster/config"
+	"slashcaster/locale"
+	"slashcaster/state"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	tb "gopkg.in/telebot.v3"
+)
+
+// How many times a message is attempted before it is dead-lettered
+const MaxAttempts = 3
+
+// How many dead letters are kept around for inspection
+const maxDeadLetters = 500
+
+// Delivery statuses for a single recipient
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusBlocked   = "blocked"
+	StatusFailed    = "failed"
+)
+
+type Receipt struct {
+	/* Delivery receipt for a single recipient of a broadcast */
+	Status    string // One of the Status* constants
+	Attempts  int    // Send attempts made so far
+	Error     string // Last error, if any
+	MessageId int    // ID of the delivered message, used for edits
+	Language  string // Language the recipient is sent the broadcast in
+}
+
+type Broadcast struct {
+	/* Per-broadcast delivery report */
+	Id         int                                       // Broadcast ID, increments across restarts
+	Created    int64                                     // Unix timestamp of broadcast creation
+	Recipients int                                       // Count of recipients the broadcast was queued for
+	Delivered  int                                       // Successful deliveries
+	Blocked    int                                       // Recipients that blocked the bot or no longer exist
+	Failed     int                                       // Deliveries that failed after all retries
+	Retries    int                                       // Count of retried sends
+	Sopts      tb.SendOptions                            // Send options of the broadcast, reused for edits
+	Receipts   map[int64]Receipt                         // Map recipient to a delivery receipt
+	texts      func(recipient int64, lang string) string // Latest texts of an edited broadcast, nil if not edited
+}
+
+// Returned when editing a broadcast that is no longer tracked
+var ErrBroadcastNotFound = errors.New("broadcast not found")
+
+type DeadLetter struct {
+	/* A message that could not be delivered */
+	Message Message // The message that failed
+	Error   string  // Last error encountered
+	Failed  int64   // Unix timestamp of the final failure
+}
+
+func NewBroadcast(queue *SendQueue, conf *config.Config, store *state.Store, recipients []int64, sopts tb.SendOptions) int {
+	/*
+		Registers a new broadcast for recipients, returns the broadcast ID. If no
+		ID can be reserved, the broadcast is sent untracked: 0 is returned, and
+		the broadcast has no delivery report and can't be edited. Broadcasts
+		without recipients are reported as finished right away.
+	*/
+	id, err := state.NextBroadcastId(store)
+	if err != nil {
+		log.Error().Err(err).Msg("⚠️ Error reserving broadcast ID: sending the broadcast untracked")
+		return 0
+	}
+
+	broadcast := &Broadcast{
+		Id:         id,
+		Created:    time.Now().Unix(),
+		Recipients: len(recipients),
+		Sopts:      sopts,
+		Receipts:   make(map[int64]Receipt, len(recipients)),
+	}
+
+	for _, chat := range recipients {
+		broadcast.Receipts[chat] = Receipt{Status: StatusPending, Language: state.ChatLanguage(store, chat)}
+	}
+
+	queue.Mutex.Lock()
+	if queue.Broadcasts == nil {
+		queue.Broadcasts = make(map[int]*Broadcast)
+	}
+
+	queue.Broadcasts[id] = broadcast
+
+	// Forget broadcasts whose messages are no longer kept
+	expiry := broadcast.Created - int64(state.SentRetention.Seconds())
+	for oldId, old := range queue.Broadcasts {
+		if old.Created < expiry {
+			delete(queue.Broadcasts, oldId)
+		}
+	}
+
+	queue.Mutex.Unlock()
+
+	// Keep the IDs of delivered messages in the state, for edits after a restart
+	state.TrackBroadcast(store, id, broadcast.Created, string(sopts.ParseMode), sopts.DisableWebPagePreview)
+
+	if len(recipients) == 0 {
+		broadcastDone(queue, conf, store, broadcast)
+	}
+
+	return id
+}
+
+func isBlocked(err error) bool {
+	// Errors after which retrying a chat is pointless
+	return errors.Is(err, tb.ErrBlockedByUser) ||
+		errors.Is(err, tb.ErrUserIsDeactivated) ||
+		errors.Is(err, tb.ErrKickedFromGroup) ||
+		errors.Is(err, tb.ErrKickedFromSuperGroup) ||
+		errors.Is(err, tb.ErrChatNotFound)
+}
+
+func recordAttempt(queue *SendQueue, msg *Message, messageId int, err error) (string, *Broadcast) {
+	/*
+		Records the result of a send attempt, and returns the resulting status of
+		the message. If this completed a broadcast, the broadcast is returned.
+	*/
+	msg.Attempts++
+
+	var status string
+	switch {
+	case err == nil:
+		status = StatusDelivered
+	case isBlocked(err):
+		status = StatusBlocked
+	case msg.Attempts >= MaxAttempts:
+		status = StatusFailed
+	default:
+		status = StatusPending
+	}
+
+	queue.Mutex.Lock()
+	defer queue.Mutex.Unlock()
+
+	if status == StatusFailed || status == StatusBlocked {
+		queue.DeadLetters = append(queue.DeadLetters, DeadLetter{
+			Message: *msg, Error: err.Error(), Failed: time.Now().Unix(),
+		})
+
+		// Cap the dead-letter queue
+		if len(queue.DeadLetters) > maxDeadLetters {
+			queue.DeadLetters = queue.DeadLetters[len(queue.DeadLetters)-maxDeadLetters:]
+		}
+	}
+
+	broadcast, ok := queue.Broadcasts[msg.BroadcastId]
+	if !ok {
+		return status, nil
+	}
+
+	receipt := broadcast.Receipts[msg.Recipient]
+
+	// The broadcast was edited while the message was being sent: retry, or edit, with the new text
+	if broadcast.texts != nil {
+		text := broadcast.texts(msg.Recipient, receipt.Language)
+
+		if status == StatusPending {
+			msg.Message = text
+		} else if status == StatusDelivered && messageId != 0 && text != msg.Message {
+			queue.MessageQueue = append(queue.MessageQueue, Message{
+				Type:        msg.Type,
+				Recipient:   msg.Recipient,
+				Message:     text,
+				Sopts:       broadcast.Sopts,
+				BroadcastId: broadcast.Id,
+				Edit:        true,
+			})
+		}
+	}
+
+	receipt.Status = status
+	receipt.Attempts = msg.Attempts
+	receipt.MessageId = messageId
+	if err != nil {
+		receipt.Error = err.Error()
+	}
+
+	broadcast.Receipts[msg.Recipient] = receipt
+
+	switch status {
+	case StatusDelivered:
+		broadcast.Delivered++
+	case StatusBlocked:
+		broadcast.Blocked++
+	case StatusFailed:
+		broadcast.Failed++
+	default:
+		broadcast.Retries++
+	}
+
+	if broadcast.Delivered+broadcast.Blocked+broadcast.Failed == broadcast.Recipients {
+		return status, broadcast
+	}
+
+	return status, nil
+}
+
+func recordRetry(queue *SendQueue, msg *Message) {
+	// Flood-limited sends are retried without counting as an attempt
+	queue.Mutex.Lock()
+	if broadcast, ok := queue.Broadcasts[msg.BroadcastId]; ok {
+		broadcast.Retries++
+	}
+	queue.Mutex.Unlock()
+}
+
+func EditBroadcast(queue *SendQueue, broadcastId int, texts func(recipient int64, lang string) string) (int, error) {
+	/*
+		Updates every message of a broadcast to the text rendered by texts for
+		the recipient, in its language. Messages still waiting in the queue are
+		rewritten, delivered messages are edited in place, and messages being
+		sent are edited once delivered. Returns the count of edits queued, or
+		ErrBroadcastNotFound if the broadcast is no longer tracked.
+	*/
+	queue.Mutex.Lock()
+	defer queue.Mutex.Unlock()
+
+	broadcast, ok := queue.Broadcasts[broadcastId]
+	if !ok {
+		return 0, fmt.Errorf("broadcast #%d: %w", broadcastId, ErrBroadcastNotFound)
+	}
+
+	broadcast.texts = texts
+
+	// Rewrite pending messages, drop edits superseded by this one
+	var pending []Message
+	for _, msg := range queue.MessageQueue {
+		if msg.BroadcastId == broadcastId {
+			if msg.Edit {
+				continue
+			}
+
+			msg.Message = texts(msg.Recipient, broadcast.Receipts[msg.Recipient].Language)
+		}
+
+		pending = append(pending, msg)
+	}
+
+	// Queue edits for delivered messages
+	edits := 0
+	for chat, receipt := range broadcast.Receipts {
+		if receipt.Status != StatusDelivered || receipt.MessageId == 0 {
+			continue
+		}
+
+		pending = append(pending, Message{
+			Type:        "telegram",
+			Recipient:   chat,
+			Message:     texts(chat, receipt.Language),
+			Sopts:       broadcast.Sopts,
+			BroadcastId: broadcastId,
+			Edit:        true,
+		})
+
+		edits++
+	}
+
+	queue.MessageQueue = pending
+	return edits, nil
+}
+
+func AddRecipients(queue *SendQueue, store *state.Store, broadcastId int, recipients []int64, texts func(recipient int64, lang string) string) int {
+	/*
+		Sends a broadcast to more recipients, e.g. chats whose filters an edited
+		incident passes now, in the text rendered by texts for each recipient.
+		Recipients the broadcast was already sent to are skipped. Returns the
+		count of recipients added, 0 if the broadcast is no longer tracked.
+	*/
+	langs := make(map[int64]string, len(recipients))
+	for _, chat := range recipients {
+		langs[chat] = state.ChatLanguage(store, chat)
+	}
+
+	queue.Mutex.Lock()
+	defer queue.Mutex.Unlock()
+
+	broadcast, ok := queue.Broadcasts[broadcastId]
+	if !ok {
+		return 0
+	}
+
+	added := 0
+	for _, chat := range recipients {
+		if _, known := broadcast.Receipts[chat]; known {
+			continue
+		}
+
+		broadcast.Receipts[chat] = Receipt{Status: StatusPending, Language: langs[chat]}
+		broadcast.Recipients++
+
+		queue.MessageQueue = append(queue.MessageQueue, Message{
+			Type:        "telegram",
+			Recipient:   chat,
+			Message:     texts(chat, langs[chat]),
+			Sopts:       broadcast.Sopts,
+			BroadcastId: broadcastId,
+		})
+
+		added++
+	}
+
+	return added
+}
+
+func editMessage(queue *SendQueue, session *config.Session, msg *Message) error {
+	/* Edits the message delivered to msg.Recipient as part of msg's broadcast */
+	queue.Mutex.Lock()
+	var messageId int
+	if broadcast, ok := queue.Broadcasts[msg.BroadcastId]; ok {
+		messageId = broadcast.Receipts[msg.Recipient].MessageId
+	}
+	queue.Mutex.Unlock()
+
+	if messageId == 0 {
+		return nil
+	}
+
+	stored := tb.StoredMessage{MessageID: strconv.Itoa(messageId), ChatID: msg.Recipient}
+	_, err := session.Telegram.Edit(stored, msg.Message, &msg.Sopts)
+
+	// Editing to identical content is not an error for us
+	if errors.Is(err, tb.ErrMessageNotModified) || errors.Is(err, tb.ErrSameMessageContent) {
+		return nil
+	}
+
+	return err
+}
+
+func BroadcastSummary(broadcast *Broadcast, lang string) string {
+	/* Produces a one-line delivery report for a broadcast, in lang */
+	number := func(n int) string {
+		return locale.Number(lang, int64(n))
+	}
+
+	summary := locale.T(lang, "owner.broadcast.summary", broadcast.Id, number(broadcast.Delivered), number(broadcast.Recipients))
+
+	if broadcast.Blocked > 0 {
+		summary += locale.T(lang, "owner.broadcast.blocked", number(broadcast.Blocked))
+	}
+
+	if broadcast.Failed > 0 {
+		summary += locale.T(lang, "owner.broadcast.failed", number(broadcast.Failed))
+	}
+
+	if broadcast.Retries > 0 {
+		summary += locale.T(lang, "owner.broadcast.retries", number(broadcast.Retries))
+	}
+
+	return summary
+}
+
+func broadcastDone(queue *SendQueue, conf *config.Config, store *state.Store, broadcast *Broadcast) {
+	/*
+		Logs the delivery report of a finished broadcast and sends it to the
+		owner. The state is saved, so the broadcast's messages can be edited
+		after a restart.
+	*/
+	log.Info().Msgf("📬 Finished %s", BroadcastSummary(broadcast, locale.Default))
+	state.Save(store)
+
+	conf.Mutex.Lock()
+	owner := conf.Broadcast.TelegramOwner
+	conf.Mutex.Unlock()
+
+	if owner == 0 {
+		return
+	}
+
+	AddToQueue(queue, &Message{
+		Type:      "telegram",
+		Recipient: owner,
+		Message:   "📬 " + BroadcastSummary(broadcast, state.ChatLanguage(store, owner)),
+	})
+}
+
+type DeliveryStats struct {
+	/* Delivery totals across the broadcasts kept in memory */
+	Broadcasts int // Count of broadcasts
+	Delivered  int // Successful deliveries
+	Blocked    int // Recipients that blocked the bot or no longer exist
+	Failed     int // Deliveries that failed after all retries
+	Retries    int // Count of retried sends
+}
+
+func (stats DeliveryStats) ErrorRate() float64 {
+	/* Share of finished deliveries that failed, between 0 and 1 */
+	finished := stats.Delivered + stats.Blocked + stats.Failed
+	if finished == 0 {
+		return 0
+	}
+
+	return float64(stats.Failed) / float64(finished)
+}
+
+func RecentDeliveries(queue *SendQueue) DeliveryStats {
+	/* Sums the delivery reports of recent broadcasts */
+	queue.Mutex.Lock()
+	defer queue.Mutex.Unlock()
+
+	stats := DeliveryStats{Broadcasts: len(queue.Broadcasts)}
+	for _, broadcast := range queue.Broadcasts {
+		stats.Delivered += broadcast.Delivered
+		stats.Blocked += broadcast.Blocked
+		stats.Failed += broadcast.Failed
+		stats.Retries += broadcast.Retries
+	}
+
+	return stats
+}
+
+func RecentDeadLetters(queue *SendQueue, count int) ([]DeadLetter, int) {
+	/* Returns a copy of the last count dead letters, newest first, and the total count */
+	queue.Mutex.Lock()
+	defer queue.Mutex.Unlock()
+
+	total := len(queue.DeadLetters)
+	if count > total {
+		count = total
+	}
+
+	letters := make([]DeadLetter, 0, count)
+	for i := total - 1; i >= total-count; i-- {
+		letters = append(letters, queue.DeadLetters[i])
+	}
+
+	return letters, total
+}
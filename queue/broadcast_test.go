@@ -0,0 +1,171 @@
+package queue
+
+import (
+	"errors"
+	"slashcaster/config"
+	"slashcaster/locale"
+	"slashcaster/state"
+	"testing"
+
+	tb "gopkg.in/telebot.v3"
+)
+
+func TestBroadcastReceipts(t *testing.T) {
+	store := state.Store{}
+	store.State.Stats.Broadcasts = 41
+
+	sendQueue := SendQueue{}
+	id := NewBroadcast(&sendQueue, &config.Config{}, &store, []int64{1, 2, 3, 4}, tb.SendOptions{})
+
+	if id != 42 {
+		t.Fatalf("Expected broadcast ID 42, got %d", id)
+	}
+
+	results := []struct {
+		recipient int64
+		err       error
+	}{
+		{1, nil},
+		{2, tb.ErrBlockedByUser},
+		{3, errors.New("timeout")},
+		{3, nil},
+		{4, errors.New("timeout")},
+		{4, errors.New("timeout")},
+	}
+
+	attempts := make(map[int64]int)
+	var finished *Broadcast
+
+	for _, result := range results {
+		msg := Message{Recipient: result.recipient, BroadcastId: id, Attempts: attempts[result.recipient]}
+		_, finished = recordAttempt(&sendQueue, &msg, 0, result.err)
+		attempts[result.recipient] = msg.Attempts
+
+		if finished != nil {
+			t.Fatalf("Broadcast finished early after recipient %d", result.recipient)
+		}
+	}
+
+	// Third failure for recipient 4 exhausts its attempts
+	msg := Message{Recipient: 4, BroadcastId: id, Attempts: attempts[4]}
+	status, finished := recordAttempt(&sendQueue, &msg, 0, errors.New("timeout"))
+
+	if status != StatusFailed || finished == nil {
+		t.Fatalf("Expected broadcast to finish with recipient 4 failed, got status=%s", status)
+	}
+
+	expected := "broadcast #42: 2/4 delivered, 1 blocked, 1 failed (3 retries)"
+	if summary := BroadcastSummary(finished, "en"); summary != expected {
+		t.Fatalf("Expected summary %q, got %q", expected, summary)
+	}
+
+	if len(sendQueue.DeadLetters) != 2 {
+		t.Fatalf("Expected 2 dead letters, got %d", len(sendQueue.DeadLetters))
+	}
+
+	letters, total := RecentDeadLetters(&sendQueue, 1)
+	if total != 2 || len(letters) != 1 || letters[0].Message.Recipient != 4 {
+		t.Fatalf("Expected the newest dead letter, for recipient 4, got %+v of %d", letters, total)
+	}
+
+	stats := RecentDeliveries(&sendQueue)
+	if stats.Delivered != 2 || stats.Failed != 1 || stats.ErrorRate() != 0.25 {
+		t.Fatalf("Expected 2 delivered and 1 failed at a 25%% error rate, got %+v", stats)
+	}
+}
+
+func TestEditBroadcast(t *testing.T) {
+	// Recipient 2 reads German
+	store := state.Store{}
+	state.SetPreferences(&store, 2, state.Preferences{Language: "de"})
+
+	sendQueue := SendQueue{}
+	id := NewBroadcast(&sendQueue, &config.Config{}, &store, []int64{1, 2}, tb.SendOptions{ParseMode: "MarkdownV2"})
+
+	// Recipient 1 has received the message, recipient 2 is still queued
+	msg := Message{Recipient: 1, BroadcastId: id}
+	recordAttempt(&sendQueue, &msg, 1234, nil)
+	AddToQueue(&sendQueue, &Message{Recipient: 2, BroadcastId: id, Message: "old"})
+
+	texts := locale.Texts{"en": "new", "de": "neu"}
+	render := func(recipient int64, lang string) string { return texts.For(lang) }
+
+	if edits, err := EditBroadcast(&sendQueue, id, render); edits != 1 || err != nil {
+		t.Fatalf("Expected 1 edit, got %d (%v)", edits, err)
+	}
+
+	if len(sendQueue.MessageQueue) != 2 {
+		t.Fatalf("Expected 2 queued messages, got %d", len(sendQueue.MessageQueue))
+	}
+
+	expected := map[int64]string{1: "new", 2: "neu"}
+	for _, queued := range sendQueue.MessageQueue {
+		if queued.Message != expected[queued.Recipient] {
+			t.Fatalf("Expected queued message to chat %d to be rewritten in its language, got %q", queued.Recipient, queued.Message)
+		}
+
+		if queued.Edit != (queued.Recipient == 1) {
+			t.Fatalf("Expected only the delivered message to be edited, chat %d has edit=%v", queued.Recipient, queued.Edit)
+		}
+	}
+
+	// A second edit supersedes the first one
+	newer := func(recipient int64, lang string) string { return "newer" }
+	EditBroadcast(&sendQueue, id, newer)
+	if len(sendQueue.MessageQueue) != 2 {
+		t.Fatalf("Expected superseded edit to be dropped, got %d queued messages", len(sendQueue.MessageQueue))
+	}
+
+	// Recipient 2's message was being sent during the edit: it is edited once delivered
+	inFlight := sendQueue.MessageQueue[0]
+	if inFlight.Recipient != 2 {
+		inFlight = sendQueue.MessageQueue[1]
+	}
+
+	sendQueue.MessageQueue = nil
+	inFlight.Message = "neu"
+	recordAttempt(&sendQueue, &inFlight, 5678, nil)
+
+	if len(sendQueue.MessageQueue) != 1 || !sendQueue.MessageQueue[0].Edit || sendQueue.MessageQueue[0].Message != "newer" {
+		t.Fatalf("Expected an edit of the message delivered after the edit, got %+v", sendQueue.MessageQueue)
+	}
+
+	// New recipients get the latest text, known ones are skipped
+	if added := AddRecipients(&sendQueue, &store, id, []int64{1, 3}, newer); added != 1 {
+		t.Fatalf("Expected 1 recipient to be added, got %d", added)
+	}
+
+	if added := sendQueue.MessageQueue[1]; added.Recipient != 3 || added.Edit || added.Message != "newer" {
+		t.Fatalf("Expected the broadcast to be sent to chat 3, got %+v", added)
+	}
+
+	if sendQueue.Broadcasts[id].Recipients != 3 {
+		t.Fatalf("Expected 3 recipients, got %d", sendQueue.Broadcasts[id].Recipients)
+	}
+
+	// Broadcasts are evicted once their messages are no longer kept
+	sendQueue.Broadcasts[id].Created -= int64(state.SentRetention.Seconds()) + 1
+	NewBroadcast(&sendQueue, &config.Config{}, &store, []int64{1}, tb.SendOptions{})
+
+	if _, err := EditBroadcast(&sendQueue, id, newer); !errors.Is(err, ErrBroadcastNotFound) {
+		t.Fatalf("Expected ErrBroadcastNotFound, got %v", err)
+	}
+}
+
+func TestEmptyBroadcast(t *testing.T) {
+	// Broadcasts without recipients are reported right away
+	conf := config.Config{}
+	conf.Broadcast.TelegramOwner = 99
+
+	sendQueue := SendQueue{}
+	id := NewBroadcast(&sendQueue, &conf, &state.Store{}, nil, tb.SendOptions{})
+
+	if len(sendQueue.MessageQueue) != 1 || sendQueue.MessageQueue[0].Recipient != 99 {
+		t.Fatalf("Expected a report to the owner, got %+v", sendQueue.MessageQueue)
+	}
+
+	expected := "📬 broadcast #1: 0/0 delivered"
+	if id != 1 || sendQueue.MessageQueue[0].Message != expected {
+		t.Fatalf("Expected report %q, got %q", expected, sendQueue.MessageQueue[0].Message)
+	}
+}
@@ -0,0 +1,269 @@
+package queue
+
+import (
+	"sync"
+	"time"
+)
+
+type Clock interface {
+	/* Time source for the limiter, swapped for a fake clock in tests */
+	Now() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time // Like time.After, for waits that can be cancelled
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+type Limits struct {
+	/* Telegram's send limits, see https://core.telegram.org/bots/faq#broadcasting-to-users */
+	GlobalPerSecond float64 // Messages per second across all chats
+	ChatPerSecond   float64 // Messages per second to a single private chat
+	GroupPerMinute  float64 // Messages per minute to a single group or channel
+}
+
+// Default limits, used for any limit left unconfigured
+var DefaultLimits = Limits{
+	GlobalPerSecond: 30,
+	ChatPerSecond:   1,
+	GroupPerMinute:  20,
+}
+
+type bucket struct {
+	/* A single token bucket, refilled lazily on access */
+	tokens   float64   // Tokens currently available
+	capacity float64   // Max tokens the bucket can hold (burst size)
+	rate     float64   // Tokens added per second
+	last     time.Time // Last time the bucket was refilled
+}
+
+func newBucket(capacity float64, rate float64, now time.Time) *bucket {
+	return &bucket{tokens: capacity, capacity: capacity, rate: rate, last: now}
+}
+
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.capacity {
+			b.tokens = b.capacity
+		}
+	}
+
+	b.last = now
+}
+
+func (b *bucket) delay() time.Duration {
+	// Time until a single token is available
+	if b.tokens >= 1 {
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+type Limiter struct {
+	/* Token-bucket limiter enforcing a global budget and a budget per chat */
+	Limits      Limits            // Configured limits
+	Clock       Clock             // Time source
+	global      *bucket           // Global send budget
+	chats       map[int64]*bucket // Per-chat send budgets
+	pausedUntil time.Time         // No sends before this, set when flood-limited
+	factor      float64           // Multiplier for the global rate, lowered on 429s
+	mutex       sync.Mutex        // Mutex to avoid concurrent map writes
+}
+
+// Lower bound for the adaptive global rate multiplier
+const minRateFactor = 0.125
+
+// Chat buckets are pruned once the map grows past this size
+const maxIdleChats = 1024
+
+func withDefaults(limits Limits) Limits {
+	// Replace unset limits with defaults
+	if limits.GlobalPerSecond <= 0 {
+		limits.GlobalPerSecond = DefaultLimits.GlobalPerSecond
+	}
+
+	if limits.ChatPerSecond <= 0 {
+		limits.ChatPerSecond = DefaultLimits.ChatPerSecond
+	}
+
+	if limits.GroupPerMinute <= 0 {
+		limits.GroupPerMinute = DefaultLimits.GroupPerMinute
+	}
+
+	return limits
+}
+
+func NewLimiter(limits Limits, clock Clock) *Limiter {
+	/* Creates a limiter, replacing unset limits with defaults */
+	limits = withDefaults(limits)
+	if clock == nil {
+		clock = systemClock{}
+	}
+
+	return &Limiter{
+		Limits: limits,
+		Clock:  clock,
+		global: newBucket(limits.GlobalPerSecond, limits.GlobalPerSecond, clock.Now()),
+		chats:  make(map[int64]*bucket),
+		factor: 1.0,
+	}
+}
+
+func isGroup(chat int64) bool {
+	// Groups, supergroups and channels have negative IDs in the Bot API
+	return chat < 0
+}
+
+func (l *Limiter) chatBucket(chat int64, now time.Time) *bucket {
+	b, ok := l.chats[chat]
+	if !ok {
+		if isGroup(chat) {
+			b = newBucket(l.Limits.GroupPerMinute, l.Limits.GroupPerMinute/60.0, now)
+		} else {
+			b = newBucket(1, l.Limits.ChatPerSecond, now)
+		}
+
+		l.chats[chat] = b
+	}
+
+	b.refill(now)
+	return b
+}
+
+func (l *Limiter) prune() {
+	// Drop buckets that have refilled completely: they are equivalent to new ones
+	for chat, b := range l.chats {
+		if b.tokens >= b.capacity {
+			delete(l.chats, chat)
+		}
+	}
+}
+
+func (l *Limiter) SetLimits(limits Limits) {
+	/* Replaces the limits of a running limiter, e.g. on config reload */
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.Limits = withDefaults(limits)
+
+	// Keep spent tokens, so a reload doesn't allow an extra burst
+	for chat, b := range l.chats {
+		if isGroup(chat) {
+			b.capacity, b.rate = l.Limits.GroupPerMinute, l.Limits.GroupPerMinute/60.0
+		} else {
+			b.rate = l.Limits.ChatPerSecond
+		}
+
+		if b.tokens > b.capacity {
+			b.tokens = b.capacity
+		}
+	}
+}
+
+func (l *Limiter) Delay(chat int64) time.Duration {
+	/* Returns how long until a message can be sent to chat, without consuming tokens */
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.delay(chat, l.Clock.Now())
+}
+
+func (l *Limiter) delay(chat int64, now time.Time) time.Duration {
+	var wait time.Duration
+	if now.Before(l.pausedUntil) {
+		wait = l.pausedUntil.Sub(now)
+	}
+
+	// Scale the global budget by the adaptive rate factor
+	l.global.rate = l.Limits.GlobalPerSecond * l.factor
+	l.global.capacity = l.global.rate
+	l.global.refill(now)
+
+	if d := l.global.delay(); d > wait {
+		wait = d
+	}
+
+	if d := l.chatBucket(chat, now).delay(); d > wait {
+		wait = d
+	}
+
+	return wait
+}
+
+func (l *Limiter) Take(chat int64) time.Duration {
+	/* Consumes a token for chat if one is available, otherwise returns the time to wait */
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.Clock.Now()
+	if wait := l.delay(chat, now); wait > 0 {
+		return wait
+	}
+
+	l.global.tokens--
+	l.chats[chat].tokens--
+
+	if len(l.chats) > maxIdleChats {
+		l.prune()
+	}
+
+	return 0
+}
+
+func (l *Limiter) Wait(chat int64) {
+	/* Blocks until a message can be sent to chat, then consumes a token */
+	for {
+		wait := l.Take(chat)
+		if wait == 0 {
+			return
+		}
+
+		l.Clock.Sleep(wait)
+	}
+}
+
+func (l *Limiter) Backoff(retryAfter time.Duration) {
+	/* Pauses all sends for retryAfter and halves the global rate after a 429 */
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.Clock.Now()
+	if until := now.Add(retryAfter); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+
+	l.factor /= 2
+	if l.factor < minRateFactor {
+		l.factor = minRateFactor
+	}
+
+	// Drain the global bucket so sends resume at the lowered rate
+	l.global.refill(now)
+	l.global.tokens = 0
+}
+
+func (l *Limiter) Success() {
+	/* Recovers the global rate slowly after successful sends */
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.factor < 1.0 {
+		l.factor += 0.01
+		if l.factor > 1.0 {
+			l.factor = 1.0
+		}
+	}
+}
+
+func (l *Limiter) Factor() float64 {
+	/* Returns the current global rate multiplier */
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.factor
+}
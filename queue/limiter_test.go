@@ -0,0 +1,199 @@
+package queue
+
+import (
+	"context"
+	"slashcaster/config"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time        { return c.now }
+func (c *fakeClock) Sleep(d time.Duration) { c.now = c.now.Add(d) }
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	// Advance the clock at once, as if the wait was over
+	c.Sleep(d)
+
+	after := make(chan time.Time, 1)
+	after <- c.now
+	return after
+}
+
+func newTestLimiter(limits Limits) (*Limiter, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1660000000, 0)}
+	return NewLimiter(limits, clock), clock
+}
+
+func TestGlobalLimit(t *testing.T) {
+	limiter, clock := newTestLimiter(Limits{GlobalPerSecond: 30})
+	start := clock.Now()
+
+	// 90 distinct chats at 30 msg/s should take two seconds after the initial burst
+	for chat := int64(1); chat <= 90; chat++ {
+		limiter.Wait(chat)
+	}
+
+	elapsed := clock.Now().Sub(start)
+	if elapsed < 1900*time.Millisecond || elapsed > 2100*time.Millisecond {
+		t.Fatalf("Expected ~2s to send 90 messages, took %s", elapsed)
+	}
+}
+
+func TestChatLimit(t *testing.T) {
+	limiter, clock := newTestLimiter(Limits{ChatPerSecond: 1})
+
+	if wait := limiter.Take(42); wait != 0 {
+		t.Fatalf("Expected first message to send immediately, got wait=%s", wait)
+	}
+
+	if wait := limiter.Take(42); wait != time.Second {
+		t.Fatalf("Expected second message to the same chat to wait 1s, got wait=%s", wait)
+	}
+
+	// Other chats are unaffected
+	if wait := limiter.Take(43); wait != 0 {
+		t.Fatalf("Expected another chat to send immediately, got wait=%s", wait)
+	}
+
+	clock.Sleep(time.Second)
+	if wait := limiter.Take(42); wait != 0 {
+		t.Fatalf("Expected chat to be sendable after 1s, got wait=%s", wait)
+	}
+}
+
+func TestGroupLimit(t *testing.T) {
+	limiter, clock := newTestLimiter(Limits{GroupPerMinute: 20})
+	group := int64(-1001234567890)
+
+	// A group may burst up to its per-minute budget
+	for i := 0; i < 20; i++ {
+		if wait := limiter.Take(group); wait != 0 {
+			t.Fatalf("Expected message %d to the group to send immediately, got wait=%s", i, wait)
+		}
+
+		clock.Sleep(50 * time.Millisecond)
+	}
+
+	// ...after which it refills at 20 messages per minute
+	wait := limiter.Take(group)
+	if wait <= 0 || wait > 3*time.Second {
+		t.Fatalf("Expected group to wait up to 3s after its burst, got wait=%s", wait)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	limiter, clock := newTestLimiter(Limits{GlobalPerSecond: 30})
+	limiter.Backoff(5 * time.Second)
+
+	if factor := limiter.Factor(); factor != 0.5 {
+		t.Fatalf("Expected rate factor to halve to 0.5, got %f", factor)
+	}
+
+	if wait := limiter.Take(1); wait != 5*time.Second {
+		t.Fatalf("Expected sends to pause for retry_after=5s, got wait=%s", wait)
+	}
+
+	// After the pause, the global rate is halved: a burst of 15, then 15 msg/s
+	clock.Sleep(5 * time.Second)
+	start := clock.Now()
+	for chat := int64(1); chat <= 30; chat++ {
+		limiter.Wait(chat)
+	}
+
+	if elapsed := clock.Now().Sub(start); elapsed < 900*time.Millisecond {
+		t.Fatalf("Expected halved rate after backoff, 30 messages took %s", elapsed)
+	}
+
+	// Repeated floods never stop sending completely
+	for i := 0; i < 10; i++ {
+		limiter.Backoff(time.Second)
+	}
+
+	if factor := limiter.Factor(); factor != minRateFactor {
+		t.Fatalf("Expected rate factor to bottom out at %f, got %f", minRateFactor, factor)
+	}
+
+	// Successful sends recover the rate
+	for i := 0; i < 200; i++ {
+		limiter.Success()
+	}
+
+	if factor := limiter.Factor(); factor != 1.0 {
+		t.Fatalf("Expected rate factor to recover to 1.0, got %f", factor)
+	}
+}
+
+func TestSetLimits(t *testing.T) {
+	limiter, _ := newTestLimiter(Limits{ChatPerSecond: 1})
+	limiter.Take(42)
+
+	// Lowering the chat limit slows down refills of existing buckets
+	limiter.SetLimits(Limits{ChatPerSecond: 0.5})
+	if wait := limiter.Take(42); wait != 2*time.Second {
+		t.Fatalf("Expected reloaded limit to apply to existing chats, got wait=%s", wait)
+	}
+}
+
+func TestNextMessageSkipsBusyChats(t *testing.T) {
+	limiter, _ := newTestLimiter(Limits{})
+	sendQueue := SendQueue{Limiter: limiter}
+
+	AddToQueue(&sendQueue, &Message{Recipient: 1, Message: "a"})
+	AddToQueue(&sendQueue, &Message{Recipient: 1, Message: "b"})
+	AddToQueue(&sendQueue, &Message{Recipient: 2, Message: "c"})
+
+	expected := []string{"a", "c"}
+	for _, text := range expected {
+		msg, _, ok := nextMessage(&sendQueue)
+		if !ok || msg.Message != text {
+			t.Fatalf("Expected message %q, got %q (ok=%v)", text, msg.Message, ok)
+		}
+	}
+
+	// Chat 1 is rate-limited: nothing ready, caller should wait
+	if _, wait, ok := nextMessage(&sendQueue); ok || wait == 0 {
+		t.Fatalf("Expected to wait for chat 1, got ok=%v wait=%s", ok, wait)
+	}
+}
+
+type cancellingClock struct {
+	*fakeClock
+	cancel func()     // Cancels the sender once the queue is empty
+	queue  *SendQueue // Queue the sender works on
+}
+
+func (c *cancellingClock) After(d time.Duration) <-chan time.Time {
+	if QueueLength(c.queue) == 0 {
+		c.cancel()
+	}
+
+	return c.fakeClock.After(d)
+}
+
+func TestSenderWaitsThroughClock(t *testing.T) {
+	// Discord sends fail without a Discord session, so every message is attempted until dead-lettered
+	limiter, clock := newTestLimiter(Limits{})
+	sendQueue := SendQueue{Limiter: limiter}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	limiter.Clock = &cancellingClock{fakeClock: clock, cancel: cancel, queue: &sendQueue}
+
+	AddToQueue(&sendQueue, &Message{Type: "discord", Recipient: 1})
+	AddToQueue(&sendQueue, &Message{Type: "discord", Recipient: 1})
+
+	start := clock.Now()
+	MessageSender(ctx, &sendQueue, &config.Session{})
+
+	if len(sendQueue.DeadLetters) != 2 {
+		t.Fatalf("Expected both messages to be dead-lettered, got %d", len(sendQueue.DeadLetters))
+	}
+
+	// 6 sends to one chat at 1 msg/s: the throttled sends waited on the fake clock
+	if elapsed := clock.Now().Sub(start); elapsed < 5*time.Second {
+		t.Fatalf("Expected the sender to wait at least 5s on the clock, waited %s", elapsed)
+	}
+}
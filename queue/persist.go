@@ -0,0 +1,129 @@
+package queue
+
+import (
+	"encoding/json"
+	"slashcaster/state"
+	"time"
+
+	tb "gopkg.in/telebot.v3"
+)
+
+func QueueLength(queue *SendQueue) int {
+	queue.Mutex.Lock()
+	defer queue.Mutex.Unlock()
+
+	return len(queue.MessageQueue)
+}
+
+func Drain(queue *SendQueue, timeout time.Duration) bool {
+	/* Waits for the queue to empty, returns false if it did not within timeout */
+	deadline := time.Now().Add(timeout)
+
+	for QueueLength(queue) != 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+
+		time.Sleep(time.Millisecond * 100)
+	}
+
+	return true
+}
+
+func Persist(queue *SendQueue, store *state.Store) error {
+	/* Saves unsent messages in the state store, so they can be restored on the next start */
+	queue.Mutex.Lock()
+	pending := queue.MessageQueue
+	queue.Mutex.Unlock()
+
+	if len(pending) == 0 {
+		// Nothing to persist: clear any stale queue
+		return state.SaveQueue(store, nil)
+	}
+
+	jsonbytes, err := json.Marshal(pending)
+	if err != nil {
+		return err
+	}
+
+	return state.SaveQueue(store, jsonbytes)
+}
+
+func restoreBroadcasts(queue *SendQueue, store *state.Store) {
+	// Rebuild the broadcasts whose messages are kept in the state store, so they can be edited
+	for id, sent := range state.SentBroadcasts(store) {
+		broadcast := &Broadcast{
+			Id:         id,
+			Created:    sent.Created,
+			Recipients: len(sent.Messages),
+			Delivered:  len(sent.Messages),
+			Sopts:      tb.SendOptions{ParseMode: tb.ParseMode(sent.ParseMode), DisableWebPagePreview: sent.NoPreview},
+			Receipts:   make(map[int64]Receipt, len(sent.Messages)),
+		}
+
+		for chatId, messageId := range sent.Messages {
+			broadcast.Receipts[chatId] = Receipt{
+				Status:    StatusDelivered,
+				Attempts:  1,
+				MessageId: messageId,
+				Language:  state.ChatLanguage(store, chatId),
+			}
+		}
+
+		queue.Mutex.Lock()
+		if queue.Broadcasts == nil {
+			queue.Broadcasts = make(map[int]*Broadcast)
+		}
+
+		queue.Broadcasts[id] = broadcast
+		queue.Mutex.Unlock()
+	}
+}
+
+func Restore(queue *SendQueue, store *state.Store) (int, error) {
+	/*
+		Rebuilds the broadcasts kept in the state store, then loads messages
+		persisted in the store into the queue and clears them. Reports of
+		broadcasts interrupted by a restart only count the recipients delivered
+		before it, and those still pending.
+	*/
+	restoreBroadcasts(queue, store)
+
+	fbytes, err := state.LoadQueue(store)
+	if err != nil || fbytes == nil {
+		return 0, err
+	}
+
+	var pending []Message
+	if err = json.Unmarshal(fbytes, &pending); err != nil {
+		return 0, err
+	}
+
+	restored := 0
+	for _, msg := range pending {
+		lang := state.ChatLanguage(store, msg.Recipient)
+
+		queue.Mutex.Lock()
+		broadcast, ok := queue.Broadcasts[msg.BroadcastId]
+		if ok && !msg.Edit {
+			// Report the broadcast once its pending recipients are done
+			broadcast.Recipients++
+			broadcast.Receipts[msg.Recipient] = Receipt{Status: StatusPending, Attempts: msg.Attempts, Language: lang}
+		}
+		queue.Mutex.Unlock()
+
+		// Edits refer to message IDs of broadcasts we no longer track
+		if !ok {
+			if msg.Edit {
+				continue
+			}
+
+			msg.BroadcastId = 0
+		}
+
+		AddToQueue(queue, &msg)
+		restored++
+	}
+
+	return restored, state.SaveQueue(store, nil)
+}
@@ -0,0 +1,106 @@
+package queue
+
+import (
+	"slashcaster/config"
+	"slashcaster/state"
+	"testing"
+
+	tb "gopkg.in/telebot.v3"
+)
+
+func TestPersistRestore(t *testing.T) {
+	store, err := state.Load(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sendQueue := SendQueue{}
+	AddToQueue(&sendQueue, &Message{Type: "telegram", Recipient: 1, Message: "a", BroadcastId: 3,
+		Sopts: tb.SendOptions{ParseMode: "MarkdownV2"}})
+	AddToQueue(&sendQueue, &Message{Type: "telegram", Recipient: 2, Message: "b", BroadcastId: 3, Edit: true})
+
+	if err = Persist(&sendQueue, store); err != nil {
+		t.Fatalf("Persisting queue failed: %v", err)
+	}
+
+	restoredQueue := SendQueue{}
+	restored, err := Restore(&restoredQueue, store)
+	if err != nil {
+		t.Fatalf("Restoring queue failed: %v", err)
+	}
+
+	// Edits are dropped, as the broadcasts they refer to are gone
+	if restored != 1 || restoredQueue.MessageQueue[0].Message != "a" {
+		t.Fatalf("Expected message \"a\" to be restored, got %d message(s)", restored)
+	}
+
+	if restoredQueue.MessageQueue[0].Sopts.ParseMode != "MarkdownV2" {
+		t.Fatalf("Expected send options to be restored")
+	}
+
+	// The queue is consumed on restore
+	if restored, _ = Restore(&restoredQueue, store); restored != 0 {
+		t.Fatalf("Expected persisted queue to be removed after restore")
+	}
+}
+
+func TestRestoreBroadcasts(t *testing.T) {
+	// Broadcasts kept in the state can be edited after a restart
+	dir := t.TempDir()
+	store, err := state.Load(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sendQueue := SendQueue{}
+	id := NewBroadcast(&sendQueue, &config.Config{}, store, []int64{1, 2}, tb.SendOptions{ParseMode: "MarkdownV2"})
+
+	msg := Message{Recipient: 1, BroadcastId: id}
+	recordAttempt(&sendQueue, &msg, 1234, nil)
+	state.MessageSent(store, id, 1, 1234)
+	AddToQueue(&sendQueue, &Message{Type: "telegram", Recipient: 2, Message: "old", BroadcastId: id})
+
+	if err = Persist(&sendQueue, store); err != nil {
+		t.Fatalf("Persisting queue failed: %v", err)
+	}
+
+	if err = state.Close(store); err != nil {
+		t.Fatalf("Closing store failed: %v", err)
+	}
+
+	// Restart
+	if store, err = state.Load(dir, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	restoredQueue := SendQueue{}
+	if restored, err := Restore(&restoredQueue, store); restored != 1 || err != nil {
+		t.Fatalf("Expected 1 restored message, got %d (%v)", restored, err)
+	}
+
+	render := func(recipient int64, lang string) string { return "new" }
+	if edits, err := EditBroadcast(&restoredQueue, id, render); edits != 1 || err != nil {
+		t.Fatalf("Expected 1 edit of the delivered message, got %d (%v)", edits, err)
+	}
+
+	for _, queued := range restoredQueue.MessageQueue {
+		if queued.Message != "new" || queued.Edit != (queued.Recipient == 1) {
+			t.Fatalf("Expected the delivered message to be edited and the pending one rewritten, got %+v", queued)
+		}
+	}
+
+	pending, edit := restoredQueue.MessageQueue[0], restoredQueue.MessageQueue[1]
+	if pending.Edit {
+		pending, edit = edit, pending
+	}
+
+	if edit.Sopts.ParseMode != "MarkdownV2" {
+		t.Fatalf("Expected send options of the broadcast to be restored for edits")
+	}
+
+	// The broadcast is reported once the pending recipient is done
+
+	if _, finished := recordAttempt(&restoredQueue, &pending, 5678, nil); finished == nil || finished.Delivered != 2 {
+		t.Fatalf("Expected the broadcast to finish with 2 deliveries, got %+v", finished)
+	}
+}
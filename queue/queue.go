@@ -1,26 +1,50 @@
 package queue
 
 import (
+	"context"
+	"errors"
 	"slashcaster/config"
+	"slashcaster/state"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
+
+	dg "github.com/bwmarrin/discordgo"
 	tb "gopkg.in/telebot.v3"
 )
 
 type Message struct {
-	Type      string         // Type of the message ("telegram", "discord")
-	Recipient int64          // Recipient of the message
-	Message   string         // Caption for the photo
-	Sopts     tb.SendOptions // Send options
+	Type        string           // Type of the message ("telegram", "discord")
+	Recipient   int64            // Recipient of the message
+	Message     string           // Caption for the photo
+	Sopts       tb.SendOptions   // Send options
+	BroadcastId int              // Broadcast the message belongs to, 0 if none
+	Attempts    int              // Count of send attempts made
+	Edit        bool             // Edit the broadcast's sent message instead of sending
+	Embed       *dg.MessageEmbed `json:",omitempty"` // Embed sent to Discord channels
 }
 
 type SendQueue struct {
 	/* Enforces a rate-limiter to stay within Telegram's send-rate boundaries */
-	MessagesPerSecond int        // Messages-per-second limit
-	MessageQueue      []Message  // Queue of messages to send
-	Mutex             sync.Mutex // Mutex to avoid concurrent writes
+	Limiter      *Limiter           // Token-bucket limiter for global and per-chat limits
+	MessageQueue []Message          // Queue of messages to send
+	Broadcasts   map[int]*Broadcast // Delivery reports of recent broadcasts
+	DeadLetters  []DeadLetter       // Messages that could not be delivered
+	Mutex        sync.Mutex         // Mutex to avoid concurrent writes
+}
+
+func LimitsFromConfig(conf *config.Config) Limits {
+	/* Maps the configured rate-limits to limiter limits */
+	conf.Mutex.Lock()
+	defer conf.Mutex.Unlock()
+
+	return Limits{
+		GlobalPerSecond: float64(conf.RateLimit),
+		ChatPerSecond:   float64(conf.ChatRateLimit),
+		GroupPerMinute:  float64(conf.GroupRateLimit),
+	}
 }
 
 func AddToQueue(queue *SendQueue, message *Message) {
@@ -29,46 +53,153 @@ func AddToQueue(queue *SendQueue, message *Message) {
 	queue.Mutex.Unlock()
 }
 
+func nextMessage(queue *SendQueue) (Message, time.Duration, bool) {
+	/*
+		Pops the first message whose recipient can be sent to right now. If no
+		recipient is ready, returns the shortest time to wait instead.
+	*/
+	queue.Mutex.Lock()
+	defer queue.Mutex.Unlock()
+
+	if len(queue.MessageQueue) == 0 {
+		return Message{}, 0, false
+	}
+
+	var minWait time.Duration
+	for i, msg := range queue.MessageQueue {
+		wait := queue.Limiter.Take(msg.Recipient)
+
+		if wait == 0 {
+			// Remove from queue, keeping the order of the remaining messages
+			queue.MessageQueue = append(queue.MessageQueue[:i], queue.MessageQueue[i+1:]...)
+			return msg, 0, true
+		}
+
+		if minWait == 0 || wait < minWait {
+			minWait = wait
+		}
+	}
+
+	return Message{}, minWait, false
+}
+
+func requeue(queue *SendQueue, msg Message) {
+	// Put a message back at the front of the queue
+	queue.Mutex.Lock()
+	queue.MessageQueue = append([]Message{msg}, queue.MessageQueue...)
+	queue.Mutex.Unlock()
+}
+
 func handleSendError(msg Message, err error) {
-	log.Error().Err(err).Msg("Error sending message")
+	log.Error().Err(err).Msgf("Error sending message to chat=%d", msg.Recipient)
+}
+
+func sendDiscord(session *config.Session, msg *Message) error {
+	// Send a message's embed to a Discord channel
+	if session.Discord == nil {
+		return errors.New("Discord bot is not configured")
+	}
+
+	_, err := session.Discord.ChannelMessageSendEmbed(strconv.FormatInt(msg.Recipient, 10), msg.Embed)
+	return err
 }
 
-func MessageSender(queue *SendQueue, session *config.Session) {
-	/* Function clears the SendQueue and stays within API limits while doing so */
-	for {
-		// If queue is not empty, clear it
-		if len(queue.MessageQueue) != 0 {
-			// Lock sendQueue for parsing
-			queue.Mutex.Lock()
-
-			// Iterate over queue
-			for i, msg := range queue.MessageQueue {
-				// Send message
-				var err error
-				if msg.Type == "telegram" {
-					_, err = session.Telegram.Send(tb.ChatID(int64(msg.Recipient)), msg.Message, &msg.Sopts)
-				} else if msg.Type == "discord" {
-					log.Warn().Msg("Discord message sender not implemented!")
-				}
-
-				if err != nil {
-					handleSendError(msg, err)
-				}
-
-				// Sleep long enough to stay within API limits: convert messagesPerSecond to ms
-				if i < len(queue.MessageQueue)-1 {
-					time.Sleep(time.Millisecond * time.Duration(1.0/queue.MessagesPerSecond*1000.0))
-				}
+func MessageSender(ctx context.Context, queue *SendQueue, session *config.Session) {
+	/*
+		Function clears the SendQueue and stays within API limits while doing so.
+		Returns once ctx is cancelled; a message being sent is always finished.
+	*/
+	for ctx.Err() == nil {
+		msg, wait, ok := nextMessage(queue)
+
+		if !ok {
+			if wait == 0 {
+				// Queue is empty: sleep while waiting for updates
+				wait = time.Millisecond * 500
 			}
 
-			// Clear queue
-			queue.MessageQueue = nil
+			select {
+			case <-ctx.Done():
+			case <-queue.Limiter.Clock.After(wait):
+			}
+
+			continue
+		}
+
+		// Send message, or edit a previously sent one
+		var err error
+		var sent *tb.Message
+		if msg.Type == "telegram" {
+			if msg.Edit {
+				err = editMessage(queue, session, &msg)
+			} else {
+				sent, err = session.Telegram.Send(tb.ChatID(msg.Recipient), msg.Message, &msg.Sopts)
+			}
+		} else if msg.Type == "discord" {
+			err = sendDiscord(session, &msg)
+		}
+
+		// If we were flood-limited, back off and retry the message
+		var floodErr tb.FloodError
+		if errors.As(err, &floodErr) {
+			retryAfter := time.Duration(floodErr.RetryAfter) * time.Second
+			queue.Limiter.Backoff(retryAfter)
+			recordRetry(queue, &msg)
+			requeue(queue, msg)
 
-			// Batch send done, unlock sendQueue
-			queue.Mutex.Unlock()
+			log.Warn().Msgf("🚦 Flood-limited by Telegram: pausing sends for %s, rate at %.0f%%",
+				retryAfter, queue.Limiter.Factor()*100)
+			continue
 		}
 
-		// Sleep while waiting for updates
-		time.Sleep(time.Millisecond * 500)
+		// If the group was upgraded to a supergroup, move it and retry at its new ID
+		var groupErr tb.GroupError
+		if errors.As(err, &groupErr) && groupErr.MigratedTo != 0 && !msg.Edit {
+			if _, err := state.MigrateChat(session.State, msg.Recipient, groupErr.MigratedTo); err != nil {
+				log.Error().Err(err).Msgf("⚠️ Error migrating chat=%d", msg.Recipient)
+			}
+
+			log.Info().Msgf("📦 Chat %d migrated to %d: resending", msg.Recipient, groupErr.MigratedTo)
+			msg.Recipient = groupErr.MigratedTo
+			requeue(queue, msg)
+			continue
+		}
+
+		// Edits don't produce delivery receipts
+		if msg.Edit {
+			if err != nil {
+				handleSendError(msg, err)
+			}
+
+			continue
+		}
+
+		// Record delivery receipt
+		var messageId int
+		if sent != nil {
+			messageId = sent.ID
+		}
+
+		status, finished := recordAttempt(queue, &msg, messageId, err)
+
+		if err != nil {
+			handleSendError(msg, err)
+
+			// Transient error: retry at the back of the queue
+			if status == StatusPending {
+				AddToQueue(queue, &msg)
+			}
+		} else {
+			queue.Limiter.Success()
+			state.MessageDelivered(session.State)
+
+			if msg.BroadcastId != 0 && messageId != 0 {
+				state.MessageSent(session.State, msg.BroadcastId, msg.Recipient, messageId)
+			}
+		}
+
+		if finished != nil {
+			broadcastDone(queue, session.Config, session.State, finished)
+		}
 	}
 }
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
+	stdlog "log"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -10,6 +13,7 @@ import (
 	"slashcaster/config"
 	"slashcaster/queue"
 	"slashcaster/spam"
+	"slashcaster/state"
 	"syscall"
 	"time"
 
@@ -18,16 +22,36 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-func setupSignalHandler(conf *config.Config) {
-	// Listens for incoming interrupt signals, dumps config if detected
+// How long the send queue is given to drain on shutdown
+const drainTimeout = time.Second * 30
+
+// How long the slot streamer is given to finish its current slot on shutdown
+const streamerTimeout = time.Second * 30
+
+func setupSignalHandler(cancel context.CancelFunc, reload func()) {
+	// Listens for incoming interrupt signals, starts a graceful shutdown if detected
 	channel := make(chan os.Signal, 2)
 	signal.Notify(channel, os.Interrupt, syscall.SIGTERM)
 
+	// SIGHUP reloads the config
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	go func() {
+		for range hangup {
+			reload()
+		}
+	}()
+
 	go func() {
 		<-channel
-		go log.Info().Msg("🚦 Received interrupt signal: dumping config...")
-		config.DumpConfig(conf)
-		os.Exit(0)
+		log.Info().Msg("🚦 Received interrupt signal: shutting down...")
+		cancel()
+
+		// A second signal skips the graceful shutdown
+		<-channel
+		log.Warn().Msg("🚦 Received second interrupt signal: exiting now!")
+		os.Exit(1)
 	}()
 }
 
@@ -49,28 +73,85 @@ func setupLogFile(logFolder string) *os.File {
 	return logf
 }
 
+func reloadConfig(session *config.Session, sendQueue *queue.SendQueue, options config.Options) {
+	// Re-read the config, apply safe changes to the running bot
+	log.Info().Msg("🔄 Received SIGHUP: reloading config...")
+
+	changes, err := config.Reload(session.Config, options)
+	if err != nil {
+		log.Error().Err(err).Msg("⚠️ Config reload failed: keeping the current config")
+		return
+	}
+
+	// Templates are re-read even if the config is unchanged, so edits to them apply
+	if err = api.LoadTemplates(session.Config); err != nil {
+		log.Error().Err(err).Msg("⚠️ Error reloading alert templates: keeping the current templates")
+	}
+
+	if len(changes) == 0 {
+		log.Info().Msg("🔄 Config reloaded: no changes")
+		return
+	}
+
+	for _, change := range changes {
+		log.Info().Msgf("🔄 %s", change)
+	}
+
+	// Endpoints and broadcast targets are read on use, limits are pushed to the limiter
+	sendQueue.Limiter.SetLimits(queue.LimitsFromConfig(session.Config))
+
+	session.Config.Mutex.Lock()
+	spamLimits := session.Config.Spam
+	session.Config.Mutex.Unlock()
+
+	session.Spam.Limiter.SetLimits(spamLimits)
+	log.Info().Msgf("🔄 Config reloaded: %d change(s)", len(changes))
+}
+
 func main() {
 	// Create session
 	session := config.Session{}
 
+	// Command line arguments
+	options := config.Options{Interactive: config.IsTerminal(os.Stdin)}
+
+	flag.StringVar(&options.ConfigFile, "config", "", "Path of the config file (default ./config/bot-config.json)")
+	flag.StringVar(&options.StateDir, "state-dir", "", "Folder to store runtime state in (default: the config's folder)")
+	flag.BoolVar(&options.Debug, "debug", false, "Specify to enable debug mode")
+	flag.BoolVar(&options.NoStream, "no-stream", false, "Specify to disable slot streaming")
+	flag.Parse()
+
+	// Commands run, then exit
+	if flag.NArg() != 0 {
+		os.Exit(runCommand(flag.Args(), options))
+	}
+
 	// Load (or create) config, set version number
-	session.Config = config.LoadConfig("")
+	var err error
+	session.Config, err = config.Load(options)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️ Error loading config: %s\n", err)
+		os.Exit(1)
+	}
+
 	session.Config.Version = "1.5.0"
 
-	// Setup anti-spam
-	session.Spam = &spam.AntiSpam{}
-	session.Spam.ChatBannedUntilTimestamp = make(map[int64]int64)
-	session.Spam.ChatLogs = make(map[int64]spam.ChatLog)
-	session.Spam.ChatBanned = make(map[int64]bool)
-	session.Spam.Rules = make(map[string]int64)
+	// Hold the state while running, so imports refuse to run alongside the bot
+	unlockState, err := state.Lock(config.Dir(session.Config))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️ Error locking state: %s\n", err)
+		os.Exit(1)
+	}
 
-	// Add rules
-	session.Spam.Rules["TimeBetweenCommands"] = 1
+	// Load runtime state from the configured storage backend
+	session.State, err = config.OpenState(session.Config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️ Error loading state: %s\n", err)
+		os.Exit(1)
+	}
 
-	// Command line arguments
-	flag.BoolVar(&session.Config.Debug, "debug", false, "Specify to enable debug mode")
-	flag.BoolVar(&session.Config.NoStream, "no-stream", false, "Specify to disable slot streaming")
-	flag.Parse()
+	// Setup anti-spam, with bans persisted in the state store
+	session.Spam = spam.NewAntiSpam(session.State, spam.NewLimiter(session.Config.Spam, nil))
 
 	// Set-up logging
 	if !session.Config.Debug {
@@ -79,43 +160,115 @@ func main() {
 		defer logf.Close()
 
 		//log.Logger = zerolog.New(logf).With().Logger()
-		log.Logger = log.Output(zerolog.ConsoleWriter{Out: logf, NoColor: true, TimeFormat: time.RFC822Z})
+		log.Logger = log.Output(zerolog.ConsoleWriter{Out: config.RedactingWriter(logf, session.Config), NoColor: true, TimeFormat: time.RFC822Z})
 	} else {
 		// If debugging, output to console
-		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC822Z})
+		log.Logger = log.Output(zerolog.ConsoleWriter{Out: config.RedactingWriter(os.Stderr, session.Config), TimeFormat: time.RFC822Z})
+	}
+
+	// Libraries log through the standard logger: redact those logs too
+	stdlog.SetOutput(config.RedactingWriter(os.Stderr, session.Config))
+
+	// Load alert templates: the config has been validated, so they parse
+	if err = api.LoadTemplates(session.Config); err != nil {
+		log.Error().Err(err).Msg("⚠️ Error loading alert templates: using the built-in templates")
+	}
+
+	// Create send queue
+	sendQueue := queue.SendQueue{Limiter: queue.NewLimiter(queue.LimitsFromConfig(session.Config), nil)}
+
+	// Handle signals: ctx is cancelled on shutdown, the config is reloaded on SIGHUP
+	ctx, cancel := context.WithCancel(context.Background())
+	setupSignalHandler(cancel, func() { reloadConfig(&session, &sendQueue, options) })
+
+	// Restore messages left over from the last run
+	if restored, err := queue.Restore(&sendQueue, session.State); err != nil {
+		log.Error().Err(err).Msg("⚠️ Error restoring send queue")
+	} else if restored > 0 {
+		log.Info().Msgf("📨 Restored %d unsent message(s)", restored)
 	}
 
-	// Handle signals
-	setupSignalHandler(session.Config)
+	// Start MessageSender in a goroutine. It keeps running after ctx is
+	// cancelled, so the queue can drain during shutdown.
+	senderCtx, stopSender := context.WithCancel(context.Background())
+	senderDone := make(chan struct{})
+
+	go func() {
+		queue.MessageSender(senderCtx, &sendQueue, &session)
+		close(senderDone)
+	}()
 
-	// Create send queue, start MessageSender in a goroutine
-	sendQueue := queue.SendQueue{MessagesPerSecond: session.Config.RateLimit}
-	go queue.MessageSender(&sendQueue, &session)
+	// Streaming is controlled through owner commands. Bot commands query the
+	// beacon node through the streamer's client.
+	streamer := api.NewStreamer(api.NewBeaconClient(session.Config))
 
 	// Set-up Telegram bot
-	bots.SetupTelegramBot(&session, &sendQueue)
+	bots.SetupTelegramBot(&session, &sendQueue, streamer)
 
 	// Set-up Discord bot
-	bots.SetupDiscordBot(&session, &sendQueue)
+	bots.SetupDiscordBot(&session, &sendQueue, streamer)
 
 	// Start slotStreamer in a goroutine, unless explicitly disabled
+	streamerDone := make(chan struct{})
 	if !session.Config.NoStream {
-		go api.SlotStreamer(&sendQueue, session.Config)
+		go func() {
+			api.SlotStreamer(ctx, &sendQueue, session.Config, session.State, streamer)
+			close(streamerDone)
+		}()
 	} else {
 		log.Warn().Msg("⛔️ Slot-streaming explicitly disabled!")
+		close(streamerDone)
 	}
 
-	// Regularly dump config to disk
+	// Regularly save state to disk: covers changes made outside transactions
 	scheduler := gocron.NewScheduler(time.UTC)
-	scheduler.Every(30).Minutes().Do(config.DumpConfig, session.Config)
+	scheduler.Every(30).Minutes().Do(state.Save, session.State)
+
+	// Send digests to subscribers not on real-time delivery
+	scheduler.Every(1).Hour().StartAt(time.Now().Truncate(time.Hour).Add(time.Hour)).Do(
+		api.SendDigest, &sendQueue, session.Config, session.State, state.DeliveryHourly)
+	scheduler.Every(1).Day().At("00:00").Do(api.SendDigest, &sendQueue, session.Config, session.State, state.DeliveryDaily)
+	scheduler.Every(1).Monday().At("00:00").Do(api.SendDigest, &sendQueue, session.Config, session.State, state.DeliveryWeekly)
+
+	scheduler.StartAsync()
 
 	// Log start
 	log.Debug().Msgf("🔪 SlashCaster %s started at %s", session.Config.Version, time.Now())
 
-	// Start Telegram bot
-	/*
-		TODO: run in a go-thread, start in bots package?
-		Depends on how Discord bot is started
-	*/
-	session.Telegram.Start()
+	// Run Telegram bot until shutdown
+	bots.RunTelegramBot(ctx, &session)
+
+	// Shutdown: bot polling has stopped, stop scheduled jobs and the Discord bot
+	scheduler.Stop()
+	bots.StopDiscordBot(&session)
+
+	// Let the streamer finish its current slot
+	select {
+	case <-streamerDone:
+	case <-time.After(streamerTimeout):
+		log.Warn().Msg("⚠️ Slot streamer did not stop in time")
+	}
+
+	// Flush the queue, persist whatever could not be sent in time
+	if !queue.Drain(&sendQueue, drainTimeout) {
+		log.Warn().Msgf("⚠️ Send queue did not drain in time: persisting %d message(s)", queue.QueueLength(&sendQueue))
+	}
+
+	stopSender()
+	<-senderDone
+
+	if err := queue.Persist(&sendQueue, session.State); err != nil {
+		log.Error().Err(err).Msg("⚠️ Error persisting send queue")
+	}
+
+	// Persist state, close the storage backend
+	if err := state.Close(session.State); err != nil {
+		log.Error().Err(err).Msg("⚠️ Error closing state store")
+	}
+
+	if err := unlockState(); err != nil {
+		log.Error().Err(err).Msg("⚠️ Error releasing state lock")
+	}
+
+	log.Info().Msg("👋 Shutdown complete")
 }
@@ -0,0 +1,234 @@
+package spam
+
+import (
+	"sync"
+	"time"
+)
+
+type Clock interface {
+	/* Time source for the limiter, swapped for a fake clock in tests */
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+type Rule struct {
+	/* A token-bucket rule: Burst commands at once, refilled at Rate commands/minute */
+	Rate  float64 // Commands per minute
+	Burst int     // Commands allowed in a burst
+}
+
+type Limits struct {
+	/* Command rate-limits, all of which must allow a command */
+	User     Rule            // Commands per user, across all commands
+	Group    Rule            // Commands per group chat, across all users
+	Command  Rule            // Per user and command, for commands without a rule of their own
+	Commands map[string]Rule // Per user and command, by command, e.g. "/history"
+}
+
+// Default limits, used for any rule left unconfigured
+var DefaultLimits = Limits{
+	User:    Rule{Rate: 20, Burst: 5},
+	Group:   Rule{Rate: 30, Burst: 10},
+	Command: Rule{Rate: 10, Burst: 3},
+	Commands: map[string]Rule{
+		"/stats":     {Rate: 6, Burst: 2},
+		"/history":   {Rate: 2, Burst: 1},
+		"/validator": {Rate: 3, Burst: 1},
+		"button":     {Rate: 30, Burst: 10}, // Inline keyboard buttons, e.g. of /settings
+		"inline":     {Rate: 30, Burst: 10}, // Inline queries, limited apart from commands
+	},
+}
+
+// Buckets that can deny a command, see Limiter.Take
+const (
+	BucketUser    = "user"    // The user's bucket, across all commands
+	BucketCommand = "command" // The user's bucket for the command
+	BucketGroup   = "group"   // The group's bucket, shared by its users
+)
+
+// Buckets are pruned once the map grows past this size
+const maxIdleBuckets = 4096
+
+type bucketKey struct {
+	/* Identifies a bucket: a user, a group, or a user's command */
+	id      int64  // User or chat ID
+	command string // Command, empty for user and group buckets
+	group   bool   // Is id a group chat?
+}
+
+type bucket struct {
+	tokens   float64   // Tokens currently available
+	capacity float64   // Max tokens the bucket can hold (burst size)
+	rate     float64   // Tokens added per second
+	last     time.Time // Last time the bucket was refilled
+}
+
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.capacity {
+			b.tokens = b.capacity
+		}
+	}
+
+	b.last = now
+}
+
+type Limiter struct {
+	/* Token-bucket limiter for commands */
+	Limits  Limits                // Configured limits
+	Clock   Clock                 // Time source
+	buckets map[bucketKey]*bucket // Buckets, created on first use
+	mutex   sync.Mutex            // Mutex to avoid concurrent map writes
+}
+
+func withDefault(rule Rule, fallback Rule) Rule {
+	if rule.Rate <= 0 {
+		rule.Rate = fallback.Rate
+	}
+
+	if rule.Burst <= 0 {
+		rule.Burst = fallback.Burst
+	}
+
+	return rule
+}
+
+func NewLimiter(limits Limits, clock Clock) *Limiter {
+	/* Creates a limiter, replacing unset rules with defaults */
+	if clock == nil {
+		clock = systemClock{}
+	}
+
+	limiter := &Limiter{Clock: clock, buckets: make(map[bucketKey]*bucket)}
+	limiter.SetLimits(limits)
+
+	return limiter
+}
+
+func (l *Limiter) SetLimits(limits Limits) {
+	/* Replaces the limits, e.g. on config reload. Buckets restart full. */
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	limits.User = withDefault(limits.User, DefaultLimits.User)
+	limits.Group = withDefault(limits.Group, DefaultLimits.Group)
+	limits.Command = withDefault(limits.Command, DefaultLimits.Command)
+
+	commands := make(map[string]Rule, len(limits.Commands))
+	for command, rule := range limits.Commands {
+		commands[command] = withDefault(rule, limits.Command)
+	}
+
+	limits.Commands = commands
+	l.Limits = limits
+	l.buckets = make(map[bucketKey]*bucket)
+}
+
+func (l *Limiter) rule(key bucketKey) Rule {
+	switch {
+	case key.group:
+		return l.Limits.Group
+	case key.command == "":
+		return l.Limits.User
+	}
+
+	if rule, ok := l.Limits.Commands[key.command]; ok {
+		return rule
+	}
+
+	return l.Limits.Command
+}
+
+func (l *Limiter) bucket(key bucketKey, now time.Time) *bucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		rule := l.rule(key)
+		b = &bucket{tokens: float64(rule.Burst), capacity: float64(rule.Burst), rate: rule.Rate / 60, last: now}
+		l.buckets[key] = b
+	}
+
+	b.refill(now)
+	return b
+}
+
+func (l *Limiter) prune() {
+	// Drop buckets that have refilled completely: they are equivalent to new ones
+	for key, b := range l.buckets {
+		if b.tokens >= b.capacity {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func (l *Limiter) Allow(command string, user int64, chat int64) bool {
+	/* Like Take, returning only whether the command is allowed */
+	return l.Take(command, user, chat) == ""
+}
+
+func (l *Limiter) AllowIsolated(command string, user int64) bool {
+	/*
+		Consumes a token from the user's bucket for command only, leaving the
+		user's and group buckets alone. For requests that must not use up the
+		user's commands, like inline queries sent while typing.
+	*/
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	b := l.bucket(bucketKey{id: user, command: command}, l.Clock.Now())
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+
+	if len(l.buckets) > maxIdleBuckets {
+		l.prune()
+	}
+
+	return true
+}
+
+func (l *Limiter) Take(command string, user int64, chat int64) string {
+	/*
+		Consumes a token from the user's, the user's command's and, in groups,
+		the group's bucket. If one is empty, none are consumed, and the empty
+		bucket is returned: BucketUser, BucketCommand or BucketGroup. Returns
+		an empty string if the command is allowed.
+	*/
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.Clock.Now()
+	keys := []bucketKey{{id: user}, {id: user, command: command}}
+	names := []string{BucketUser, BucketCommand}
+
+	// Groups, supergroups and channels have negative IDs in the Bot API
+	if chat < 0 {
+		keys = append(keys, bucketKey{id: chat, group: true})
+		names = append(names, BucketGroup)
+	}
+
+	buckets := make([]*bucket, 0, len(keys))
+	for i, key := range keys {
+		b := l.bucket(key, now)
+		if b.tokens < 1 {
+			return names[i]
+		}
+
+		buckets = append(buckets, b)
+	}
+
+	for _, b := range buckets {
+		b.tokens--
+	}
+
+	if len(l.buckets) > maxIdleBuckets {
+		l.prune()
+	}
+
+	return ""
+}
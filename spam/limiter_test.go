@@ -0,0 +1,105 @@
+package spam
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newTestLimiter(limits Limits) (*Limiter, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1660000000, 0)}
+	return NewLimiter(limits, clock), clock
+}
+
+func TestCommandBurst(t *testing.T) {
+	limiter, clock := newTestLimiter(Limits{
+		User:     Rule{Rate: 60, Burst: 10},
+		Commands: map[string]Rule{"/history": {Rate: 2, Burst: 2}},
+	})
+
+	// Costly commands allow a small burst, then refill slowly
+	for i := 0; i < 2; i++ {
+		if !limiter.Allow("/history", 1, 1) {
+			t.Fatalf("Expected command %d of the burst to be allowed", i+1)
+		}
+	}
+
+	if limiter.Allow("/history", 1, 1) {
+		t.Fatalf("Expected command to be limited after the burst")
+	}
+
+	// Other commands and users are unaffected
+	if !limiter.Allow("/stats", 1, 1) || !limiter.Allow("/history", 2, 2) {
+		t.Fatalf("Expected other commands and users to be allowed")
+	}
+
+	// 2 commands/minute: one token every 30 seconds
+	clock.Advance(29 * time.Second)
+	if limiter.Allow("/history", 1, 1) {
+		t.Fatalf("Expected command to be limited before the refill")
+	}
+
+	clock.Advance(time.Second)
+	if !limiter.Allow("/history", 1, 1) {
+		t.Fatalf("Expected command to be allowed after the refill")
+	}
+}
+
+func TestUserLimit(t *testing.T) {
+	limiter, _ := newTestLimiter(Limits{User: Rule{Rate: 1, Burst: 3}, Command: Rule{Rate: 60, Burst: 60}})
+
+	// The user's budget is shared by all commands
+	for _, command := range []string{"/start", "/stats", "/subscribe"} {
+		if !limiter.Allow(command, 1, 1) {
+			t.Fatalf("Expected %s to be allowed", command)
+		}
+	}
+
+	if limiter.Allow("/digest", 1, 1) {
+		t.Fatalf("Expected user to be limited across commands")
+	}
+}
+
+func TestIsolatedLimit(t *testing.T) {
+	limiter, _ := newTestLimiter(Limits{User: Rule{Rate: 1, Burst: 1}, Commands: map[string]Rule{"inline": {Rate: 1, Burst: 2}}})
+
+	// Inline queries have their own budget
+	if !limiter.AllowIsolated("inline", 1) || !limiter.AllowIsolated("inline", 1) || limiter.AllowIsolated("inline", 1) {
+		t.Fatalf("Expected a burst of 2 inline queries")
+	}
+
+	// ... which leaves the user's commands alone
+	if !limiter.Allow("/stats", 1, 1) {
+		t.Fatalf("Expected inline queries not to use up the user's commands")
+	}
+}
+
+func TestGroupLimit(t *testing.T) {
+	limiter, _ := newTestLimiter(Limits{
+		User:    Rule{Rate: 60, Burst: 60},
+		Group:   Rule{Rate: 1, Burst: 2},
+		Command: Rule{Rate: 60, Burst: 60},
+	})
+
+	group := int64(-1001234567890)
+
+	// A group's budget is shared by its users
+	if !limiter.Allow("/stats", 1, group) || !limiter.Allow("/stats", 2, group) {
+		t.Fatalf("Expected the group's burst to be allowed")
+	}
+
+	if limiter.Allow("/stats", 3, group) {
+		t.Fatalf("Expected group to be limited")
+	}
+
+	// A limited bucket consumes no tokens from the others
+	if !limiter.Allow("/stats", 3, 3) {
+		t.Fatalf("Expected user to be allowed in a private chat")
+	}
+}
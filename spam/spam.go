@@ -1,6 +1,8 @@
 package spam
 
 import (
+	"slashcaster/locale"
+	"slashcaster/state"
 	"sync"
 	"time"
 
@@ -8,37 +10,130 @@ import (
 )
 
 type AntiSpam struct {
-	/* In-memory struct keeping track of banned chats and per-chat activity */
-	ChatBanned               map[int64]bool    // Simple "if ChatBanned[chat] { do }" checks
-	ChatBannedUntilTimestamp map[int64]int64   // How long banned chats are banned for
-	ChatLogs                 map[int64]ChatLog // Map chat ID to a ChatLog struct
-	Rules                    map[string]int64  // Arbitrary rules for code flexibility
-	Mutex                    sync.Mutex        // Mutex to avoid concurrent map writes
+	/* Keeps track of per-chat activity in memory, and of bans in the state store */
+	ChatLogs map[int64]ChatLog // Map chat ID to a ChatLog struct
+	Limiter  *Limiter          // Command rate-limiter
+	State    *state.Store      // Store bans are persisted in
+	Mutex    sync.Mutex        // Mutex to avoid concurrent map writes
 }
 
 type ChatLog struct {
 	/* Per-chat struct keeping track of activity for spam management */
-	NextAllowedCommandTimestamp int64 // Next time the chat is allowed to call a command
-	CommandSpamOffenses         int   // Count of spam offences (not used yet)
+	CommandSpamOffenses  int   // Count of spam offences since the last penalty
+	LastOffenseTimestamp int64 // Time of the last offence, offences are forgiven after a while
 }
 
-func CommandPreHandler(spam *AntiSpam, chat int64, sentAt int64) bool {
-	/* When user sends a command, verify the chat is eligible for a command parse. */
+// Escalation of penalties for command spam
+const (
+	warnAfterOffenses = 3                // Offences before the chat is warned
+	banAfterOffenses  = 6                // Offences before the chat is banned
+	offenseWindow     = 10 * time.Minute // Offences older than this are forgiven
+	firstBanDuration  = 5 * time.Minute  // Length of the first ban, doubled for each repeat
+	maxTemporaryBans  = 4                // Temporary bans before a permanent one
+)
+
+func NewAntiSpam(store *state.Store, limiter *Limiter) *AntiSpam {
+	/* Creates an anti-spam struct, persisting bans in store */
+	return &AntiSpam{
+		ChatLogs: make(map[int64]ChatLog),
+		Limiter:  limiter,
+		State:    store,
+	}
+}
+
+func BanChat(spam *AntiSpam, chat int64, ban state.Ban) error {
+	/* Bans a chat, e.g. manually by the bot's owner */
+	ban.Count = state.GetBan(spam.State, chat).Count + 1
+	return state.SetBan(spam.State, chat, ban)
+}
+
+func UnbanChat(spam *AntiSpam, chat int64) (bool, error) {
+	/* Lifts a chat's ban, and forgives its offences */
 	spam.Mutex.Lock()
-	chatLog := spam.ChatLogs[chat]
+	delete(spam.ChatLogs, chat)
+	spam.Mutex.Unlock()
+
+	return state.Unban(spam.State, chat)
+}
+
+func escalate(spam *AntiSpam, chat int64, sentAt int64, lang string) (string, error) {
+	// Ban the chat for double the length of its previous ban, or permanently
+	ban := state.GetBan(spam.State, chat)
+	ban.Count++
+	ban.Reason = "command spam"
+
+	var notice string
+	if ban.Count > maxTemporaryBans {
+		ban.Permanent = true
+		notice = locale.T(lang, "spam.ban.final")
+	} else {
+		duration := firstBanDuration << (ban.Count - 1)
+		ban.Until = sentAt + int64(duration.Seconds())
+		notice = locale.T(lang, "spam.ban", locale.Duration(lang, duration))
+	}
+
+	log.Info().Msgf("⛔️ Chat %d banned for spam (ban #%d, permanent=%t)", chat, ban.Count, ban.Permanent)
+	return notice, state.SetBan(spam.State, chat, ban)
+}
+
+func CommandPreHandler(spam *AntiSpam, command string, user int64, chat int64, lang string) (bool, string) {
+	/*
+		When user sends a command in chat, verify the user is eligible for a
+		command parse. Commands from banned users, and in banned chats, are
+		ignored, as are commands in groups over their limit. Spamming commands
+		is penalized with a warning, then with temporary bans of doubling
+		length, then with a permanent ban. Returns whether the command may be
+		handled, and a notice in lang to send to the user if the penalty
+		changed.
+	*/
+	sentAt := spam.Limiter.Clock.Now().Unix()
+	if state.GetBan(spam.State, user).Active(sentAt) || state.GetBan(spam.State, chat).Active(sentAt) {
+		return false, ""
+	}
+
+	denied := spam.Limiter.Take(command, user, chat)
+	if denied == BucketGroup {
+		// The group's combined traffic is not the user's offence
+		log.Debug().Msgf("Dropped command from user %d: group %d is rate-limited", user, chat)
+		return false, ""
+	}
+
+	if denied != "" {
+		spam.Mutex.Lock()
+		chatLog := spam.ChatLogs[user]
+
+		// Forgive old offences
+		if sentAt-chatLog.LastOffenseTimestamp > int64(offenseWindow.Seconds()) {
+			chatLog.CommandSpamOffenses = 0
+		}
 
-	if chatLog.NextAllowedCommandTimestamp > sentAt {
 		chatLog.CommandSpamOffenses++
-		spam.ChatLogs[chat] = chatLog
+		chatLog.LastOffenseTimestamp = sentAt
+		offenses := chatLog.CommandSpamOffenses
+
+		if offenses >= banAfterOffenses {
+			chatLog.CommandSpamOffenses = 0
+		}
+
+		spam.ChatLogs[user] = chatLog
 		spam.Mutex.Unlock()
 
-		log.Debug().Msgf("Chat %d now has %d spam offenses", chat, chatLog.CommandSpamOffenses)
-		return false
+		log.Debug().Msgf("User %d now has %d spam offenses", user, offenses)
+
+		switch {
+		case offenses == warnAfterOffenses:
+			return false, locale.T(lang, "spam.warning")
+		case offenses >= banAfterOffenses:
+			notice, err := escalate(spam, user, sentAt, lang)
+			if err != nil {
+				log.Error().Err(err).Msgf("⚠️ Error banning chat %d", user)
+			}
+
+			return false, notice
+		}
+
+		return false, ""
 	}
 
-	// No spam, update chat's ConversionLog
-	chatLog.NextAllowedCommandTimestamp = time.Now().Unix() + spam.Rules["TimeBetweenCommands"]
-	spam.ChatLogs[chat] = chatLog
-	spam.Mutex.Unlock()
-	return true
+	return true, ""
 }
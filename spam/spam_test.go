@@ -0,0 +1,142 @@
+package spam
+
+import (
+	"slashcaster/state"
+	"strings"
+	"testing"
+	"time"
+)
+
+func spamUntilBanned(t *testing.T, spam *AntiSpam, chat int64, lang string) string {
+	// Send commands without pause until the chat is banned, returns the ban notice
+	for i := 0; i < 2*banAfterOffenses+10; i++ {
+		allowed, notice := CommandPreHandler(spam, "/stats", chat, chat, lang)
+		if !allowed && strings.HasPrefix(notice, "⛔️") {
+			return notice
+		}
+	}
+
+	t.Fatalf("Expected chat to be banned")
+	return ""
+}
+
+func TestEscalatingBans(t *testing.T) {
+	store, err := state.Load(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limiter, clock := newTestLimiter(Limits{})
+	spam := NewAntiSpam(store, limiter)
+	now := func() int64 { return clock.Now().Unix() }
+
+	// Offences are first met with a warning
+	var warned bool
+	for i := 0; i < 10 && !warned; i++ {
+		_, notice := CommandPreHandler(spam, "/stats", 1, 1, "en")
+		warned = strings.HasPrefix(notice, "⚠️")
+	}
+
+	if !warned {
+		t.Fatalf("Expected a warning after %d offences", warnAfterOffenses)
+	}
+
+	// Then with temporary bans of doubling length
+	spamUntilBanned(t, spam, 1, "en")
+	first := state.GetBan(store, 1)
+	if first.Permanent || first.Until != now()+int64(firstBanDuration.Seconds()) {
+		t.Fatalf("Expected a %s ban, got %+v", firstBanDuration, first)
+	}
+
+	clock.Advance(time.Minute)
+	if allowed, _ := CommandPreHandler(spam, "/stats", 1, 1, "en"); allowed {
+		t.Fatalf("Expected commands to be ignored while banned")
+	}
+
+	clock.now = time.Unix(first.Until, 0)
+	spamUntilBanned(t, spam, 1, "en")
+	if second := state.GetBan(store, 1); second.Until != now()+2*int64(firstBanDuration.Seconds()) {
+		t.Fatalf("Expected ban length to double, got %+v", second)
+	}
+
+	// Notices are sent in the chat's language
+	clock.now = time.Unix(state.GetBan(store, 1).Until, 0)
+	if notice := spamUntilBanned(t, spam, 1, "de"); !strings.Contains(notice, "20 Minuten") {
+		t.Fatalf("Expected a German notice of a 20 minute ban, got %q", notice)
+	}
+
+	// Bans persist across restarts
+	spam = NewAntiSpam(store, limiter)
+	if allowed, _ := CommandPreHandler(spam, "/stats", 1, 1, "en"); allowed {
+		t.Fatalf("Expected ban to persist")
+	}
+
+	// Until they turn permanent
+	for i := 3; i < maxTemporaryBans+1; i++ {
+		clock.now = time.Unix(state.GetBan(store, 1).Until, 0)
+		spamUntilBanned(t, spam, 1, "en")
+	}
+
+	if ban := state.GetBan(store, 1); !ban.Permanent {
+		t.Fatalf("Expected a permanent ban after %d temporary bans, got %+v", maxTemporaryBans, ban)
+	}
+
+	// The owner can lift bans
+	if removed, err := UnbanChat(spam, 1); !removed || err != nil {
+		t.Fatalf("Expected chat to be unbanned (err=%v)", err)
+	}
+
+	clock.Advance(time.Hour)
+	if allowed, _ := CommandPreHandler(spam, "/stats", 1, 1, "en"); !allowed {
+		t.Fatalf("Expected unbanned chat to be allowed")
+	}
+}
+
+func TestBannedGroup(t *testing.T) {
+	store, err := state.Load(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limiter, _ := newTestLimiter(Limits{})
+	spam := NewAntiSpam(store, limiter)
+
+	if err = BanChat(spam, -100, state.Ban{Permanent: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Members of a banned group are ignored there, but not elsewhere
+	if allowed, _ := CommandPreHandler(spam, "/stats", 1, -100, "en"); allowed {
+		t.Fatalf("Expected command in banned group to be ignored")
+	}
+
+	if allowed, _ := CommandPreHandler(spam, "/stats", 1, 1, "en"); !allowed {
+		t.Fatalf("Expected command in private chat to be allowed")
+	}
+}
+
+func TestBusyGroupIsNoOffense(t *testing.T) {
+	store, err := state.Load(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limiter, _ := newTestLimiter(Limits{Group: Rule{Rate: 1, Burst: 1}})
+	spam := NewAntiSpam(store, limiter)
+
+	// The group's traffic empties its bucket: its members' commands are dropped silently
+	for user := int64(1); user <= 2*banAfterOffenses; user++ {
+		allowed, notice := CommandPreHandler(spam, "/stats", user, -100, "en")
+		if allowed != (user == 1) || notice != "" {
+			t.Fatalf("Expected only the first command to be allowed, without notices, got %v %q", allowed, notice)
+		}
+	}
+
+	for i := 0; i < 2*banAfterOffenses; i++ {
+		CommandPreHandler(spam, "/stats", 2, -100, "en")
+	}
+
+	if offenses := spam.ChatLogs[2].CommandSpamOffenses; offenses != 0 {
+		t.Fatalf("Expected no offenses for a busy group, got %d", offenses)
+	}
+}
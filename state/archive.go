@@ -0,0 +1,321 @@
+package state
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slashcaster/locale"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version of the archive format written by Export
+const ArchiveVersion = 1
+
+// Archive formats
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+// Import modes
+const (
+	ImportMerge   = "merge"   // Add to the current state
+	ImportReplace = "replace" // Replace the current state
+)
+
+// Columns of CSV archives: one row per chat. Statistics and history are only kept in JSON archives.
+// Watchlists are space-separated validator indices.
+var csvHeader = []string{"version", "chat_id", "subscribed", "delivery", "language", "min_validators", "watchlist_only", "watchlist"}
+
+// Archives written before the language and the filter columns were added lack the last columns
+const (
+	csvLegacyColumns   = 4
+	csvLanguageColumns = 5
+)
+
+type Archive struct {
+	/* Portable copy of the runtime state, for moving the bot between hosts */
+	Version     int                   // Archive format version, see ArchiveVersion
+	Exported    int64                 // Unix timestamp of the export
+	Subscribers []int64               // Telegram subscribers
+	Preferences map[int64]Preferences // Per-chat preferences
+	History     []SlashingRecord      // History of observed slashings
+	Stats       Stats                 // Statistics
+	partial     bool                  // Read from a CSV archive, without history and statistics
+}
+
+type ImportResult struct {
+	/* What an import changed */
+	Added       int // Subscribers added
+	Duplicates  int // Subscribers skipped, as they were already subscribed
+	Preferences int // Chats whose preferences were set
+	Records     int // History records added
+}
+
+func hasSubscriber(subscribers []int64, chatId int64) bool {
+	// Duplicate check shared by AddSubscriber and imports
+	for _, id := range subscribers {
+		if id == chatId {
+			return true
+		}
+	}
+
+	return false
+}
+
+func Export(store *Store) (Archive, error) {
+	/* Returns a copy of the state as an archive */
+	store.Mutex.Lock()
+	state, err := deepCopyState(&store.State)
+	store.Mutex.Unlock()
+
+	return Archive{
+		Version:     ArchiveVersion,
+		Exported:    time.Now().Unix(),
+		Subscribers: state.Subscribers,
+		Preferences: state.Preferences,
+		History:     state.History,
+		Stats:       state.Stats,
+	}, err
+}
+
+func WriteArchive(w io.Writer, archive Archive, format string) error {
+	/* Writes the archive as JSON, or as CSV of subscribers and preferences */
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "\t")
+		return encoder.Encode(archive)
+	case FormatCSV:
+		return writeCSV(w, archive)
+	}
+
+	return fmt.Errorf("unknown archive format %s", format)
+}
+
+func writeCSV(w io.Writer, archive Archive) error {
+	// One row per chat that is subscribed or has preferences, sorted by chat ID
+	chats := map[int64]bool{}
+	for _, chatId := range archive.Subscribers {
+		chats[chatId] = true
+	}
+
+	for chatId := range archive.Preferences {
+		chats[chatId] = true
+	}
+
+	ids := make([]int64, 0, len(chats))
+	for chatId := range chats {
+		ids = append(ids, chatId)
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+
+	version := strconv.Itoa(archive.Version)
+	for _, chatId := range ids {
+		prefs := archive.Preferences[chatId]
+		row := []string{
+			version,
+			strconv.FormatInt(chatId, 10),
+			strconv.FormatBool(hasSubscriber(archive.Subscribers, chatId)),
+			prefs.Delivery,
+			prefs.Language,
+			strconv.Itoa(prefs.MinValidators),
+			strconv.FormatBool(prefs.WatchlistOnly),
+			strings.Join(prefs.Watchlist, " "),
+		}
+
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func ReadArchive(r io.Reader, format string) (Archive, error) {
+	/* Reads an archive written by WriteArchive */
+	var archive Archive
+	var err error
+
+	switch format {
+	case FormatJSON:
+		err = json.NewDecoder(r).Decode(&archive)
+	case FormatCSV:
+		archive, err = readCSV(r)
+	default:
+		err = fmt.Errorf("unknown archive format %s", format)
+	}
+
+	if err == nil && (archive.Version < 1 || archive.Version > ArchiveVersion) {
+		err = fmt.Errorf("unsupported archive version %d", archive.Version)
+	}
+
+	return archive, err
+}
+
+func readCSV(r io.Reader) (Archive, error) {
+	archive := Archive{Preferences: make(map[int64]Preferences), partial: true}
+
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return archive, err
+	}
+
+	columns := 0
+	if len(rows) != 0 {
+		columns = len(rows[0])
+	}
+
+	if (columns != len(csvHeader) && columns != csvLanguageColumns && columns != csvLegacyColumns) || rows[0][0] != csvHeader[0] {
+		return archive, fmt.Errorf("missing CSV header %v", csvHeader)
+	}
+
+	for line, row := range rows[1:] {
+		version, err := strconv.Atoi(row[0])
+		if err != nil {
+			return archive, fmt.Errorf("line %d: invalid version: %w", line+2, err)
+		}
+
+		chatId, err := strconv.ParseInt(row[1], 10, 64)
+		if err != nil {
+			return archive, fmt.Errorf("line %d: invalid chat ID: %w", line+2, err)
+		}
+
+		subscribed, err := strconv.ParseBool(row[2])
+		if err != nil {
+			return archive, fmt.Errorf("line %d: invalid subscribed flag: %w", line+2, err)
+		}
+
+		if row[3] != "" && !ValidDeliveryMode(row[3]) {
+			return archive, fmt.Errorf("line %d: invalid delivery mode %s", line+2, row[3])
+		}
+
+		var language string
+		if len(row) > csvLegacyColumns {
+			language = row[4]
+		}
+
+		if language != "" && !locale.Supported(language) {
+			return archive, fmt.Errorf("line %d: unsupported language %s", line+2, language)
+		}
+
+		prefs := Preferences{Delivery: row[3], Language: language}
+		if len(row) > csvLanguageColumns {
+			if prefs.MinValidators, err = strconv.Atoi(row[5]); err != nil {
+				return archive, fmt.Errorf("line %d: invalid minimum validators: %w", line+2, err)
+			}
+
+			if prefs.WatchlistOnly, err = strconv.ParseBool(row[6]); err != nil {
+				return archive, fmt.Errorf("line %d: invalid watchlist-only flag: %w", line+2, err)
+			}
+
+			prefs.Watchlist = strings.Fields(row[7])
+		}
+
+		archive.Version = version
+		if subscribed {
+			archive.Subscribers = append(archive.Subscribers, chatId)
+		}
+
+		if row[3] != "" || language != "" || prefs.MinValidators != 0 || prefs.WatchlistOnly || len(prefs.Watchlist) != 0 {
+			archive.Preferences[chatId] = prefs
+		}
+	}
+
+	if archive.Version == 0 {
+		// An empty export
+		archive.Version = ArchiveVersion
+	}
+
+	return archive, nil
+}
+
+func Import(store *Store, archive Archive, mode string) (ImportResult, error) {
+	/*
+		Restores an archive in a single transaction. Merging adds subscribers,
+		preferences and history records to the current state; replacing discards
+		the current subscribers, preferences and history first. History and
+		statistics are kept when replacing from a CSV archive, which has neither.
+		Subscribers that are already subscribed are counted as duplicates and
+		skipped.
+	*/
+	var result ImportResult
+	if mode != ImportMerge && mode != ImportReplace {
+		return result, fmt.Errorf("unknown import mode %s", mode)
+	}
+
+	err := Update(store, func(state *State) error {
+		if mode == ImportReplace {
+			state.Subscribers = nil
+			state.Preferences = nil
+
+			if !archive.partial {
+				state.History = nil
+			}
+		}
+
+		for _, chatId := range archive.Subscribers {
+			if hasSubscriber(state.Subscribers, chatId) {
+				result.Duplicates++
+				continue
+			}
+
+			state.Subscribers = append(state.Subscribers, chatId)
+			result.Added++
+		}
+
+		if state.Preferences == nil {
+			state.Preferences = make(map[int64]Preferences)
+		}
+
+		for chatId, prefs := range archive.Preferences {
+			state.Preferences[chatId] = prefs
+			result.Preferences++
+		}
+
+		// History records are identified by their slot. History is shared with
+		// the current state: copy it, as it's sorted in place.
+		state.History = append([]SlashingRecord(nil), state.History...)
+		slots := make(map[int64]bool, len(state.History))
+		for _, record := range state.History {
+			slots[record.Slot] = true
+		}
+
+		for _, record := range archive.History {
+			if !slots[record.Slot] {
+				state.History = append(state.History, record)
+				slots[record.Slot] = true
+				result.Records++
+			}
+		}
+
+		sort.SliceStable(state.History, func(i, j int) bool { return state.History[i].Slot < state.History[j].Slot })
+
+		if mode == ImportReplace && archive.Stats.StartTime != 0 {
+			// CSV archives have no statistics: keep the current ones
+			startTime := state.Stats.StartTime
+			state.Stats = archive.Stats
+			state.Stats.StartTime = startTime
+		}
+
+		// Broadcast IDs must stay unique
+		if archive.Stats.Broadcasts > state.Stats.Broadcasts {
+			state.Stats.Broadcasts = archive.Stats.Broadcasts
+		}
+
+		return nil
+	})
+
+	return result, err
+}
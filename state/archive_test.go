@@ -0,0 +1,79 @@
+package state
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestArchiveRoundTrip(t *testing.T) {
+	source := &Store{}
+	AddSubscriber(source, 1)
+	AddSubscriber(source, 2)
+	SetPreferences(source, 2, Preferences{Delivery: DeliveryWeekly, Language: "de", MinValidators: 10, Watchlist: []string{"7", "8"}})
+	RecordSlashing(source, SlashingRecord{Slot: 100, Time: 1000, AttSlashings: 1})
+	NextBroadcastId(source)
+
+	archive, err := Export(source)
+	if err != nil {
+		t.Fatalf("Exporting failed: %v", err)
+	}
+
+	for _, format := range []string{FormatJSON, FormatCSV} {
+		var buffer bytes.Buffer
+		if err = WriteArchive(&buffer, archive, format); err != nil {
+			t.Fatalf("Writing %s archive failed: %v", format, err)
+		}
+
+		restored, err := ReadArchive(&buffer, format)
+		if err != nil {
+			t.Fatalf("Reading %s archive failed: %v", format, err)
+		}
+
+		// Chat 2 is already subscribed: it is skipped as a duplicate
+		target := &Store{}
+		AddSubscriber(target, 2)
+
+		result, err := Import(target, restored, ImportMerge)
+		if err != nil {
+			t.Fatalf("Importing %s archive failed: %v", format, err)
+		}
+
+		if result.Added != 1 || result.Duplicates != 1 || len(Subscribers(target)) != 2 {
+			t.Errorf("Expected 1 added and 1 duplicate from %s, got %+v", format, result)
+		}
+
+		if prefs := GetPreferences(target, 2); prefs.Delivery != DeliveryWeekly || prefs.Language != "de" ||
+			prefs.MinValidators != 10 || !prefs.Watching("8") {
+			t.Errorf("Expected preferences to be imported from %s", format)
+		}
+	}
+
+	// Replacing discards the current subscribers
+	target := &Store{}
+	AddSubscriber(target, 3)
+
+	if _, err = Import(target, archive, ImportReplace); err != nil {
+		t.Fatalf("Importing failed: %v", err)
+	}
+
+	if subs := Subscribers(target); len(subs) != 2 || hasSubscriber(subs, 3) {
+		t.Errorf("Expected subscribers to be replaced, got %v", subs)
+	}
+
+	if len(target.State.History) != 1 || GetStats(target).Broadcasts != 1 {
+		t.Errorf("Expected history and stats to be imported, got %+v", target.State)
+	}
+
+	// CSV archives have no history: replacing from one keeps the current history
+	var buffer bytes.Buffer
+	WriteArchive(&buffer, archive, FormatCSV)
+	csvArchive, _ := ReadArchive(&buffer, FormatCSV)
+
+	if _, err = Import(target, csvArchive, ImportReplace); err != nil {
+		t.Fatalf("Importing CSV failed: %v", err)
+	}
+
+	if len(target.State.History) != 1 {
+		t.Errorf("Expected history to be kept when replacing from CSV, got %+v", target.State.History)
+	}
+}
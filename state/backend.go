@@ -0,0 +1,94 @@
+package state
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slashcaster/persist"
+)
+
+type Backend interface {
+	/*
+		Storage for the state store: subscribers, preferences, statistics, the
+		event history and the send queue. Implementations must be safe to use
+		from a single goroutine at a time: the store serializes access.
+	*/
+	Load() (State, error)                // Loads the full state, empty if nothing is stored yet
+	Commit(old *State, new *State) error // Persists new; old is the last committed state, for backends writing only changes
+	LoadQueue() ([]byte, error)          // Loads the persisted send queue, nil if there is none
+	SaveQueue(data []byte) error         // Persists the send queue, nil data clears it
+	Close() error                        // Releases the backend's resources
+}
+
+// File name of the persisted send queue
+const queueFile = "queue.json"
+
+type jsonBackend struct {
+	/* Stores the state as a single JSON file, with rotating backups */
+	dir     string // Folder the state and queue files are stored in
+	path    string // Path of the state file
+	backups int    // Count of rotating backups kept of the state file
+}
+
+func NewJSONBackend(dir string, backups int) (Backend, error) {
+	/* Returns a backend storing the state in state.json in dir */
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	return &jsonBackend{dir: dir, path: filepath.Join(dir, stateFile), backups: backups}, nil
+}
+
+func (backend *jsonBackend) Load() (State, error) {
+	// Fall back to a backup if the state file is damaged
+	var state State
+
+	_, err := persist.ReadFile(backend.path, backend.backups, func(data []byte) error {
+		state = State{}
+		return json.Unmarshal(data, &state)
+	})
+
+	if os.IsNotExist(err) {
+		return State{}, nil
+	}
+
+	return state, err
+}
+
+func (backend *jsonBackend) Commit(old *State, new *State) error {
+	// Atomically replace the state file, rotating backups at most once per interval
+	jsonbytes, err := json.MarshalIndent(new, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return persist.WriteFileEvery(backend.path, jsonbytes, backend.backups, persist.BackupInterval)
+}
+
+func (backend *jsonBackend) LoadQueue() ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(backend.dir, queueFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	return data, err
+}
+
+func (backend *jsonBackend) SaveQueue(data []byte) error {
+	path := filepath.Join(backend.dir, queueFile)
+
+	if data == nil {
+		// Nothing to persist: remove any stale file
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return nil
+	}
+
+	return persist.WriteFile(path, data, 0)
+}
+
+func (backend *jsonBackend) Close() error {
+	return nil
+}
@@ -0,0 +1,50 @@
+package state
+
+type Ban struct {
+	/* A chat's ban status, kept after temporary bans expire to escalate repeat offences */
+	Until     int64  // Unix timestamp the ban expires at, if not permanent
+	Permanent bool   // Is the ban permanent?
+	Count     int    // Count of bans issued to the chat
+	Reason    string // Why the chat was banned
+}
+
+func (ban Ban) Active(now int64) bool {
+	/* Is the chat banned at now? */
+	return ban.Permanent || ban.Until > now
+}
+
+func GetBan(store *Store, chatId int64) Ban {
+	/* Returns the chat's ban status */
+	store.Mutex.Lock()
+	defer store.Mutex.Unlock()
+
+	return store.State.Bans[chatId]
+}
+
+func SetBan(store *Store, chatId int64, ban Ban) error {
+	/* Saves the chat's ban status */
+	return Update(store, func(state *State) error {
+		if state.Bans == nil {
+			state.Bans = make(map[int64]Ban)
+		}
+
+		state.Bans[chatId] = ban
+		return nil
+	})
+}
+
+func Unban(store *Store, chatId int64) (bool, error) {
+	/* Lifts the chat's ban and forgets its ban history, returns false if the chat was not banned */
+	removed := false
+
+	err := Update(store, func(state *State) error {
+		if _, ok := state.Bans[chatId]; ok {
+			delete(state.Bans, chatId)
+			removed = true
+		}
+
+		return nil
+	})
+
+	return removed, err
+}
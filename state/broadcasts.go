@@ -0,0 +1,70 @@
+package state
+
+import "time"
+
+// How long the messages of a broadcast are kept for edits
+const SentRetention = 7 * 24 * time.Hour
+
+type SentBroadcast struct {
+	/* Messages delivered for a broadcast, kept so they can be edited after a restart */
+	Created   int64         // Unix timestamp of broadcast creation
+	ParseMode string        // Parse mode the messages were sent with
+	NoPreview bool          // Were web page previews disabled?
+	Messages  map[int64]int // Map recipient to the ID of its message: entries are only ever added
+}
+
+func TrackBroadcast(store *Store, id int, created int64, parseMode string, noPreview bool) {
+	/*
+		Starts keeping the messages of a broadcast, and forgets broadcasts older
+		than SentRetention. Kept in memory until the next Save.
+	*/
+	store.Mutex.Lock()
+	defer store.Mutex.Unlock()
+
+	if store.State.Sent == nil {
+		store.State.Sent = make(map[int]SentBroadcast)
+	}
+
+	expiry := created - int64(SentRetention.Seconds())
+	for oldId, sent := range store.State.Sent {
+		if sent.Created < expiry {
+			delete(store.State.Sent, oldId)
+		}
+	}
+
+	store.State.Sent[id] = SentBroadcast{
+		Created:   created,
+		ParseMode: parseMode,
+		NoPreview: noPreview,
+		Messages:  make(map[int64]int),
+	}
+}
+
+func MessageSent(store *Store, id int, chatId int64, messageId int) {
+	/* Keeps the ID of a broadcast's message to chatId. Kept in memory until the next Save. */
+	store.Mutex.Lock()
+	defer store.Mutex.Unlock()
+
+	if sent, ok := store.State.Sent[id]; ok {
+		sent.Messages[chatId] = messageId
+	}
+}
+
+func SentBroadcasts(store *Store) map[int]SentBroadcast {
+	/* Returns a copy of the broadcasts whose messages are kept */
+	store.Mutex.Lock()
+	defer store.Mutex.Unlock()
+
+	broadcasts := make(map[int]SentBroadcast, len(store.State.Sent))
+	for id, sent := range store.State.Sent {
+		messages := make(map[int64]int, len(sent.Messages))
+		for chatId, messageId := range sent.Messages {
+			messages[chatId] = messageId
+		}
+
+		sent.Messages = messages
+		broadcasts[id] = sent
+	}
+
+	return broadcasts
+}
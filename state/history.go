@@ -0,0 +1,178 @@
+package state
+
+type SlashingRecord struct {
+	/* A single block's slashings, kept in the event history */
+	Slot          int64              // Slot the slashings were included in
+	Time          int64              // Block time of the slot
+	BroadcastId   int                // Broadcast the slashings were sent in: equal for one incident
+	AttSlashings  int                // Count of attester slashings in the block
+	PropSlashings int                // Count of proposer slashings in the block
+	Validators    []SlashedValidator // Validators slashed in the block
+	Reorged       bool               // Was the block reorged out?
+	Root          string             // Block root of the slot at detection time, empty if unknown
+}
+
+type SlashedValidator struct {
+	Index                string // Validator index
+	AttestationViolation bool   // Slashed for an attestation violation
+	ProposerViolation    bool   // Slashed for a proposer violation
+	Penalty              uint64 // Initial penalty in gwei, 0 if unknown
+	OffenceEpoch         int64  // Epoch the validator committed the offence in
+}
+
+func hasRecord(history []SlashingRecord, slot int64) bool {
+	// Is there a canonical record at slot?
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Slot == slot && !history[i].Reorged {
+			return true
+		}
+	}
+
+	return false
+}
+
+func RecordSlashing(store *Store, record SlashingRecord) error {
+	/*
+		Adds a slashing record to the event history in slot order, updating
+		statistics. Slots with a canonical record are recorded once: records of
+		slots streamed again, e.g. when backfilling with a resync, are dropped.
+	*/
+	return Update(store, func(state *State) error {
+		if hasRecord(state.History, record.Slot) {
+			return nil
+		}
+
+		// Backfilled records go before later ones. History is shared with the
+		// current state: copy it before inserting.
+		position := len(state.History)
+		for position > 0 && state.History[position-1].Slot > record.Slot {
+			position--
+		}
+
+		if position == len(state.History) {
+			state.History = append(state.History, record)
+		} else {
+			history := make([]SlashingRecord, 0, len(state.History)+1)
+			history = append(history, state.History[:position]...)
+			history = append(history, record)
+			state.History = append(history, state.History[position:]...)
+		}
+
+		state.Stats.AttSlashings += record.AttSlashings
+		state.Stats.PropSlashings += record.PropSlashings
+		if record.Time > state.Stats.LastSlashing {
+			state.Stats.LastSlashing = record.Time
+		}
+
+		return nil
+	})
+}
+
+func SlashingRecorded(store *Store, slot int64) bool {
+	/* Is there a canonical record of slashings at slot? */
+	store.Mutex.Lock()
+	defer store.Mutex.Unlock()
+
+	return hasRecord(store.State.History, slot)
+}
+
+func MarkReorged(store *Store, slot int64) error {
+	/* Flags the record at slot as reorged out */
+	return Update(store, func(state *State) error {
+		// History is shared with the current state: copy it before changing records
+		state.History = append([]SlashingRecord(nil), state.History...)
+
+		for i := range state.History {
+			if state.History[i].Slot == slot {
+				state.History[i].Reorged = true
+			}
+		}
+
+		return nil
+	})
+}
+
+func IncidentHistory(store *Store, slot int64) ([]SlashingRecord, int64) {
+	/*
+		Returns the records of broadcasts with a record included at or after
+		slot, reorged ones included, oldest first, and the time of the last
+		slashing before them.
+	*/
+	store.Mutex.Lock()
+	defer store.Mutex.Unlock()
+
+	broadcasts := make(map[int]bool)
+	for _, record := range store.State.History {
+		if record.Slot >= slot && record.BroadcastId != 0 {
+			broadcasts[record.BroadcastId] = true
+		}
+	}
+
+	var records []SlashingRecord
+	var previous int64
+	for i, record := range store.State.History {
+		if !broadcasts[record.BroadcastId] {
+			continue
+		}
+
+		if records == nil && i > 0 {
+			previous = store.State.History[i-1].Time
+		}
+
+		records = append(records, record)
+	}
+
+	return records, previous
+}
+
+func HistorySince(store *Store, since int64, until int64) []SlashingRecord {
+	/* Returns canonical records with since < Time <= until, oldest first */
+	store.Mutex.Lock()
+	defer store.Mutex.Unlock()
+
+	var records []SlashingRecord
+	for _, record := range store.State.History {
+		if record.Time > since && record.Time <= until && !record.Reorged {
+			records = append(records, record)
+		}
+	}
+
+	return records
+}
+
+func ValidatorHistory(store *Store, index string) []SlashingRecord {
+	/* Returns canonical records in which the validator at index was slashed, oldest first */
+	store.Mutex.Lock()
+	defer store.Mutex.Unlock()
+
+	var records []SlashingRecord
+	for _, record := range store.State.History {
+		if record.Reorged {
+			continue
+		}
+
+		for _, validator := range record.Validators {
+			if validator.Index == index {
+				records = append(records, record)
+				break
+			}
+		}
+	}
+
+	return records
+}
+
+func LastSlashings(store *Store, count int) []SlashingRecord {
+	/* Returns the last count canonical records, newest first */
+	store.Mutex.Lock()
+	defer store.Mutex.Unlock()
+
+	var records []SlashingRecord
+	for i := len(store.State.History) - 1; i >= 0 && len(records) < count; i-- {
+		if !store.State.History[i].Reorged {
+			records = append(records, store.State.History[i])
+		}
+	}
+
+	return records
+}
@@ -0,0 +1,83 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// File name of the lock file held by a running bot
+const lockFile = "slashcaster.pid"
+
+// Returned when the state is in use by a running bot
+var ErrLocked = errors.New("state is in use by a running bot")
+
+func lockHolder(path string) (int, bool) {
+	// Returns the PID in a lock file, and whether that process is alive
+	fbytes, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(fbytes)))
+	if err != nil || pid <= 0 {
+		return 0, false
+	}
+
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return pid, false
+	}
+
+	// Signal 0 only checks for existence: EPERM means the process exists, as another user
+	err = process.Signal(syscall.Signal(0))
+	return pid, err == nil || errors.Is(err, syscall.EPERM)
+}
+
+func Lock(dir string) (func() error, error) {
+	/*
+		Marks the state in dir as in use by this process, by writing its PID to
+		a lock file. Fails with ErrLocked if a live process holds the lock: lock
+		files left behind by processes that are gone are replaced. Returns a
+		function releasing the lock.
+	*/
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, lockFile)
+
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = fmt.Fprintf(file, "%d\n", os.Getpid())
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+
+			if err != nil {
+				os.Remove(path)
+				return nil, err
+			}
+
+			return func() error { return os.Remove(path) }, nil
+		} else if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if pid, alive := lockHolder(path); alive {
+			return nil, fmt.Errorf("%w (pid %d, lock file %s)", ErrLocked, pid, path)
+		}
+
+		// Stale lock file: the process that held it is gone
+		if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("%w (lock file %s)", ErrLocked, path)
+}
@@ -0,0 +1,195 @@
+package state
+
+import (
+	"errors"
+	"slashcaster/locale"
+)
+
+// Delivery modes for slashing notifications
+const (
+	DeliveryRealtime = "realtime"
+	DeliveryHourly   = "hourly"
+	DeliveryDaily    = "daily"
+	DeliveryWeekly   = "weekly"
+)
+
+// All delivery modes, in the order they are shown to users
+var DeliveryModes = []string{DeliveryRealtime, DeliveryHourly, DeliveryDaily, DeliveryWeekly}
+
+// Incident sizes, in slashed validators, chats can filter alerts by
+var AlertSizes = []int{1, 10, 100}
+
+// Max count of validators on a chat's watchlist
+const MaxWatchlist = 50
+
+// Returned when adding to a full watchlist
+var ErrWatchlistFull = errors.New("watchlist is full")
+
+type Preferences struct {
+	/* Per-chat preferences */
+	Delivery         string   // Delivery mode, one of the Delivery* constants
+	Language         string   // Language chosen with /language, empty to follow TelegramLanguage
+	TelegramLanguage string   // Telegram's language_code of the user, for private chats
+	MinValidators    int      // Only alert on incidents of at least this many validators, 0 for all
+	WatchlistOnly    bool     // Only alert on incidents of watched validators
+	Watchlist        []string // Indices of validators always alerted on: replaced, never modified in place
+}
+
+func (prefs Preferences) Watching(index string) bool {
+	/* Is the validator at index on the chat's watchlist? */
+	for _, watched := range prefs.Watchlist {
+		if watched == index {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (prefs Preferences) Wants(indices []string) bool {
+	/*
+		Should the chat be alerted of an incident slashing the validators at
+		indices? Incidents of watched validators always are, others if they
+		pass the chat's filters.
+	*/
+	for _, index := range indices {
+		if prefs.Watching(index) {
+			return true
+		}
+	}
+
+	return !prefs.WatchlistOnly && len(indices) >= prefs.MinValidators
+}
+
+func ValidDeliveryMode(mode string) bool {
+	for _, valid := range DeliveryModes {
+		if mode == valid {
+			return true
+		}
+	}
+
+	return false
+}
+
+func GetPreferences(store *Store, chatId int64) Preferences {
+	/* Returns the chat's preferences, with defaults for anything unset */
+	store.Mutex.Lock()
+	prefs := store.State.Preferences[chatId]
+	store.Mutex.Unlock()
+
+	if prefs.Delivery == "" {
+		prefs.Delivery = DeliveryRealtime
+	}
+
+	return prefs
+}
+
+func SetPreferences(store *Store, chatId int64, prefs Preferences) error {
+	/* Saves the chat's preferences */
+	return Update(store, func(state *State) error {
+		if state.Preferences == nil {
+			state.Preferences = make(map[int64]Preferences)
+		}
+
+		state.Preferences[chatId] = prefs
+		return nil
+	})
+}
+
+func Watch(store *Store, chatId int64, index string) (bool, error) {
+	/*
+		Adds a validator to the chat's watchlist, returns false if it was
+		already watched, or ErrWatchlistFull once MaxWatchlist are.
+	*/
+	added := false
+
+	err := Update(store, func(state *State) error {
+		prefs := state.Preferences[chatId]
+		if prefs.Watching(index) {
+			return nil
+		}
+
+		if len(prefs.Watchlist) >= MaxWatchlist {
+			return ErrWatchlistFull
+		}
+
+		if state.Preferences == nil {
+			state.Preferences = make(map[int64]Preferences)
+		}
+
+		// Shared with the current state: build a new list
+		prefs.Watchlist = append(append([]string(nil), prefs.Watchlist...), index)
+		state.Preferences[chatId] = prefs
+		added = true
+		return nil
+	})
+
+	return added, err
+}
+
+func Unwatch(store *Store, chatId int64, index string) (bool, error) {
+	/* Removes a validator from the chat's watchlist, returns false if it was not watched */
+	removed := false
+
+	err := Update(store, func(state *State) error {
+		prefs := state.Preferences[chatId]
+		if !prefs.Watching(index) {
+			return nil
+		}
+
+		var watchlist []string
+		for _, watched := range prefs.Watchlist {
+			if watched != index {
+				watchlist = append(watchlist, watched)
+			}
+		}
+
+		prefs.Watchlist = watchlist
+		state.Preferences[chatId] = prefs
+		removed = true
+		return nil
+	})
+
+	return removed, err
+}
+
+func Interested(store *Store, chats []int64, indices []string) []int64 {
+	/* Returns the chats that want alerts of an incident slashing the validators at indices */
+	store.Mutex.Lock()
+	defer store.Mutex.Unlock()
+
+	var interested []int64
+	for _, chatId := range chats {
+		if store.State.Preferences[chatId].Wants(indices) {
+			interested = append(interested, chatId)
+		}
+	}
+
+	return interested
+}
+
+func ChatLanguage(store *Store, chatId int64) string {
+	/* Returns the supported language messages to the chat are written in */
+	prefs := GetPreferences(store, chatId)
+	return locale.Match(prefs.Language, prefs.TelegramLanguage)
+}
+
+func SubscribersByDelivery(store *Store, mode string) []int64 {
+	/* Returns the Telegram subscribers using the given delivery mode */
+	store.Mutex.Lock()
+	defer store.Mutex.Unlock()
+
+	var chats []int64
+	for _, chatId := range store.State.Subscribers {
+		delivery := store.State.Preferences[chatId].Delivery
+		if delivery == "" {
+			delivery = DeliveryRealtime
+		}
+
+		if delivery == mode {
+			chats = append(chats, chatId)
+		}
+	}
+
+	return chats
+}
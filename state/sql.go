@@ -0,0 +1,453 @@
+package state
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Supported SQL drivers
+const (
+	DriverSQLite   = "sqlite3"
+	DriverPostgres = "postgres"
+)
+
+// Tables are kept simple: rows hold JSON documents, so the schema doesn't
+// change when the structs do.
+var sqlSchema = []string{
+	`CREATE TABLE IF NOT EXISTS subscribers (chat_id BIGINT PRIMARY KEY)`,
+	`CREATE TABLE IF NOT EXISTS preferences (chat_id BIGINT PRIMARY KEY, data TEXT NOT NULL)`,
+	`CREATE TABLE IF NOT EXISTS history (seq BIGINT PRIMARY KEY, slot BIGINT NOT NULL, data TEXT NOT NULL)`,
+	`CREATE TABLE IF NOT EXISTS documents (name TEXT PRIMARY KEY, data TEXT NOT NULL)`,
+	`CREATE TABLE IF NOT EXISTS sent (broadcast_id BIGINT PRIMARY KEY, data TEXT NOT NULL)`,
+}
+
+type sqlBackend struct {
+	/* Stores the state in SQLite or PostgreSQL, writing only what changed */
+	db     *sql.DB     // Database handle
+	driver string      // Driver name, one of DriverSQLite or DriverPostgres
+	sent   map[int]int // Map broadcast ID to the count of its messages written
+}
+
+func NewSQLBackend(driver string, dsn string) (Backend, error) {
+	/*
+		Returns a backend storing the state in a SQL database: a file path for
+		SQLite, a connection string for PostgreSQL. Tables are created if needed.
+	*/
+	if driver != DriverSQLite && driver != DriverPostgres {
+		return nil, fmt.Errorf("unsupported SQL driver %s", driver)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if driver == DriverSQLite {
+		// SQLite allows a single writer: avoid "database is locked" errors
+		db.SetMaxOpenConns(1)
+	}
+
+	backend := &sqlBackend{db: db, driver: driver, sent: make(map[int]int)}
+	for _, statement := range sqlSchema {
+		if _, err = db.Exec(statement); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	return backend, nil
+}
+
+func (backend *sqlBackend) rebind(query string) string {
+	// PostgreSQL uses numbered placeholders: replace ? with $1, $2...
+	if backend.driver != DriverPostgres {
+		return query
+	}
+
+	var rebound strings.Builder
+	n := 0
+
+	for _, r := range query {
+		if r == '?' {
+			n++
+			rebound.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+
+		rebound.WriteRune(r)
+	}
+
+	return rebound.String()
+}
+
+func (backend *sqlBackend) loadDocument(name string, target interface{}) error {
+	// Load a JSON document, leaving target untouched if none is stored
+	var data string
+	err := backend.db.QueryRow(backend.rebind(`SELECT data FROM documents WHERE name = ?`), name).Scan(&data)
+
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return json.Unmarshal([]byte(data), target)
+}
+
+func (backend *sqlBackend) Load() (State, error) {
+	state := State{Preferences: make(map[int64]Preferences)}
+
+	// Subscribers
+	rows, err := backend.db.Query(`SELECT chat_id FROM subscribers ORDER BY chat_id`)
+	if err != nil {
+		return state, err
+	}
+
+	for rows.Next() {
+		var chatId int64
+		if err = rows.Scan(&chatId); err != nil {
+			rows.Close()
+			return state, err
+		}
+
+		state.Subscribers = append(state.Subscribers, chatId)
+	}
+
+	if err = closeRows(rows); err != nil {
+		return state, err
+	}
+
+	// Preferences
+	rows, err = backend.db.Query(`SELECT chat_id, data FROM preferences`)
+	if err != nil {
+		return state, err
+	}
+
+	for rows.Next() {
+		var chatId int64
+		var data string
+		var prefs Preferences
+
+		if err = rows.Scan(&chatId, &data); err == nil {
+			err = json.Unmarshal([]byte(data), &prefs)
+		}
+
+		if err != nil {
+			rows.Close()
+			return state, err
+		}
+
+		state.Preferences[chatId] = prefs
+	}
+
+	if err = closeRows(rows); err != nil {
+		return state, err
+	}
+
+	// Event history, oldest first
+	rows, err = backend.db.Query(`SELECT data FROM history ORDER BY seq`)
+	if err != nil {
+		return state, err
+	}
+
+	for rows.Next() {
+		var data string
+		var record SlashingRecord
+
+		if err = rows.Scan(&data); err == nil {
+			err = json.Unmarshal([]byte(data), &record)
+		}
+
+		if err != nil {
+			rows.Close()
+			return state, err
+		}
+
+		state.History = append(state.History, record)
+	}
+
+	if err = closeRows(rows); err != nil {
+		return state, err
+	}
+
+	// Delivered messages of recent broadcasts
+	rows, err = backend.db.Query(`SELECT broadcast_id, data FROM sent`)
+	if err != nil {
+		return state, err
+	}
+
+	for rows.Next() {
+		var id int
+		var data string
+		var sent SentBroadcast
+
+		if err = rows.Scan(&id, &data); err == nil {
+			err = json.Unmarshal([]byte(data), &sent)
+		}
+
+		if err != nil {
+			rows.Close()
+			return state, err
+		}
+
+		if state.Sent == nil {
+			state.Sent = make(map[int]SentBroadcast)
+		}
+
+		state.Sent[id] = sent
+		backend.sent[id] = len(sent.Messages)
+	}
+
+	if err = closeRows(rows); err != nil {
+		return state, err
+	}
+
+	if err = backend.loadDocument("bans", &state.Bans); err != nil {
+		return state, err
+	}
+
+	err = backend.loadDocument("stats", &state.Stats)
+	return state, err
+}
+
+func closeRows(rows *sql.Rows) error {
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return err
+	}
+
+	return rows.Close()
+}
+
+func jsonDiffers(a interface{}, b interface{}) (bool, []byte, error) {
+	// Compare two values by their JSON encoding, returns the encoding of b
+	encodedA, err := json.Marshal(a)
+	if err != nil {
+		return false, nil, err
+	}
+
+	encodedB, err := json.Marshal(b)
+	return !bytes.Equal(encodedA, encodedB), encodedB, err
+}
+
+func (backend *sqlBackend) Commit(old *State, new *State) error {
+	// Write what changed between old and new in a single transaction
+	if old == nil {
+		old = &State{}
+	}
+
+	tx, err := backend.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err = backend.commit(tx, old, new); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	written, err := backend.commitSent(tx, new)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	backend.sent = written
+	return nil
+}
+
+func (backend *sqlBackend) commitSent(tx *sql.Tx, new *State) (map[int]int, error) {
+	/*
+		Writes the broadcasts whose messages changed since the last commit, and
+		deletes forgotten ones. Messages are added outside of transactions, so
+		old and new can't be compared: as messages are only ever added, their
+		count tells whether a broadcast changed. Returns the counts written.
+	*/
+	written := make(map[int]int, len(new.Sent))
+
+	for id, sent := range new.Sent {
+		written[id] = len(sent.Messages)
+
+		if count, ok := backend.sent[id]; ok && count == len(sent.Messages) {
+			continue
+		}
+
+		data, err := json.Marshal(sent)
+		if err != nil {
+			return nil, err
+		}
+
+		query := `INSERT INTO sent (broadcast_id, data) VALUES (?, ?)
+			ON CONFLICT (broadcast_id) DO UPDATE SET data = excluded.data`
+		if _, err = tx.Exec(backend.rebind(query), id, string(data)); err != nil {
+			return nil, err
+		}
+	}
+
+	for id := range backend.sent {
+		if _, ok := new.Sent[id]; !ok {
+			if _, err := tx.Exec(backend.rebind(`DELETE FROM sent WHERE broadcast_id = ?`), id); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return written, nil
+}
+
+func (backend *sqlBackend) commit(tx *sql.Tx, old *State, new *State) error {
+	// Subscribers: insert new ones, delete removed ones
+	oldSubs := make(map[int64]bool, len(old.Subscribers))
+	for _, chatId := range old.Subscribers {
+		oldSubs[chatId] = true
+	}
+
+	newSubs := make(map[int64]bool, len(new.Subscribers))
+	for _, chatId := range new.Subscribers {
+		newSubs[chatId] = true
+
+		if !oldSubs[chatId] {
+			query := `INSERT INTO subscribers (chat_id) VALUES (?) ON CONFLICT (chat_id) DO NOTHING`
+			if _, err := tx.Exec(backend.rebind(query), chatId); err != nil {
+				return err
+			}
+		}
+	}
+
+	for chatId := range oldSubs {
+		if !newSubs[chatId] {
+			if _, err := tx.Exec(backend.rebind(`DELETE FROM subscribers WHERE chat_id = ?`), chatId); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Preferences: upsert changed entries, delete removed ones
+	for chatId, prefs := range new.Preferences {
+		oldPrefs, existed := old.Preferences[chatId]
+		changed, data, err := jsonDiffers(oldPrefs, prefs)
+		if err != nil {
+			return err
+		}
+
+		if existed && !changed {
+			continue
+		}
+
+		query := `INSERT INTO preferences (chat_id, data) VALUES (?, ?)
+			ON CONFLICT (chat_id) DO UPDATE SET data = excluded.data`
+		if _, err = tx.Exec(backend.rebind(query), chatId, string(data)); err != nil {
+			return err
+		}
+	}
+
+	for chatId := range old.Preferences {
+		if _, ok := new.Preferences[chatId]; !ok {
+			if _, err := tx.Exec(backend.rebind(`DELETE FROM preferences WHERE chat_id = ?`), chatId); err != nil {
+				return err
+			}
+		}
+	}
+
+	// History: records are keyed by their position in the history, to keep their order
+	for position, record := range new.History {
+		var oldRecord interface{}
+		if position < len(old.History) {
+			// Records are never modified in place: a record shared with old is unchanged
+			if &old.History[position] == &new.History[position] {
+				continue
+			}
+
+			oldRecord = old.History[position]
+		}
+
+		changed, data, err := jsonDiffers(oldRecord, record)
+		if err != nil {
+			return err
+		}
+
+		if !changed {
+			continue
+		}
+
+		query := `INSERT INTO history (seq, slot, data) VALUES (?, ?, ?)
+			ON CONFLICT (seq) DO UPDATE SET slot = excluded.slot, data = excluded.data`
+		if _, err = tx.Exec(backend.rebind(query), position, record.Slot, string(data)); err != nil {
+			return err
+		}
+	}
+
+	if len(new.History) < len(old.History) {
+		if _, err := tx.Exec(backend.rebind(`DELETE FROM history WHERE seq >= ?`), len(new.History)); err != nil {
+			return err
+		}
+	}
+
+	// Bans are few: stored as a single document
+	if changed, _, err := jsonDiffers(old.Bans, new.Bans); err != nil {
+		return err
+	} else if changed {
+		if err = backend.saveDocument(tx, "bans", new.Bans); err != nil {
+			return err
+		}
+	}
+
+	// Statistics change outside of transactions too: always written
+	return backend.saveDocument(tx, "stats", new.Stats)
+}
+
+func (backend *sqlBackend) saveDocument(tx *sql.Tx, name string, document interface{}) error {
+	data, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO documents (name, data) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET data = excluded.data`
+	_, err = tx.Exec(backend.rebind(query), name, string(data))
+
+	return err
+}
+
+func (backend *sqlBackend) LoadQueue() ([]byte, error) {
+	var queue json.RawMessage
+	if err := backend.loadDocument("queue", &queue); err != nil {
+		return nil, err
+	}
+
+	return queue, nil
+}
+
+func (backend *sqlBackend) SaveQueue(data []byte) error {
+	if data == nil {
+		_, err := backend.db.Exec(backend.rebind(`DELETE FROM documents WHERE name = ?`), "queue")
+		return err
+	}
+
+	tx, err := backend.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err = backend.saveDocument(tx, "queue", json.RawMessage(data)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (backend *sqlBackend) Close() error {
+	return backend.db.Close()
+}
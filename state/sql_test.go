@@ -0,0 +1,156 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testBackend(t *testing.T, open func() Backend) {
+	// Changes made through a store survive reopening the backend
+	store, err := Open(open())
+	if err != nil {
+		t.Fatalf("Opening store failed: %v", err)
+	}
+
+	for _, chatId := range []int64{1, 2, 3} {
+		if _, err = AddSubscriber(store, chatId); err != nil {
+			t.Fatalf("Adding subscriber failed: %v", err)
+		}
+	}
+
+	if _, err = RemoveSubscriber(store, 2); err != nil {
+		t.Fatalf("Removing subscriber failed: %v", err)
+	}
+
+	if err = SetPreferences(store, 3, Preferences{Delivery: DeliveryDaily}); err != nil {
+		t.Fatalf("Setting preferences failed: %v", err)
+	}
+
+	if err = RecordSlashing(store, SlashingRecord{Slot: 100, Time: 1000, AttSlashings: 1}); err != nil {
+		t.Fatalf("Recording slashing failed: %v", err)
+	}
+
+	if err = RecordSlashing(store, SlashingRecord{Slot: 200, Time: 2000, PropSlashings: 1}); err != nil {
+		t.Fatalf("Recording slashing failed: %v", err)
+	}
+
+	if err = MarkReorged(store, 100); err != nil {
+		t.Fatalf("Marking slot as reorged failed: %v", err)
+	}
+
+	// Changes outside of transactions are written on save
+	SlotProcessed(store, 4700000, 1660000000)
+	TrackBroadcast(store, 7, 1660000000, "MarkdownV2", true)
+	MessageSent(store, 7, 1, 555)
+	if err = Save(store); err != nil {
+		t.Fatalf("Saving store failed: %v", err)
+	}
+
+	MessageSent(store, 7, 3, 556)
+	if err = SaveQueue(store, []byte(`[{"Recipient":1}]`)); err != nil {
+		t.Fatalf("Saving queue failed: %v", err)
+	}
+
+	if err = Close(store); err != nil {
+		t.Fatalf("Closing store failed: %v", err)
+	}
+
+	store, err = Open(open())
+	if err != nil {
+		t.Fatalf("Reopening store failed: %v", err)
+	}
+
+	defer Close(store)
+
+	if subs := Subscribers(store); len(subs) != 2 || subs[0] != 1 || subs[1] != 3 {
+		t.Errorf("Expected subscribers [1 3], got %v", subs)
+	}
+
+	if GetPreferences(store, 3).Delivery != DeliveryDaily {
+		t.Errorf("Expected preferences to be stored, got %+v", GetPreferences(store, 3))
+	}
+
+	history := store.State.History
+	if len(history) != 2 || history[0].Slot != 100 || !history[0].Reorged || history[1].Slot != 200 {
+		t.Errorf("Expected history to be stored in order, got %+v", history)
+	}
+
+	if stats := GetStats(store); stats.CurrentSlot != 4700000 || stats.AttSlashings != 1 {
+		t.Errorf("Expected stats to be stored, got %+v", stats)
+	}
+
+	sent := SentBroadcasts(store)[7]
+	if sent.ParseMode != "MarkdownV2" || !sent.NoPreview || len(sent.Messages) != 2 || sent.Messages[3] != 556 {
+		t.Errorf("Expected sent messages to be stored, got %+v", sent)
+	}
+
+	// Broadcasts past their retention are forgotten
+	TrackBroadcast(store, 8, 1660000000+int64(SentRetention.Seconds())+1, "", false)
+	if err = Save(store); err != nil {
+		t.Fatalf("Saving store failed: %v", err)
+	}
+
+	if _, ok := SentBroadcasts(store)[7]; ok {
+		t.Errorf("Expected broadcast 7 to be forgotten")
+	}
+
+	if queue, err := LoadQueue(store); err != nil || string(queue) != `[{"Recipient":1}]` {
+		t.Errorf("Expected queue to be stored, got %s (err=%v)", queue, err)
+	}
+}
+
+func TestJSONBackend(t *testing.T) {
+	dir := t.TempDir()
+	testBackend(t, func() Backend {
+		backend, err := NewJSONBackend(dir, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return backend
+	})
+}
+
+func TestSQLiteBackend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	testBackend(t, func() Backend {
+		backend, err := NewSQLBackend(DriverSQLite, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return backend
+	})
+}
+
+func TestPostgresBackend(t *testing.T) {
+	// Runs against a scratch database, e.g. postgres://localhost/slashcaster_test?sslmode=disable
+	dsn := os.Getenv("SLASHCASTER_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("SLASHCASTER_TEST_POSTGRES_DSN not set")
+	}
+
+	backend, err := NewSQLBackend(DriverPostgres, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Start from empty tables
+	for _, table := range []string{"subscribers", "preferences", "history", "documents"} {
+		if _, err = backend.(*sqlBackend).db.Exec("DELETE FROM " + table); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backend.Close()
+
+	testBackend(t, func() Backend {
+		backend, err := NewSQLBackend(DriverPostgres, dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return backend
+	})
+}
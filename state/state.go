@@ -0,0 +1,435 @@
+package state
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+type State struct {
+	/*
+		Runtime state of the bot, persisted separately from the operator config.
+		History is append-only: transactions share it, so records must never be
+		modified in place. Copy the slice before changing or reordering records,
+		see MarkReorged.
+	*/
+	Subscribers []int64               // Telegram subscribers
+	Preferences map[int64]Preferences // Per-chat preferences
+	History     []SlashingRecord      // History of observed slashings
+	Bans        map[int64]Ban         // Chats banned for spam, or manually
+	Sent        map[int]SentBroadcast // Map broadcast ID to its delivered messages, kept for edits
+	Stats       Stats                 // Statistics
+}
+
+type Stats struct {
+	StartTime     int64            // Unix timestamp of startup time
+	CurrentSlot   int64            // Current slot: the streamer's cursor
+	BlockTime     int64            // Current block time
+	BlocksParsed  uint64           // Count of blocks parsed
+	AttSlashings  int              // Keep track of observed slashings
+	PropSlashings int              // Keep track of observed slashings
+	LastSlashing  int64            // Timestamp to keep track of last slashing
+	MessagesSent  int              // Keep track of delivered messages
+	Broadcasts    int              // Count of broadcasts made, used for broadcast IDs
+	LastDigests   map[string]int64 // Map delivery mode to the time its last digest covered
+}
+
+type Store struct {
+	/* Holds the runtime state. Changes are made in transactions, see Update. */
+	State   State      // Current state: lock Mutex before access
+	Mutex   sync.Mutex // Mutex to avoid concurrent writes
+	backend Backend    // Storage the state is persisted to, nil for in-memory stores
+}
+
+// File name of the state file
+const stateFile = "state.json"
+
+type legacyConfig struct {
+	/* Runtime state as it used to be stored in bot-config.json */
+	Stats       Stats
+	Preferences map[int64]Preferences
+	History     []SlashingRecord
+	Broadcast   struct {
+		TelegramSubscribers []int64
+	}
+}
+
+func copyState(state *State) State {
+	/*
+		Copies state for a transaction, so a failed transaction leaves the
+		original untouched. Only what transactions change is cloned: History is
+		shared, as appends to the copy never show in the original, and sent
+		broadcasts are only changed outside of transactions.
+	*/
+	copied := *state
+	copied.Subscribers = append([]int64(nil), state.Subscribers...)
+
+	if state.Preferences != nil {
+		copied.Preferences = make(map[int64]Preferences, len(state.Preferences))
+		for chatId, prefs := range state.Preferences {
+			copied.Preferences[chatId] = prefs
+		}
+	}
+
+	if state.Bans != nil {
+		copied.Bans = make(map[int64]Ban, len(state.Bans))
+		for chatId, ban := range state.Bans {
+			copied.Bans[chatId] = ban
+		}
+	}
+
+	if state.Stats.LastDigests != nil {
+		copied.Stats.LastDigests = make(map[string]int64, len(state.Stats.LastDigests))
+		for mode, until := range state.Stats.LastDigests {
+			copied.Stats.LastDigests[mode] = until
+		}
+	}
+
+	return copied
+}
+
+func deepCopyState(state *State) (State, error) {
+	// Deep-copy state, sharing nothing with the original
+	var copied State
+
+	jsonbytes, err := json.Marshal(state)
+	if err != nil {
+		return copied, err
+	}
+
+	err = json.Unmarshal(jsonbytes, &copied)
+	return copied, err
+}
+
+func Open(backend Backend) (*Store, error) {
+	/* Loads the state from backend */
+	state, err := backend.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	store := &Store{State: state, backend: backend}
+
+	// Set startup time
+	store.State.Stats.StartTime = time.Now().Unix()
+
+	return store, Save(store)
+}
+
+func Load(dir string, backups int) (*Store, error) {
+	/*
+		Loads the state from state.json in dir, falling back to a backup if the
+		state file is damaged. State stored in a pre-split bot-config.json is
+		imported by the config's schema migrations, see ImportLegacy.
+	*/
+	backend, err := NewJSONBackend(dir, backups)
+	if err != nil {
+		return nil, err
+	}
+
+	return Open(backend)
+}
+
+func Close(store *Store) error {
+	/* Saves the state, then releases the backend */
+	if err := Save(store); err != nil {
+		return err
+	}
+
+	if store.backend == nil {
+		return nil
+	}
+
+	return store.backend.Close()
+}
+
+func Copy(from *Store, to *Store) error {
+	/* Copies the full state and send queue of one store into another, e.g. to change backends */
+	from.Mutex.Lock()
+	state, err := deepCopyState(&from.State)
+	from.Mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	queue, err := LoadQueue(from)
+	if err != nil {
+		return err
+	}
+
+	if err = Update(to, func(draft *State) error {
+		*draft = state
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	return SaveQueue(to, queue)
+}
+
+func ImportLegacy(dir string, data []byte, backups int) error {
+	/*
+		Imports runtime state from a pre-split bot-config.json into the state
+		file in dir. Nothing is imported if a state file already exists.
+	*/
+	path := filepath.Join(dir, stateFile)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	var legacy legacyConfig
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return err
+	}
+
+	backend, err := NewJSONBackend(dir, backups)
+	if err != nil {
+		return err
+	}
+
+	store := &Store{backend: backend}
+	store.State = State{
+		Subscribers: legacy.Broadcast.TelegramSubscribers,
+		Preferences: legacy.Preferences,
+		History:     legacy.History,
+		Stats:       legacy.Stats,
+	}
+
+	if err := Save(store); err != nil {
+		return err
+	}
+
+	log.Info().Msgf("📦 Imported state of %d subscriber(s) into %s", len(store.State.Subscribers), path)
+	return nil
+}
+
+func Update(store *Store, fn func(state *State) error) error {
+	/*
+		Applies fn to the state in a transaction: fn works on a copy, which is
+		persisted before it replaces the current state. If fn or the write fails,
+		the state is left untouched.
+	*/
+	store.Mutex.Lock()
+	defer store.Mutex.Unlock()
+
+	draft := copyState(&store.State)
+
+	if err := fn(&draft); err != nil {
+		return err
+	}
+
+	if store.backend != nil {
+		if err := store.backend.Commit(&store.State, &draft); err != nil {
+			log.Error().Err(err).Msg("⚠️ Error writing state: transaction rolled back")
+			return err
+		}
+	}
+
+	store.State = draft
+	return nil
+}
+
+func Save(store *Store) error {
+	/*
+		Persists the current state, including changes made outside of
+		transactions. Those only touch statistics, which backends always write.
+	*/
+	store.Mutex.Lock()
+	defer store.Mutex.Unlock()
+
+	if store.backend == nil {
+		return nil
+	}
+
+	err := store.backend.Commit(&store.State, &store.State)
+	if err != nil {
+		log.Error().Err(err).Msg("⚠️ Error writing state")
+	}
+
+	return err
+}
+
+func LoadQueue(store *Store) ([]byte, error) {
+	/* Returns the persisted send queue, nil if there is none */
+	store.Mutex.Lock()
+	defer store.Mutex.Unlock()
+
+	if store.backend == nil {
+		return nil, nil
+	}
+
+	return store.backend.LoadQueue()
+}
+
+func SaveQueue(store *Store, data []byte) error {
+	/* Persists the send queue, nil data clears it */
+	store.Mutex.Lock()
+	defer store.Mutex.Unlock()
+
+	if store.backend == nil {
+		return nil
+	}
+
+	return store.backend.SaveQueue(data)
+}
+
+func AddSubscriber(store *Store, chatId int64) (bool, error) {
+	/* Adds a subscriber, returns false if the chat was already subscribed */
+	added := false
+
+	err := Update(store, func(state *State) error {
+		if hasSubscriber(state.Subscribers, chatId) {
+			return nil
+		}
+
+		state.Subscribers = append(state.Subscribers, chatId)
+		added = true
+		return nil
+	})
+
+	return added, err
+}
+
+func RemoveSubscriber(store *Store, chatId int64) (bool, error) {
+	/* Removes a subscriber, returns false if the chat was not subscribed */
+	removed := false
+
+	err := Update(store, func(state *State) error {
+		subs := state.Subscribers
+
+		for index, id := range subs {
+			if id == chatId {
+				// Index mangling
+				subs[index] = subs[len(subs)-1]
+				state.Subscribers = subs[:len(subs)-1]
+				removed = true
+				break
+			}
+		}
+
+		return nil
+	})
+
+	return removed, err
+}
+
+func MigrateChat(store *Store, from int64, to int64) (bool, error) {
+	/*
+		Moves a chat's subscription, preferences and ban to a new chat ID, e.g.
+		when a group is upgraded to a supergroup. Returns false if there was
+		nothing to move.
+	*/
+	migrated := false
+
+	err := Update(store, func(state *State) error {
+		for index, id := range state.Subscribers {
+			if id == from {
+				if hasSubscriber(state.Subscribers, to) {
+					state.Subscribers = append(state.Subscribers[:index], state.Subscribers[index+1:]...)
+				} else {
+					state.Subscribers[index] = to
+				}
+
+				migrated = true
+				break
+			}
+		}
+
+		if prefs, ok := state.Preferences[from]; ok {
+			delete(state.Preferences, from)
+			state.Preferences[to] = prefs
+			migrated = true
+		}
+
+		if ban, ok := state.Bans[from]; ok {
+			delete(state.Bans, from)
+			state.Bans[to] = ban
+			migrated = true
+		}
+
+		return nil
+	})
+
+	return migrated, err
+}
+
+func IsSubscriber(store *Store, chatId int64) bool {
+	/* Is the chat subscribed? */
+	store.Mutex.Lock()
+	defer store.Mutex.Unlock()
+
+	return hasSubscriber(store.State.Subscribers, chatId)
+}
+
+func Subscribers(store *Store) []int64 {
+	/* Returns a copy of the subscriber list */
+	store.Mutex.Lock()
+	defer store.Mutex.Unlock()
+
+	return append([]int64{}, store.State.Subscribers...)
+}
+
+func GetStats(store *Store) Stats {
+	/* Returns a copy of the statistics */
+	store.Mutex.Lock()
+	defer store.Mutex.Unlock()
+
+	return store.State.Stats
+}
+
+func SlotProcessed(store *Store, slot int64, blockTime int64) {
+	/* Moves the cursor past slot. Kept in memory until the next Save. */
+	store.Mutex.Lock()
+	store.State.Stats.BlocksParsed++
+	store.State.Stats.CurrentSlot = slot
+	store.State.Stats.BlockTime = blockTime
+	store.Mutex.Unlock()
+}
+
+func MessageDelivered(store *Store) {
+	/* Counts a single successful delivery. Kept in memory until the next Save. */
+	store.Mutex.Lock()
+	store.State.Stats.MessagesSent++
+	store.Mutex.Unlock()
+}
+
+func NextBroadcastId(store *Store) (int, error) {
+	/* Reserves the next broadcast ID */
+	var id int
+
+	err := Update(store, func(state *State) error {
+		state.Stats.Broadcasts++
+		id = state.Stats.Broadcasts
+		return nil
+	})
+
+	return id, err
+}
+
+func DigestPeriod(store *Store, mode string, until int64, period time.Duration) (int64, error) {
+	/* Marks a digest for mode as sent up to until, returns the start of the period it covers */
+	var since int64
+
+	err := Update(store, func(state *State) error {
+		if state.Stats.LastDigests == nil {
+			state.Stats.LastDigests = make(map[string]int64)
+		}
+
+		since = state.Stats.LastDigests[mode]
+		if since == 0 {
+			since = until - int64(period.Seconds())
+		}
+
+		state.Stats.LastDigests[mode] = until
+		return nil
+	})
+
+	return since, err
+}
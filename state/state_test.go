@@ -0,0 +1,232 @@
+package state
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestUpdateRollback(t *testing.T) {
+	store := &Store{}
+	if _, err := AddSubscriber(store, 1); err != nil {
+		t.Fatalf("Adding subscriber failed: %v", err)
+	}
+
+	// A failing transaction leaves the state untouched
+	err := Update(store, func(state *State) error {
+		state.Subscribers = append(state.Subscribers, 2)
+		state.Stats.Broadcasts = 10
+		return errors.New("abort")
+	})
+
+	if err == nil {
+		t.Fatalf("Expected transaction error to be returned")
+	}
+
+	if len(store.State.Subscribers) != 1 || store.State.Stats.Broadcasts != 0 {
+		t.Fatalf("Expected failed transaction to roll back, got state %+v", store.State)
+	}
+
+	// History is shared with transactions, but their changes don't show until committed
+	if err = RecordSlashing(store, SlashingRecord{Slot: 100}); err != nil {
+		t.Fatalf("Recording slashing failed: %v", err)
+	}
+
+	if err = SetPreferences(store, 1, Preferences{Language: "en"}); err != nil {
+		t.Fatalf("Setting preferences failed: %v", err)
+	}
+
+	committed := store.State.History
+	Update(store, func(state *State) error {
+		state.History = append(state.History, SlashingRecord{Slot: 200})
+		state.Preferences[1] = Preferences{Language: "de"}
+		return errors.New("abort")
+	})
+
+	if err = MarkReorged(store, 100); err != nil {
+		t.Fatalf("Marking slot as reorged failed: %v", err)
+	}
+
+	if len(store.State.History) != 1 || !store.State.History[0].Reorged || committed[0].Reorged {
+		t.Fatalf("Expected records to be replaced, not modified in place, got %+v and %+v", store.State.History, committed)
+	}
+
+	if store.State.Preferences[1].Language != "en" {
+		t.Fatalf("Expected failed transaction to roll back preferences, got %+v", store.State.Preferences)
+	}
+
+	// A failing write rolls back too
+	store.backend = &jsonBackend{path: filepath.Join(t.TempDir(), "missing", stateFile)}
+	if _, err = AddSubscriber(store, 3); err == nil {
+		t.Fatalf("Expected write to a missing folder to fail")
+	}
+
+	if len(store.State.Subscribers) != 1 {
+		t.Fatalf("Expected failed write to roll back, got subscribers %v", store.State.Subscribers)
+	}
+}
+
+func TestImportLegacy(t *testing.T) {
+	dir := t.TempDir()
+	legacy := []byte(`{
+		"LogPath": "logs",
+		"Tokens": {"Telegram": "secret"},
+		"Stats": {"CurrentSlot": 4700000, "AttSlashings": 3},
+		"Broadcast": {"TelegramChannel": -100, "TelegramSubscribers": [1, 2]}
+	}`)
+
+	if err := ImportLegacy(dir, legacy, 2); err != nil {
+		t.Fatalf("Importing legacy state failed: %v", err)
+	}
+
+	store, err := Load(dir, 2)
+	if err != nil {
+		t.Fatalf("Loading state failed: %v", err)
+	}
+
+	if len(store.State.Subscribers) != 2 || store.State.Stats.CurrentSlot != 4700000 {
+		t.Fatalf("Expected legacy state to be imported, got %+v", store.State)
+	}
+
+	// An existing state file is never overwritten
+	if err = ImportLegacy(dir, []byte(`{"Broadcast": {"TelegramSubscribers": [3]}}`), 2); err != nil {
+		t.Fatalf("Importing legacy state failed: %v", err)
+	}
+
+	store, err = Load(dir, 2)
+	if err != nil || store.State.Stats.AttSlashings != 3 || len(store.State.Subscribers) != 2 {
+		t.Fatalf("Expected state to be kept in %s, got %+v (err=%v)", stateFile, store.State, err)
+	}
+}
+
+func TestMigrateChat(t *testing.T) {
+	store := &Store{}
+	if _, err := AddSubscriber(store, -1); err != nil {
+		t.Fatalf("Adding subscriber failed: %v", err)
+	}
+
+	if err := SetPreferences(store, -1, Preferences{Delivery: DeliveryDaily}); err != nil {
+		t.Fatalf("Saving preferences failed: %v", err)
+	}
+
+	migrated, err := MigrateChat(store, -1, -1001)
+	if err != nil || !migrated {
+		t.Fatalf("Expected chat to be migrated, got %t (err=%v)", migrated, err)
+	}
+
+	if subs := Subscribers(store); len(subs) != 1 || subs[0] != -1001 {
+		t.Fatalf("Expected subscription to move to the new chat, got %v", subs)
+	}
+
+	if prefs := GetPreferences(store, -1001); prefs.Delivery != DeliveryDaily {
+		t.Fatalf("Expected preferences to move to the new chat, got %+v", prefs)
+	}
+
+	// Chats we know nothing about are left alone
+	if migrated, _ = MigrateChat(store, -2, -1002); migrated {
+		t.Fatalf("Expected unknown chat not to be migrated")
+	}
+}
+
+func TestLock(t *testing.T) {
+	dir := t.TempDir()
+
+	unlock, err := Lock(dir)
+	if err != nil {
+		t.Fatalf("Locking state failed: %v", err)
+	}
+
+	// The lock is held by a live process: this one
+	if _, err = Lock(dir); !errors.Is(err, ErrLocked) {
+		t.Fatalf("Expected ErrLocked, got %v", err)
+	}
+
+	if err = unlock(); err != nil {
+		t.Fatalf("Releasing lock failed: %v", err)
+	}
+
+	// Lock files of processes that are gone are replaced
+	if err = os.WriteFile(filepath.Join(dir, lockFile), []byte("999999999\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if unlock, err = Lock(dir); err != nil {
+		t.Fatalf("Expected a stale lock to be replaced, got %v", err)
+	}
+
+	unlock()
+}
+
+func TestRecordSlashingBackfill(t *testing.T) {
+	store := &Store{}
+	for _, record := range []SlashingRecord{
+		{Slot: 100, Time: 1000, AttSlashings: 1},
+		{Slot: 300, Time: 3000, AttSlashings: 1},
+		{Slot: 200, Time: 2000, AttSlashings: 1}, // Backfilled
+		{Slot: 300, Time: 3000, AttSlashings: 1}, // Streamed again
+	} {
+		if err := RecordSlashing(store, record); err != nil {
+			t.Fatalf("Recording slashing failed: %v", err)
+		}
+	}
+
+	history := store.State.History
+	if len(history) != 3 || history[0].Slot != 100 || history[1].Slot != 200 || history[2].Slot != 300 {
+		t.Fatalf("Expected slots 100, 200 and 300 in order, got %+v", history)
+	}
+
+	if stats := GetStats(store); stats.AttSlashings != 3 || stats.LastSlashing != 3000 {
+		t.Fatalf("Expected 3 slashings, the last at 3000, got %+v", stats)
+	}
+
+	// A slot whose record was reorged out can be recorded again
+	MarkReorged(store, 200)
+	if SlashingRecorded(store, 200) || !SlashingRecorded(store, 300) {
+		t.Fatalf("Expected only canonical records to count as recorded")
+	}
+}
+
+func TestWatchlistFilters(t *testing.T) {
+	store := &Store{}
+	if err := SetPreferences(store, 1, Preferences{MinValidators: 10}); err != nil {
+		t.Fatalf("Setting preferences failed: %v", err)
+	}
+
+	if added, err := Watch(store, 1, "42"); !added || err != nil {
+		t.Fatalf("Expected validator to be watched, got %v (%v)", added, err)
+	}
+
+	if added, _ := Watch(store, 1, "42"); added {
+		t.Fatalf("Expected a watched validator not to be added twice")
+	}
+
+	// Watched validators pass the filters, others have to meet them
+	prefs := GetPreferences(store, 1)
+	if !prefs.Wants([]string{"42"}) || prefs.Wants([]string{"1", "2"}) {
+		t.Fatalf("Expected only watched validators to pass a minimum of 10, got %+v", prefs)
+	}
+
+	if chats := Interested(store, []int64{1, 2}, []string{"1"}); len(chats) != 1 || chats[0] != 2 {
+		t.Fatalf("Expected only chat 2 to want the slashing, got %v", chats)
+	}
+
+	prefs.WatchlistOnly, prefs.MinValidators = true, 0
+	if prefs.Wants([]string{"1"}) || !prefs.Wants([]string{"1", "42"}) {
+		t.Fatalf("Expected only incidents of watched validators to pass, got %+v", prefs)
+	}
+
+	if removed, err := Unwatch(store, 1, "42"); !removed || err != nil || GetPreferences(store, 1).Watching("42") {
+		t.Fatalf("Expected validator to be unwatched, got %v (%v)", removed, err)
+	}
+
+	// Watchlists are capped
+	for i := 0; i < MaxWatchlist; i++ {
+		Watch(store, 2, strconv.Itoa(i))
+	}
+
+	if _, err := Watch(store, 2, "x"); !errors.Is(err, ErrWatchlistFull) {
+		t.Fatalf("Expected ErrWatchlistFull, got %v", err)
+	}
+}